@@ -0,0 +1,173 @@
+package godata
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// The parameter aliases of a request, e.g. @n in $filter=Name eq @n&@n='x'.
+// The values are expressions, or JSON arrays and objects.
+type parameterAliases struct {
+	values  map[string]string
+	service *GoDataService
+	// the aliases whose values are being resolved, to detect cycles
+	resolving map[string]bool
+}
+
+// Collect the parameter aliases from the keys of the query string that start
+// with @.
+func queryAliases(query url.Values, service *GoDataService) *parameterAliases {
+	aliases := &parameterAliases{map[string]string{}, service, map[string]bool{}}
+	for key := range query {
+		if strings.HasPrefix(key, "@") {
+			aliases.values[key] = query.Get(key)
+		}
+	}
+	return aliases
+}
+
+// Replace the aliases in a filter tree with the trees of their values.
+func (a *parameterAliases) resolveFilter(filter *GoDataFilterQuery) error {
+	if filter == nil || filter.Tree == nil {
+		return nil
+	}
+	tree, err := a.resolveNode(filter.Tree)
+	if err != nil {
+		return err
+	}
+	filter.Tree = tree
+	return nil
+}
+
+func (a *parameterAliases) resolveNode(node *ParseNode) (*ParseNode, error) {
+	if node.Token.Type == FilterTokenAlias {
+		return a.parseValue(node.Token)
+	}
+	for i, child := range node.Children {
+		resolved, err := a.resolveNode(child)
+		if err != nil {
+			return nil, err
+		}
+		node.Children[i] = resolved
+	}
+	return node, nil
+}
+
+// Parse the value of the alias. Every reference to an alias gets a tree of
+// its own, since semantic analysis annotates the tree with its context.
+func (a *parameterAliases) parseValue(alias *Token) (*ParseNode, error) {
+	name := alias.Value
+	value, ok := a.values[name]
+	if !ok {
+		return nil, &SyntaxError{alias.Offset, "Parameter alias " + name + " is not defined"}
+	}
+	if a.resolving[name] {
+		return nil, &SyntaxError{alias.Offset, "Parameter alias " + name + " refers to itself"}
+	}
+	a.resolving[name] = true
+	defer delete(a.resolving, name)
+
+	var node *ParseNode
+	switch {
+	case strings.HasPrefix(value, "["):
+		tokens, err := arrayListTokens(&Token{Value: value, Type: FilterTokenArray})
+		if err != nil {
+			return nil, optionError(name, value, err)
+		}
+		node = &ParseNode{Token: tokens[0]}
+		for _, token := range tokens[1 : len(tokens)-1] {
+			if token.Type != FilterTokenComma {
+				node.Children = append(node.Children, &ParseNode{Token: token, Parent: node})
+			}
+		}
+	case strings.HasPrefix(value, "{"):
+		if !json.Valid([]byte(value)) {
+			return nil, BadRequestError("Invalid JSON object in parameter alias " + name + ".")
+		}
+		node = &ParseNode{Token: &Token{Value: value, Type: FilterTokenObject}}
+	default:
+		filter, err := parseFilterString(value, a.service)
+		if err != nil {
+			return nil, optionError(name, value, err)
+		}
+		node = filter.Tree
+	}
+
+	// the value may refer to other aliases
+	return a.resolveNode(node)
+}
+
+// Resolve the aliases in the filters of the expand items and their nested
+// expands. Offsets in nested filters are relative to the filter, so errors do
+// not show a position.
+func (a *parameterAliases) resolveExpand(expand *GoDataExpandQuery) error {
+	if expand == nil {
+		return nil
+	}
+	for _, item := range expand.ExpandItems {
+		if err := a.resolveFilter(item.Filter); err != nil {
+			if syntaxErr, ok := err.(*SyntaxError); ok {
+				return BadRequestError(syntaxErr.Message + " in $expand.")
+			}
+			return err
+		}
+		if err := a.resolveOrderBy(item.OrderBy); err != nil {
+			if syntaxErr, ok := err.(*SyntaxError); ok {
+				return BadRequestError(syntaxErr.Message + " in $expand.")
+			}
+			return err
+		}
+		if err := a.resolveExpand(item.Expand); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replace the aliases in the order by expressions with the trees of their
+// values.
+func (a *parameterAliases) resolveOrderBy(orderby *GoDataOrderByQuery) error {
+	if orderby == nil {
+		return nil
+	}
+	for _, item := range orderby.OrderByItems {
+		tree, err := a.resolveNode(item.Tree)
+		if err != nil {
+			return err
+		}
+		item.Tree = tree
+		item.Field.Value = printFilterNode(tree, a.service.filterParser())
+	}
+	return nil
+}
+
+// Replace aliases used as key values or function parameters in the segments
+// of the path, e.g. Customers(@id) or Customers(Id=@id).
+func (a *parameterAliases) resolvePath(first *GoDataSegment) error {
+	for segment := first; segment != nil; segment = segment.Next {
+		if segment.Identifier == nil {
+			continue
+		}
+		resolved := GoDataIdentifier{}
+		for key, value := range *segment.Identifier {
+			if value == "" && strings.HasPrefix(key, "@") {
+				// a single key value without a name
+				key, value = value, key
+			}
+			if strings.HasPrefix(value, "@") {
+				v, ok := a.values[value]
+				if !ok {
+					return BadRequestError("Parameter alias " + value + " is not defined.")
+				}
+				value = v
+			}
+			if key == "" {
+				key, value = value, ""
+			}
+			resolved[key] = value
+		}
+		*segment.Identifier = resolved
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package godata
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// Parse a request with the query string given as raw url.
+func parseAliasTestRequest(rawUrl string) (*GoDataRequest, error) {
+	parsedUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRequest(parsedUrl.Path, parsedUrl.Query())
+}
+
+func TestParameterAliases(t *testing.T) {
+	tests := map[string]string{
+		"Customers?$filter=Name eq @n&@n='x'":                       "Name eq 'x'",
+		"Customers?$filter=contains(Name,@n)&@n='x'":                "contains(Name,'x')",
+		"Customers?$filter=@a mul 2 gt 3&@a=Age add 1":              "(Age add 1) mul 2 gt 3",
+		"Customers?$filter=Age in @ids&@ids=[1,2,3]":                "Age in (1,2,3)",
+		"Customers?$filter=Age eq @a&@a=@b&@b=5":                    "Age eq 5",
+		"Customers?$filter=Address eq @addr&@addr={\"City\":\"A\"}": "Address eq {\"City\":\"A\"}",
+	}
+	for input, expected := range tests {
+		request, err := parseAliasTestRequest(input)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		if actual := request.Query.Filter.String(); actual != expected {
+			t.Error(input + ": filter is " + actual + " not " + expected)
+		}
+	}
+
+	request, err := parseAliasTestRequest("Customers(@id)/Orders(Id=@o)?$orderby=@f desc" +
+		"&$expand=Orders($filter=Id eq @o)&@id=1&@o=2&@f=Name")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, ok := (*request.FirstSegment.Identifier)["1"]; !ok {
+		t.Error("Key alias @id is not resolved")
+	}
+	if (*request.LastSegment.Identifier)["Id"] != "2" {
+		t.Error("Key alias @o is not resolved")
+	}
+	if request.Query.OrderBy.OrderByItems[0].Field.Value != "Name" {
+		t.Error("Order by alias @f is not resolved")
+	}
+	if request.Query.Expand.ExpandItems[0].Filter.String() != "Id eq 2" {
+		t.Error("Alias in the expand filter is not resolved: " + request.Query.Expand.ExpandItems[0].Filter.String())
+	}
+}
+
+func TestParameterAliasErrors(t *testing.T) {
+	tests := map[string]string{
+		"Customers?$filter=Name eq @n":                    "Invalid $filter at position 8: Parameter alias @n is not defined",
+		"Customers?$filter=Age eq @a&@a=@a":               "Parameter alias @a refers to itself",
+		"Customers?$filter=Age eq @a&@a=1 add":            "Invalid @a at position",
+		"Customers?$filter=Age in @a&@a=[1,":              "Invalid JSON array",
+		"Customers?$orderby=@f":                           "Invalid $orderby at position 0: Parameter alias @f is not defined",
+		"Customers?$expand=Orders($filter=Id eq @o)":      "Parameter alias @o is not defined in $expand",
+		"Customers(@id)":                                  "Parameter alias @id is not defined",
+		"Customers?$filter=Address eq @a&@a={\"City\":1,": "Invalid JSON object in parameter alias @a",
+	}
+	for input, expected := range tests {
+		_, err := parseAliasTestRequest(input)
+		if err == nil {
+			t.Error("Expected an error for " + input)
+			continue
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Error("Error for " + input + " does not contain '" + expected + "': " + err.Error())
+		}
+	}
+
+	// aliases are resolved by ParseRequest, not by ParseFilterString
+	if _, err := semanticizeCustomerFilter("Name eq @n"); err == nil {
+		t.Error("Expected an error for an unresolved alias")
+	}
+}
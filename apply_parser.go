@@ -1,6 +1,763 @@
 package godata
 
+import (
+	"strconv"
+	"strings"
+)
+
+// The kinds of transformations of $apply, see the Data Aggregation extension.
+const (
+	ApplyAggregate = iota
+	ApplyGroupBy
+	ApplyFilter
+	ApplyCompute
+	ApplyOrderBy
+	ApplySearch
+	ApplyExpand
+	ApplyConcat
+	ApplyTop
+	ApplySkip
+	ApplyTopCount
+	ApplyBottomCount
+	ApplyTopPercent
+	ApplyBottomPercent
+	ApplyTopSum
+	ApplyBottomSum
+	ApplyIdentity
+)
+
+var applyKinds = map[string]int{
+	"aggregate":     ApplyAggregate,
+	"groupby":       ApplyGroupBy,
+	"filter":        ApplyFilter,
+	"compute":       ApplyCompute,
+	"orderby":       ApplyOrderBy,
+	"search":        ApplySearch,
+	"expand":        ApplyExpand,
+	"concat":        ApplyConcat,
+	"top":           ApplyTop,
+	"skip":          ApplySkip,
+	"topcount":      ApplyTopCount,
+	"bottomcount":   ApplyBottomCount,
+	"toppercent":    ApplyTopPercent,
+	"bottompercent": ApplyBottomPercent,
+	"topsum":        ApplyTopSum,
+	"bottomsum":     ApplyBottomSum,
+	"identity":      ApplyIdentity,
+}
+
+// The aggregation methods of the standard. Other methods must be qualified
+// with the namespace of a custom aggregation method.
+var applyMethods = map[string]bool{
+	"sum":           true,
+	"min":           true,
+	"max":           true,
+	"average":       true,
+	"countdistinct": true,
+}
+
+// A transformation of $apply. The fields that are set depend on the kind.
+type ApplyTransformation struct {
+	Kind int
+	// The name of the transformation, e.g. aggregate or topcount.
+	Name string
+	// The aggregate expressions of aggregate.
+	Aggregates []*AggregateExpression
+	// The computed properties of compute.
+	Computes []*ComputeExpression
+	// The property paths of groupby, and the transformations applied to each
+	// group if there are any.
+	GroupBy [][]*Token
+	Apply   *GoDataApplyQuery
+	Filter  *GoDataFilterQuery
+	Search  *GoDataSearchQuery
+	OrderBy *GoDataOrderByQuery
+	// The path and the nested filter and expands of expand.
+	Expand *ExpandItem
+	// The sequences of transformations of concat.
+	Sequences []*GoDataApplyQuery
+	// The number of top and skip, and the first argument of topcount,
+	// bottomcount, toppercent, bottompercent, topsum and bottomsum. Their
+	// second argument is the expression.
+	N          float64
+	Expression *ParseNode
+}
+
+// An aggregate expression: an expression aggregated with a method, or $count,
+// and the alias of the result.
+type AggregateExpression struct {
+	// The aggregated expression, nil for $count.
+	Expression *ParseNode
+	// One of the standard methods or a qualified custom method, empty for
+	// $count.
+	Method string
+	Alias  string
+}
+
+// A property computed by compute: an expression and its alias.
+type ComputeExpression struct {
+	Expression *ParseNode
+	Alias      string
+}
+
 func ParseApplyString(apply string) (*GoDataApplyQuery, error) {
-	result := GoDataApplyQuery(apply)
-	return &result, nil
+	result, err := parseApplyString(apply, nil)
+	if err != nil {
+		return nil, optionError("$apply", apply, err)
+	}
+	return result, nil
+}
+
+// Parse the transformations separated by slashes. Their expressions may use
+// the custom functions of the service, which may be nil.
+func parseApplyString(apply string, service *GoDataService) (*GoDataApplyQuery, error) {
+	return parseApplySequence(applyPart{apply, 0}, service)
+}
+
+// A part of the $apply text and its offset in it.
+type applyPart struct {
+	text   string
+	offset int
+}
+
+// The nesting depth of each byte of the text in parentheses, or -1 within
+// quoted strings.
+func applyDepths(part applyPart) ([]int, error) {
+	text := part.text
+	depths := make([]int, len(text))
+	open := []int{}
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; c {
+		case '\'', '"':
+			// single quotes are escaped by doubling them, double quotes of
+			// search phrases with a backslash
+			j := i + 1
+			for ; j < len(text); j++ {
+				if c == '"' && text[j] == '\\' {
+					j++
+				} else if text[j] == c && c == '\'' && j+1 < len(text) && text[j+1] == '\'' {
+					j++
+				} else if text[j] == c {
+					break
+				}
+			}
+			if j >= len(text) {
+				return nil, &SyntaxError{part.offset + i, "Unterminated string"}
+			}
+			for k := i; k <= j; k++ {
+				depths[k] = -1
+			}
+			i = j
+		case '(':
+			depths[i] = len(open)
+			open = append(open, i)
+		case ')':
+			if len(open) == 0 {
+				return nil, &SyntaxError{part.offset + i, "Mismatched parenthesis, no opening parenthesis for this one"}
+			}
+			open = open[:len(open)-1]
+			depths[i] = len(open)
+		default:
+			depths[i] = len(open)
+		}
+	}
+	if len(open) > 0 {
+		return nil, &SyntaxError{part.offset + open[len(open)-1], "Mismatched parenthesis, this one is never closed"}
+	}
+	return depths, nil
+}
+
+// Trim the spaces around the part.
+func (part applyPart) trim() applyPart {
+	trimmed := strings.TrimLeft(part.text, " ")
+	return applyPart{strings.TrimRight(trimmed, " "), part.offset + len(part.text) - len(trimmed)}
+}
+
+// Split the part at the separator outside of parentheses and strings. The
+// parts are trimmed.
+func (part applyPart) split(sep byte) ([]applyPart, error) {
+	depths, err := applyDepths(part)
+	if err != nil {
+		return nil, err
+	}
+	result := []applyPart{}
+	start := 0
+	for i := 0; i <= len(part.text); i++ {
+		if i == len(part.text) || (part.text[i] == sep && depths[i] == 0) {
+			result = append(result, applyPart{part.text[start:i], part.offset + start}.trim())
+			start = i + 1
+		}
+	}
+	return result, nil
+}
+
+// Split the part at the last occurrence of the keyword, surrounded by spaces,
+// outside of parentheses and strings. Returns false if there is none.
+func (part applyPart) cut(keyword string) (applyPart, applyPart, bool) {
+	depths, err := applyDepths(part)
+	if err != nil {
+		return part, applyPart{}, false
+	}
+	separator := " " + keyword + " "
+	for i := strings.LastIndex(part.text, separator); i >= 0; i = strings.LastIndex(part.text[:i], separator) {
+		if depths[i] == 0 {
+			before := applyPart{part.text[:i], part.offset}.trim()
+			after := applyPart{part.text[i+len(separator):], part.offset + i + len(separator)}.trim()
+			return before, after, true
+		}
+	}
+	return part, applyPart{}, false
+}
+
+// Check whether the text is an identifier, e.g. an alias.
+func isApplyIdentifier(text string) bool {
+	if text == "" || (text[0] >= '0' && text[0] <= '9') {
+		return false
+	}
+	for _, c := range text {
+		if !(c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseApplySequence(part applyPart, service *GoDataService) (*GoDataApplyQuery, error) {
+	parts, err := part.split('/')
+	if err != nil {
+		return nil, err
+	}
+	result := &GoDataApplyQuery{}
+	for _, p := range parts {
+		transformation, err := parseApplyTransformation(p, service)
+		if err != nil {
+			return nil, err
+		}
+		result.Transformations = append(result.Transformations, transformation)
+	}
+	return result, nil
+}
+
+// Parse a transformation, its name followed by its arguments in parentheses.
+func parseApplyTransformation(part applyPart, service *GoDataService) (*ApplyTransformation, error) {
+	if part.text == "" {
+		return nil, &SyntaxError{part.offset, "Expected a transformation"}
+	}
+	if part.text == "identity" {
+		return &ApplyTransformation{Kind: ApplyIdentity, Name: "identity"}, nil
+	}
+	open := strings.IndexByte(part.text, '(')
+	if open < 0 {
+		return nil, &SyntaxError{part.offset, "Expected a transformation with arguments in parentheses"}
+	}
+	name := strings.TrimSpace(part.text[:open])
+	kind, ok := applyKinds[name]
+	if !ok || kind == ApplyIdentity {
+		return nil, &SyntaxError{part.offset, "Unsupported transformation " + name}
+	}
+	depths, err := applyDepths(part)
+	if err != nil {
+		return nil, err
+	}
+	// the arguments end at the paren matching the opening one
+	end := open + 1
+	for end < len(part.text) && !(part.text[end] == ')' && depths[end] == 0) {
+		end++
+	}
+	if end != len(part.text)-1 {
+		return nil, &SyntaxError{part.offset + end + 1, "Expected a slash"}
+	}
+	args := applyPart{part.text[open+1 : end], part.offset + open + 1}.trim()
+
+	// shift the position of an error in the arguments to its position in
+	// the $apply
+	nested := func(err error) error {
+		if syntaxErr, ok := err.(*SyntaxError); ok {
+			return &SyntaxError{args.offset + syntaxErr.Offset, syntaxErr.Message + " in " + name}
+		}
+		return err
+	}
+
+	t := &ApplyTransformation{Kind: kind, Name: name}
+	switch kind {
+	case ApplyAggregate:
+		t.Aggregates, err = parseApplyAggregates(args, service)
+	case ApplyCompute:
+		t.Computes, err = parseApplyComputes(args, service)
+	case ApplyGroupBy:
+		err = parseApplyGroupBy(args, t, service)
+	case ApplyFilter:
+		if t.Filter, err = parseFilterString(args.text, service); err != nil {
+			err = nested(err)
+		}
+	case ApplySearch:
+		if t.Search, err = parseSearchString(args.text); err != nil {
+			err = nested(err)
+		}
+	case ApplyOrderBy:
+		if t.OrderBy, err = parseOrderByString(args.text, service); err != nil {
+			err = nested(err)
+		}
+	case ApplyExpand:
+		t.Expand, err = parseApplyExpand(args, service)
+	case ApplyConcat:
+		err = parseApplyConcat(args, t, service)
+	case ApplyTop, ApplySkip:
+		n, convErr := strconv.Atoi(args.text)
+		if convErr != nil || n < 0 {
+			return nil, &SyntaxError{args.offset, "Expected a number in " + name}
+		}
+		t.N = float64(n)
+	default:
+		err = parseApplyRanking(args, t, service)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Parse an expression with the syntax of a $filter.
+func parseApplyExpression(part applyPart, service *GoDataService) (*ParseNode, error) {
+	if part.text == "" {
+		return nil, &SyntaxError{part.offset, "Expected an expression"}
+	}
+	filter, err := parseFilterString(part.text, service)
+	if err != nil {
+		if syntaxErr, ok := err.(*SyntaxError); ok {
+			return nil, &SyntaxError{part.offset + syntaxErr.Offset, syntaxErr.Message}
+		}
+		return nil, err
+	}
+	return filter.Tree, nil
+}
+
+// Split the part into the expression and the alias following as.
+func parseApplyAlias(part applyPart) (applyPart, string, error) {
+	expr, alias, ok := part.cut("as")
+	if !ok {
+		return part, "", &SyntaxError{part.offset + len(part.text), "Expected as and an alias"}
+	}
+	if !isApplyIdentifier(alias.text) {
+		return part, "", &SyntaxError{alias.offset, "Expected an alias"}
+	}
+	return expr, alias.text, nil
+}
+
+func parseApplyAggregates(args applyPart, service *GoDataService) ([]*AggregateExpression, error) {
+	parts, err := args.split(',')
+	if err != nil {
+		return nil, err
+	}
+	result := []*AggregateExpression{}
+	for _, part := range parts {
+		expr, alias, err := parseApplyAlias(part)
+		if err != nil {
+			return nil, err
+		}
+		aggregate := &AggregateExpression{Alias: alias}
+		if expr.text != "$count" {
+			value, method, ok := expr.cut("with")
+			if !ok {
+				return nil, &SyntaxError{expr.offset + len(expr.text), "Expected with and an aggregation method"}
+			}
+			if !applyMethods[method.text] && !strings.Contains(method.text, ".") {
+				return nil, &SyntaxError{method.offset, "Unsupported aggregation method " + method.text}
+			}
+			aggregate.Method = method.text
+			if aggregate.Expression, err = parseApplyExpression(value, service); err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, aggregate)
+	}
+	return result, nil
+}
+
+func parseApplyComputes(args applyPart, service *GoDataService) ([]*ComputeExpression, error) {
+	parts, err := args.split(',')
+	if err != nil {
+		return nil, err
+	}
+	result := []*ComputeExpression{}
+	for _, part := range parts {
+		expr, alias, err := parseApplyAlias(part)
+		if err != nil {
+			return nil, err
+		}
+		tree, err := parseApplyExpression(expr, service)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &ComputeExpression{tree, alias})
+	}
+	return result, nil
+}
+
+// Parse the property paths in parentheses and the optional transformations
+// applied to each group.
+func parseApplyGroupBy(args applyPart, t *ApplyTransformation, service *GoDataService) error {
+	parts, err := args.split(',')
+	if err != nil {
+		return err
+	}
+	if len(parts) > 2 {
+		return &SyntaxError{parts[2].offset, "Expected at most two arguments in groupby"}
+	}
+	paths := parts[0]
+	if !strings.HasPrefix(paths.text, "(") || !strings.HasSuffix(paths.text, ")") {
+		return &SyntaxError{paths.offset, "Expected property paths in parentheses"}
+	}
+	items, err := applyPart{paths.text[1 : len(paths.text)-1], paths.offset + 1}.split(',')
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		segments, err := item.split('/')
+		if err != nil {
+			return err
+		}
+		path := []*Token{}
+		for _, segment := range segments {
+			if !isApplyIdentifier(segment.text) {
+				return &SyntaxError{segment.offset, "Expected a property path"}
+			}
+			path = append(path, &Token{Value: segment.text, Offset: segment.offset})
+		}
+		t.GroupBy = append(t.GroupBy, path)
+	}
+	if len(parts) == 2 {
+		t.Apply, err = parseApplySequence(parts[1], service)
+	}
+	return err
+}
+
+// Parse the navigation path of expand, followed by an optional filter and
+// nested expands.
+func parseApplyExpand(args applyPart, service *GoDataService) (*ExpandItem, error) {
+	parts, err := args.split(',')
+	if err != nil {
+		return nil, err
+	}
+	segments, err := parts[0].split('/')
+	if err != nil {
+		return nil, err
+	}
+	item := &ExpandItem{}
+	for _, segment := range segments {
+		if !isApplyIdentifier(segment.text) && !strings.Contains(segment.text, ".") {
+			return nil, &SyntaxError{segment.offset, "Expected a navigation property"}
+		}
+		item.Path = append(item.Path, &Token{Value: segment.text, Offset: segment.offset, Type: ExpandTokenLiteral})
+	}
+	for _, part := range parts[1:] {
+		nested, err := parseApplyTransformation(part, service)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case nested.Kind == ApplyFilter && item.Filter == nil && item.Expand == nil:
+			item.Filter = nested.Filter
+		case nested.Kind == ApplyExpand:
+			if item.Expand == nil {
+				item.Expand = &GoDataExpandQuery{[]*ExpandItem{}}
+			}
+			item.Expand.ExpandItems = append(item.Expand.ExpandItems, nested.Expand)
+		default:
+			return nil, &SyntaxError{part.offset, "Expected a filter followed by expands in expand"}
+		}
+	}
+	return item, nil
+}
+
+func parseApplyConcat(args applyPart, t *ApplyTransformation, service *GoDataService) error {
+	parts, err := args.split(',')
+	if err != nil {
+		return err
+	}
+	if len(parts) < 2 {
+		return &SyntaxError{args.offset + len(args.text), "Expected at least two sequences of transformations in concat"}
+	}
+	for _, part := range parts {
+		sequence, err := parseApplySequence(part, service)
+		if err != nil {
+			return err
+		}
+		t.Sequences = append(t.Sequences, sequence)
+	}
+	return nil
+}
+
+// Parse the number and the expression of topcount, bottomcount, toppercent,
+// bottompercent, topsum and bottomsum.
+func parseApplyRanking(args applyPart, t *ApplyTransformation, service *GoDataService) error {
+	parts, err := args.split(',')
+	if err != nil {
+		return err
+	}
+	if len(parts) != 2 {
+		return &SyntaxError{args.offset, "Expected a number and an expression in " + t.Name}
+	}
+	if t.Kind == ApplyTopCount || t.Kind == ApplyBottomCount {
+		n, err := strconv.Atoi(parts[0].text)
+		if err != nil || n < 0 {
+			return &SyntaxError{parts[0].offset, "Expected a number in " + t.Name}
+		}
+		t.N = float64(n)
+	} else {
+		n, err := strconv.ParseFloat(parts[0].text, 64)
+		if err != nil || n < 0 || (n > 100 && (t.Kind == ApplyTopPercent || t.Kind == ApplyBottomPercent)) {
+			return &SyntaxError{parts[0].offset, "Expected a number in " + t.Name}
+		}
+		t.N = n
+	}
+	t.Expression, err = parseApplyExpression(parts[1], service)
+	return err
+}
+
+// The properties available to a transformation: those of the entity type,
+// unless the entities were aggregated, and the aliases introduced by the
+// transformations before it, mapped to their Edm types.
+type applyScope struct {
+	entity  *GoDataEntityType
+	aliases map[string]string
+}
+
+// Check whether the name is a property or an alias in the scope.
+func (scope applyScope) has(service *GoDataService, name string) bool {
+	if _, ok := scope.aliases[name]; ok {
+		return true
+	}
+	if scope.entity == nil {
+		return false
+	}
+	_, isProperty := service.PropertyLookup[scope.entity][name]
+	_, isNavigation := service.NavigationPropertyLookup[scope.entity][name]
+	return isProperty || isNavigation
+}
+
+// A copy of the scope with more aliases.
+func (scope applyScope) with(aliases map[string]string) applyScope {
+	result := applyScope{scope.entity, map[string]string{}}
+	for name, edmType := range scope.aliases {
+		result.aliases[name] = edmType
+	}
+	for name, edmType := range aliases {
+		result.aliases[name] = edmType
+	}
+	return result
+}
+
+// Resolve the transformations against the entity type. The properties
+// available to a transformation are those produced by the ones before it, so
+// after aggregate only the aliases of the aggregates remain.
+func SemanticizeApplyQuery(apply *GoDataApplyQuery, service *GoDataService, entity *GoDataEntityType) error {
+	if apply == nil {
+		return nil
+	}
+	_, err := semanticizeApply(apply, service, applyScope{entity, map[string]string{}})
+	return err
+}
+
+// Resolve the transformations and return the scope of their output.
+func semanticizeApply(apply *GoDataApplyQuery, service *GoDataService, scope applyScope) (applyScope, error) {
+	for _, t := range apply.Transformations {
+		var err error
+		if scope, err = semanticizeApplyTransformation(t, service, scope); err != nil {
+			return scope, err
+		}
+	}
+	return scope, nil
+}
+
+func semanticizeApplyTransformation(t *ApplyTransformation, service *GoDataService, scope applyScope) (applyScope, error) {
+	semantics := &filterSemantics{service: service, parser: service.filterParser(), entity: scope.entity, aliases: scope.aliases}
+	expression := func(node *ParseNode) error {
+		_, err := semantics.semanticize(node, filterScope{})
+		return err
+	}
+	// the aliases introduced by the transformation
+	aliases := map[string]string{}
+	alias := func(name, edmType string) error {
+		if _, ok := aliases[name]; ok || scope.has(service, name) {
+			return BadRequestError("The alias " + name + " of " + t.Name + " is already a property.")
+		}
+		aliases[name] = edmType
+		return nil
+	}
+
+	switch t.Kind {
+	case ApplyAggregate:
+		for _, aggregate := range t.Aggregates {
+			edmType := GoDataDecimal
+			if aggregate.Expression != nil {
+				if err := expression(aggregate.Expression); err != nil {
+					return scope, err
+				}
+				edmType = aggregate.Expression.EdmType
+				if err := checkApplyNumeric(aggregate.Expression, aggregate.Method, aggregate.Method == "sum" || aggregate.Method == "average"); err != nil {
+					return scope, err
+				}
+				switch {
+				case aggregate.Method == "average":
+					edmType = GoDataDouble
+				case aggregate.Method == "countdistinct":
+					edmType = GoDataDecimal
+				case strings.Contains(aggregate.Method, "."):
+					// the type of a custom aggregation is unknown
+					edmType = ""
+				}
+			}
+			if err := alias(aggregate.Alias, edmType); err != nil {
+				return scope, err
+			}
+		}
+		return applyScope{nil, aliases}, nil
+	case ApplyCompute:
+		for _, compute := range t.Computes {
+			if err := expression(compute.Expression); err != nil {
+				return scope, err
+			}
+			if err := alias(compute.Alias, compute.Expression.EdmType); err != nil {
+				return scope, err
+			}
+		}
+		return scope.with(aliases), nil
+	case ApplyGroupBy:
+		for _, path := range t.GroupBy {
+			edmType, err := semanticizeApplyPath(path, service, scope)
+			if err != nil {
+				return scope, err
+			}
+			aliases[path[0].Value] = edmType
+		}
+		if t.Apply != nil {
+			// the groups also have the properties aggregated within them
+			output, err := semanticizeApply(t.Apply, service, scope)
+			if err != nil {
+				return scope, err
+			}
+			if output.entity == nil {
+				for name, edmType := range output.aliases {
+					aliases[name] = edmType
+				}
+			}
+		}
+		return applyScope{nil, aliases}, nil
+	case ApplyFilter:
+		return scope, semanticizeFilter(t.Filter, semantics)
+	case ApplyOrderBy:
+		return scope, semanticizeOrderByItems(t.OrderBy, semantics)
+	case ApplyTopCount, ApplyBottomCount, ApplyTopPercent, ApplyBottomPercent, ApplyTopSum, ApplyBottomSum:
+		if err := expression(t.Expression); err != nil {
+			return scope, err
+		}
+		return scope, checkApplyNumeric(t.Expression, t.Name, t.Kind != ApplyTopCount && t.Kind != ApplyBottomCount)
+	case ApplyExpand:
+		if scope.entity == nil {
+			return scope, BadRequestError("Cannot expand " + printPath(t.Expand.Path) + " after aggregating.")
+		}
+		expand := &GoDataExpandQuery{[]*ExpandItem{t.Expand}}
+		if err := SemanticizeExpandQuery(expand, service, scope.entity); err != nil {
+			return scope, err
+		}
+		t.Expand = expand.ExpandItems[0]
+		return scope, nil
+	case ApplyConcat:
+		return semanticizeApplyConcat(t, service, scope)
+	}
+	// search, top, skip and identity keep the properties
+	return scope, nil
+}
+
+// Check that an aggregated expression is numeric if the method requires it.
+func checkApplyNumeric(node *ParseNode, method string, numeric bool) error {
+	if numeric && isPrimitiveEdmType(node.EdmType) && !isNumericEdmType(node.EdmType) {
+		return BadRequestError("Cannot apply " + method + " to '" + printFilterNode(node, GlobalFilterParser) +
+			"', it is of type " + describeEdmType(node.EdmType) + ".")
+	}
+	return nil
+}
+
+// Resolve a grouping property path and return the Edm type of its first
+// segment.
+func semanticizeApplyPath(path []*Token, service *GoDataService, scope applyScope) (string, error) {
+	head := path[0]
+	if edmType, ok := scope.aliases[head.Value]; ok {
+		head.SemanticType = SemanticTypePropertyValue
+		head.SemanticReference = &head.Value
+		if len(path) > 1 {
+			return edmType, NotImplementedError("Grouping by a member of the alias " + head.Value + " is not supported.")
+		}
+		return edmType, nil
+	}
+	var t *structuredType
+	if scope.entity != nil {
+		t = service.entityStructuredType(scope.entity)
+	}
+	result := ""
+	for i, segment := range path {
+		if t == nil {
+			return "", BadRequestError("No property found " + segment.Value + " in groupby")
+		}
+		if prop := service.structuredProperty(t, segment.Value); prop != nil {
+			segment.SemanticType = SemanticTypeProperty
+			segment.SemanticReference = prop
+			if i == 0 {
+				result = prop.Type
+			}
+			// the members of a complex property follow it
+			t = service.lookupStructuredType(prop.Type)
+			continue
+		}
+		navProp := service.structuredNavigationProperty(t, segment.Value)
+		if navProp == nil {
+			if t.entity == nil {
+				return "", BadRequestError("No property found " + segment.Value + " on complex type " + t.name())
+			}
+			return "", BadRequestError("No property found " + segment.Value + " on entity " + t.name())
+		}
+		target := service.lookupStructuredType(navProp.Type)
+		if target == nil || target.entity == nil {
+			return "", BadRequestError("Navigation property " + navProp.Name + " has the unknown entity type " + navProp.Type + ".")
+		}
+		segment.SemanticType = SemanticTypeEntity
+		segment.SemanticReference = navProp
+		if i == 0 {
+			result = navProp.Type
+		}
+		t = target
+	}
+	if t != nil && t.entity != nil {
+		return "", BadRequestError("Cannot group by " + printPath(path) + ", it is an entity.")
+	}
+	return result, nil
+}
+
+// Resolve the sequences of concat, which all apply to the input. The output
+// has the entity type of the input only if no sequence aggregates.
+func semanticizeApplyConcat(t *ApplyTransformation, service *GoDataService, scope applyScope) (applyScope, error) {
+	aliases := map[string]string{}
+	aggregated := false
+	for _, sequence := range t.Sequences {
+		output, err := semanticizeApply(sequence, service, scope)
+		if err != nil {
+			return scope, err
+		}
+		for name, edmType := range output.aliases {
+			aliases[name] = edmType
+		}
+		aggregated = aggregated || output.entity == nil
+	}
+	if !aggregated {
+		return applyScope{scope.entity, aliases}, nil
+	}
+	if scope.entity != nil {
+		for name, prop := range service.PropertyLookup[scope.entity] {
+			if _, ok := aliases[name]; !ok {
+				aliases[name] = prop.Type
+			}
+		}
+	}
+	return applyScope{nil, aliases}, nil
 }
@@ -0,0 +1,211 @@
+package godata
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func semanticizeApplyString(entityType, input string) (*GoDataApplyQuery, error) {
+	service, err := BuildService(&DummyProvider{}, "http://localhost")
+	if err != nil {
+		return nil, err
+	}
+	entity, err := service.LookupEntityType(entityType)
+	if err != nil {
+		return nil, err
+	}
+	apply, err := service.ParseApplyString(input)
+	if err != nil {
+		return nil, err
+	}
+	return apply, SemanticizeApplyQuery(apply, service, entity)
+}
+
+func TestParseApply(t *testing.T) {
+	tests := map[string]string{
+		"aggregate(Age with sum as Total, $count as Count)":                      "aggregate(Age with sum as Total,$count as Count)",
+		"groupby((Name, Orders/Id))":                                             "groupby((Name,Orders/Id))",
+		"groupby((Tier),aggregate(Age with average as Mean))/filter(Mean gt 30)": "groupby((Tier),aggregate(Age with average as Mean))/filter(Mean gt 30)",
+		"filter(Name eq 'a/b(')/top(2)":                                          "filter(Name eq 'a/b(')/top(2)",
+		"compute(Age mul 2 as Double)/orderby(Double desc,Name)":                 "compute(Age mul 2 as Double)/orderby(Double desc,Name)",
+		"search(\"red bike\" OR blue)/skip(1)":                                   "search(\"red bike\" OR blue)/skip(1)",
+		"topcount(2,Age)/bottompercent(12.5, Age)":                               "topcount(2,Age)/bottompercent(12.5,Age)",
+		"expand(Orders,filter(Id ne 'x'),expand(Customer))":                      "expand(Orders,filter(Id ne 'x'),expand(Customer))",
+		"concat(identity, aggregate($count as Count))":                           "concat(identity,aggregate($count as Count))",
+		"aggregate(Age with Store.median as Median)":                             "aggregate(Age with Store.median as Median)",
+	}
+	for input, expected := range tests {
+		apply, err := ParseApplyString(input)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		if apply.String() != expected {
+			t.Error(input + ": expected " + expected + ", got " + apply.String())
+		}
+	}
+
+	apply, err := ParseApplyString("groupby((Tier),aggregate(Age with max as Oldest))/top(1)")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	groupby := apply.Transformations[0]
+	if groupby.Kind != ApplyGroupBy || groupby.GroupBy[0][0].Value != "Tier" {
+		t.Error("Expected a groupby by Tier")
+	}
+	aggregate := groupby.Apply.Transformations[0].Aggregates[0]
+	if aggregate.Method != "max" || aggregate.Alias != "Oldest" || aggregate.Expression.Token.Value != "Age" {
+		t.Error("Expected the maximum of Age as Oldest")
+	}
+	if apply.Transformations[1].Kind != ApplyTop || apply.Transformations[1].N != 1 {
+		t.Error("Expected top(1)")
+	}
+}
+
+func TestParseApplyErrors(t *testing.T) {
+	tests := map[string]string{
+		"":                                "position 0: Expected a transformation",
+		"filter(Age gt 1)/":               "position 17: Expected a transformation",
+		"pivot(Age)":                      "position 0: Unsupported transformation pivot",
+		"identity()":                      "position 0: Unsupported transformation identity",
+		"top":                             "position 0: Expected a transformation with arguments in parentheses",
+		"filter(Age gt 1":                 "position 6: Mismatched parenthesis, this one is never closed",
+		"filter(Age gt 1)x":               "position 16: Expected a slash",
+		"filter(Age gt)":                  "in filter",
+		"aggregate(Age with sum)":         "position 22: Expected as and an alias",
+		"aggregate(Age as Total)":         "position 13: Expected with and an aggregation method",
+		"aggregate(Age with median as M)": "position 19: Unsupported aggregation method median",
+		"aggregate(Age with sum as 1x)":   "position 26: Expected an alias",
+		"compute(Age add as X)":           "position 12: Missing operand for add",
+		"groupby(Name)":                   "position 8: Expected property paths in parentheses",
+		"groupby((rollup(Name)))":         "position 9: Expected a property path",
+		"groupby((Name),top(1),top(2))":   "position 22: Expected at most two arguments in groupby",
+		"top(-1)":                         "position 4: Expected a number in top",
+		"topcount(1)":                     "position 9: Expected a number and an expression in topcount",
+		"toppercent(101,Age)":             "position 11: Expected a number in toppercent",
+		"concat(identity)":                "position 15: Expected at least two sequences of transformations in concat",
+		"expand(Orders,top(1))":           "position 14: Expected a filter followed by expands in expand",
+		"filter(Name eq 'a)":              "position 15: Unterminated string",
+	}
+	for input, expected := range tests {
+		_, err := ParseApplyString(input)
+		if err == nil {
+			t.Error("Expected an error for " + input)
+			continue
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Error("Error for " + input + " does not contain '" + expected + "': " + err.Error())
+		}
+	}
+}
+
+func TestSemanticizeApply(t *testing.T) {
+	tests := map[string]string{
+		"aggregate(Age with sum as Total)/filter(Total gt 100)":                       "",
+		"groupby((Tier),aggregate(Age with average as Mean))/orderby(Mean desc,Tier)": "",
+		"groupby((Orders/Id))": "",
+		"compute(Age mul 2 as Double)/filter(Double gt 10)/expand(Orders)":                 "",
+		"concat(identity,aggregate($count as Count))/filter(Count gt 1)":                   "",
+		"topsum(100,Age)/search(red)/identity":                                             "",
+		"aggregate(Name with sum as Total)":                                                "Cannot apply sum to 'Name', it is of type Edm.String.",
+		"aggregate(Age with sum as Total)/filter(Age gt 1)":                                "No property found Age after aggregating",
+		"aggregate(Age with sum as Total)/expand(Orders)":                                  "Cannot expand Orders after aggregating.",
+		"aggregate(Age with min as Name)":                                                  "The alias Name of aggregate is already a property.",
+		"aggregate(Age with min as A,Age with max as A)":                                   "The alias A of aggregate is already a property.",
+		"groupby((Unknown))":                                                               "No property found Unknown on entity Customer",
+		"groupby((Orders))":                                                                "Cannot group by Orders, it is an entity.",
+		"groupby((Tier),aggregate(Age with sum as Total))/filter(Total gt 1 and Age gt 1)": "No property found Age after aggregating",
+		"filter(Age)":     "not a boolean expression",
+		"topsum(10,Name)": "Cannot apply topsum to 'Name'",
+		"expand(Unknown)": "has no navigational property Unknown",
+	}
+	for input, expected := range tests {
+		_, err := semanticizeApplyString("Customer", input)
+		if expected == "" {
+			if err != nil {
+				t.Error(input + ": " + err.Error())
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Error("Expected an error containing '" + expected + "' for " + input)
+		}
+	}
+
+	apply, err := semanticizeApplyString("Customer", "groupby((Tier),aggregate(Age with average as Mean))/filter(Mean gt 30)")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	mean := apply.Transformations[1].Filter.Tree.Children[0]
+	if mean.EdmType != GoDataDouble || mean.Token.SemanticType != SemanticTypePropertyValue {
+		t.Error("Expected Mean to be a value of type Edm.Double, got " + mean.EdmType)
+	}
+	if prop, ok := apply.Transformations[0].GroupBy[0][0].SemanticReference.(*GoDataProperty); !ok || prop.Name != "Tier" {
+		t.Error("Expected the grouping path to refer to the property Tier")
+	}
+}
+
+func TestSemanticizeApplyComplexPath(t *testing.T) {
+	service, err := BuildService(&thingsProvider{}, "http://localhost")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	thing, _ := service.LookupEntityType("Thing")
+	tests := map[string]string{
+		"groupby((Address/City),aggregate($count as C))": "",
+		"groupby((Datastreams/Thing/Address/Street))":    "",
+		"groupby((Address/Unknown))":                     "No property found Unknown on complex type Address",
+		"groupby((Address/City/Length))":                 "No property found Length in groupby",
+		"groupby((Datastreams/Thing))":                   "Cannot group by Datastreams/Thing, it is an entity.",
+	}
+	for input, expected := range tests {
+		apply, err := service.ParseApplyString(input)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		err = SemanticizeApplyQuery(apply, service, thing)
+		if expected == "" {
+			if err != nil {
+				t.Error(input + ": " + err.Error())
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Error("Expected an error containing '" + expected + "' for " + input)
+		}
+	}
+
+	apply, _ := service.ParseApplyString("groupby((Address/City))")
+	if err := SemanticizeApplyQuery(apply, service, thing); err != nil {
+		t.Error(err)
+		return
+	}
+	if prop, ok := apply.Transformations[0].GroupBy[0][1].SemanticReference.(*GoDataProperty); !ok || prop.Name != "City" {
+		t.Error("Expected the grouping path to refer to the property City")
+	}
+}
+
+func TestSemanticizeRequestApply(t *testing.T) {
+	service, err := BuildService(&DummyProvider{}, "http://localhost")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	query := url.Values{"$apply": {"aggregate(Name with sum as Total)"}}
+	req, err := service.ParseRequest("Customers", query)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := SemanticizeRequest(req, service); err == nil {
+		t.Error("Expected an error for the sum of a string property")
+	}
+	if req.Query.Values().Get("$apply") != "aggregate(Name with sum as Total)" {
+		t.Error("Expected the apply in the query values, got " + req.Query.Values().Get("$apply"))
+	}
+}
@@ -1,5 +1,11 @@
 package godata
 
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
 type GoDataError struct {
 	ResponseCode int
 	Message      string
@@ -36,3 +42,56 @@ func InternalServerError(message string) *GoDataError {
 func NotImplementedError(message string) *GoDataError {
 	return &GoDataError{501, message}
 }
+
+// A SyntaxError is returned by the tokenizers and parsers when the input
+// cannot be parsed. It records the byte offset in the input where the error
+// occurred. The parse functions of the query options convert it into a bad
+// request error that shows the option and the position.
+type SyntaxError struct {
+	Offset  int
+	Message string
+}
+
+func (err *SyntaxError) Error() string {
+	return err.Message + " at position " + strconv.Itoa(err.Offset)
+}
+
+// Convert an error from parsing the input of a query option into a bad
+// request error. For syntax errors the message names the option and the
+// offset, and shows an excerpt of the input with a caret below the position.
+func optionError(option, input string, err error) error {
+	syntaxErr, ok := err.(*SyntaxError)
+	if !ok {
+		return err
+	}
+	return BadRequestError("Invalid " + option + " at position " + strconv.Itoa(syntaxErr.Offset) +
+		": " + syntaxErr.Message + "\n" + excerpt(input, syntaxErr.Offset))
+}
+
+// The number of bytes of the input shown before and after the caret.
+const excerptContext = 30
+
+// Show the input around the offset with a caret on the next line.
+func excerpt(input string, offset int) string {
+	offset = max(0, min(offset, len(input)))
+	start := max(0, offset-excerptContext)
+	end := min(len(input), offset+excerptContext)
+	// don't split multi-byte characters
+	for start > 0 && !utf8.RuneStart(input[start]) {
+		start--
+	}
+	for end < len(input) && !utf8.RuneStart(input[end]) {
+		end++
+	}
+
+	prefix, suffix := "", ""
+	if start > 0 {
+		prefix = "..."
+	}
+	if end < len(input) {
+		suffix = "..."
+	}
+
+	column := len(prefix) + utf8.RuneCountInString(input[start:offset])
+	return prefix + input[start:end] + suffix + "\n" + strings.Repeat(" ", column) + "^"
+}
@@ -0,0 +1,71 @@
+package godata
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSyntaxErrorPosition(t *testing.T) {
+	type errorTest struct {
+		parse    func(string) error
+		input    string
+		option   string
+		position string
+	}
+	filter := func(s string) error { _, err := ParseFilterString(s); return err }
+	search := func(s string) error { _, err := ParseSearchString(s); return err }
+	orderby := func(s string) error { _, err := ParseOrderByString(s); return err }
+	sel := func(s string) error { _, err := ParseSelectString(s); return err }
+	expand := func(s string) error { _, err := ParseExpandString(s); return err }
+
+	tests := []errorTest{
+		{filter, "Name eq 'Bob' and ~Age gt 5", "$filter", "position 18"},
+		{filter, "(Name eq 'Bob'", "$filter", "position 0"},
+		{filter, "Name eq 'Bob')", "$filter", "position 13"},
+		{filter, "", "$filter", "position 0"},
+		{search, "", "$search", "position 0"},
+		{orderby, "Name asc,Age up", "$orderby", "position 13"},
+		{sel, "Name,,Age", "$select", "position 5"},
+		{expand, "Orders($filter=Id eq ~1)", "$expand", "position 21"},
+		{expand, "Orders($top=x)", "$expand", "position 12"},
+		{expand, "Orders(", "$expand", "position 6"},
+		{expand, "Orders)", "$expand", "position 6"},
+	}
+
+	for _, test := range tests {
+		err := test.parse(test.input)
+		if err == nil {
+			t.Error("Expected an error for '" + test.input + "'")
+			continue
+		}
+		if goDataErr, ok := err.(*GoDataError); !ok || goDataErr.ResponseCode != 400 {
+			t.Error("Expected a bad request for '" + test.input + "': " + err.Error())
+			continue
+		}
+		if !strings.Contains(err.Error(), "Invalid "+test.option+" at "+test.position) {
+			t.Error("Error for '" + test.input + "' does not report " + test.position + ": " + err.Error())
+		}
+	}
+}
+
+func TestSyntaxErrorExcerpt(t *testing.T) {
+	_, err := ParseFilterString("Name eq 'Bob' and ~Age gt 5")
+	if err == nil {
+		t.Error("Expected an error")
+		return
+	}
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) != 3 {
+		t.Error("Expected the message, the input and a caret: " + err.Error())
+		return
+	}
+	if lines[1] != "Name eq 'Bob' and ~Age gt 5" || lines[2] != strings.Repeat(" ", 18)+"^" {
+		t.Error("Caret does not point at the error:\n" + lines[1] + "\n" + lines[2])
+	}
+
+	long := strings.Repeat("Name eq 'Bob' and ", 5) + "~"
+	if actual := excerpt(long, len(long)-1); !strings.HasPrefix(actual, "...") ||
+		!strings.HasSuffix(actual, strings.Repeat(" ", 33)+"^") {
+		t.Error("Long input is not shortened around the position:\n" + actual)
+	}
+}
@@ -1,7 +1,9 @@
 package godata
 
 import (
+	"sort"
 	"strconv"
+	"strings"
 )
 
 const (
@@ -29,13 +31,21 @@ type ExpandItem struct {
 	OrderBy        *GoDataOrderByQuery
 	Skip           *GoDataSkipQuery
 	Top            *GoDataTopQuery
+	Count          *GoDataCountQuery
 	Select         *GoDataSelectQuery
 	Expand         *GoDataExpandQuery
 	IsGenerated    bool // set to true if expand was generated by an other expand such as Datastreams in Datastreams/Observations
-	HasOuterFilter bool // when there is a filter from outside the expand query itself, need to know this because it should result in different output
+	HasOuterFilter bool // set to true if the expand was moved into an expand with a filter, such as Observations in Datastreams($filter=...),Datastreams/Observations
 	Levels         int
+	// set for $levels=max and its repetitions, which stop at a cycle
+	untilCycle bool
 }
 
+// The value of ExpandItem.Levels for $levels=max, which expands up to the
+// MaxLevels limit of the service, but not into an entity type that was
+// already expanded through another one.
+const ExpandLevelsMax = -1
+
 func ExpandTokenizer() *Tokenizer {
 	t := Tokenizer{}
 	t.Add("^\\(", ExpandTokenOpenParen)
@@ -48,13 +58,23 @@ func ExpandTokenizer() *Tokenizer {
 	t.Add("^[0-9]{4,4}-[0-9]{2,2}-[0-9]{2,2}T[0-9]{2,2}:[0-9]{2,2}(:[0-9]{2,2}(.[0-9]+)?)?(Z|[+-][0-9]{2,2}:[0-9]{2,2})", ExpandTokenDateTime)
 	t.Add("^[0-9]{2,2}:[0-9]{2,2}(:[0-9]{2,2}(.[0-9]+)?)?", ExpandTokenTime)
 	t.Add("^-?[0-9]{4,4}-[0-9]{2,2}-[0-9]{2,2}", ExpandTokenDate)
-	t.Add("^[a-zA-Z0-9_\\'\\.:\\$ \\*]+", ExpandTokenLiteral)
+	t.Add("^[a-zA-Z0-9_\\'\\.:\\$ \\*@\\[\\]\"]+", ExpandTokenLiteral)
 
 	return &t
 }
 
 func ParseExpandString(expand string) (*GoDataExpandQuery, error) {
-	tokens, err := GlobalExpandTokenizer.Tokenize(expand)
+	result, err := parseExpandString(expand, nil)
+	if err != nil {
+		return nil, optionError("$expand", expand, err)
+	}
+	return result, nil
+}
+
+// Parse the expand clause. Filters in the expand options may use the custom
+// functions of the service, which may be nil.
+func parseExpandString(expand string, service *GoDataService) (*GoDataExpandQuery, error) {
+	tokens, err := GlobalExpandLexer.Tokenize(expand)
 	if err != nil {
 		return nil, err
 	}
@@ -72,12 +92,15 @@ func ParseExpandString(expand string) (*GoDataExpandQuery, error) {
 			queue.Enqueue(token)
 			stack.Push(token)
 		case ")":
+			if stack.Empty() {
+				return nil, &SyntaxError{token.Offset, "Mismatched parenthesis, no opening parenthesis for this one"}
+			}
 			queue.Enqueue(token)
 			stack.Pop()
 		case ",":
 			if stack.Empty() {
 				// no paren on the stack, parse this item and start a new queue
-				item, err := ParseExpandItem(queue)
+				item, err := parseExpandItem(queue, token.Offset, service)
 				if err != nil {
 					return nil, err
 				}
@@ -93,10 +116,10 @@ func ParseExpandString(expand string) (*GoDataExpandQuery, error) {
 	}
 
 	if !stack.Empty() {
-		return nil, BadRequestError("Mismatched parentheses in expand clause.")
+		return nil, &SyntaxError{stack.Peek().Offset, "Mismatched parenthesis, this one is never closed"}
 	}
 
-	item, err := ParseExpandItem(queue)
+	item, err := parseExpandItem(queue, len(expand), service)
 	if err != nil {
 		return nil, err
 	}
@@ -106,6 +129,16 @@ func ParseExpandString(expand string) (*GoDataExpandQuery, error) {
 }
 
 func ParseExpandItem(input tokenQueue) (*ExpandItem, error) {
+	end := 0
+	if input.Tail != nil {
+		end = input.Tail.Token.Offset + len(input.Tail.Token.Value)
+	}
+	return parseExpandItem(input, end, nil)
+}
+
+// Parse the tokens of a single expand item. The end is the offset just after
+// the item, used to report an item that is missing entirely.
+func parseExpandItem(input tokenQueue, end int, service *GoDataService) (*ExpandItem, error) {
 	item := &ExpandItem{}
 	item.Path = []*Token{}
 
@@ -120,6 +153,9 @@ func ParseExpandItem(input tokenQueue) (*ExpandItem, error) {
 				queue.Enqueue(token)
 			} else {
 				// top level slash means we're done parsing the path
+				if queue.Empty() {
+					return nil, &SyntaxError{token.Offset, "Expected a navigation property"}
+				}
 				item.Path = append(item.Path, queue.Dequeue())
 			}
 			stack.Push(token)
@@ -130,7 +166,7 @@ func ParseExpandItem(input tokenQueue) (*ExpandItem, error) {
 				queue.Enqueue(token)
 			} else {
 				// top level slash means we're done parsing the options
-				err := ParseExpandOption(queue, item)
+				err := parseExpandOption(queue, item, token.Offset, service)
 				if err != nil {
 					return nil, err
 				}
@@ -139,10 +175,13 @@ func ParseExpandItem(input tokenQueue) (*ExpandItem, error) {
 			}
 		} else if token.Value == "/" && stack.Empty() {
 			// at root level, slashes separate path segments
+			if queue.Empty() {
+				return nil, &SyntaxError{token.Offset, "Expected a navigation property"}
+			}
 			item.Path = append(item.Path, queue.Dequeue())
 		} else if token.Value == ";" && stack.Size == 1 {
 			// semicolons only split expand options at the first level
-			err := ParseExpandOption(queue, item)
+			err := parseExpandOption(queue, item, token.Offset, service)
 			if err != nil {
 				return nil, err
 			}
@@ -154,48 +193,80 @@ func ParseExpandItem(input tokenQueue) (*ExpandItem, error) {
 	}
 
 	if !stack.Empty() {
-		return nil, BadRequestError("Mismatched parentheses in expand clause.")
+		return nil, &SyntaxError{stack.Peek().Offset, "Mismatched parenthesis, this one is never closed"}
 	}
 
 	if !queue.Empty() {
 		item.Path = append(item.Path, queue.Dequeue())
 	}
 
+	if len(item.Path) == 0 {
+		return nil, &SyntaxError{end, "Expected a navigation property"}
+	}
+
 	return item, nil
 }
 
 func ParseExpandOption(queue *tokenQueue, item *ExpandItem) error {
-	head := queue.Dequeue().Value
-	if queue.Head == nil {
-		return BadRequestError("Invalid expand clause.")
+	end := 0
+	if queue.Tail != nil {
+		end = queue.Tail.Token.Offset + len(queue.Tail.Token.Value)
+	}
+	return parseExpandOption(queue, item, end, nil)
+}
+
+// Parse a single option of an expand item. The end is the offset of the
+// separator that closes the option. Errors in the nested options are reported
+// at their position in the whole expand clause.
+func parseExpandOption(queue *tokenQueue, item *ExpandItem, end int, service *GoDataService) error {
+	if queue.Empty() {
+		return &SyntaxError{end, "Expected an expand option"}
+	}
+	headToken := queue.Dequeue()
+	head := headToken.Value
+	if queue.Head == nil || queue.Head.Token.Value != "=" {
+		return &SyntaxError{headToken.Offset, "Invalid expand clause"}
 	}
 	queue.Dequeue() // drop the '=' from the front of the queue
+	offset := end
+	if queue.Head != nil {
+		offset = queue.Head.Token.Offset
+	}
 	body := queue.String()
 
+	// shift the position of an error in the option body to its position in
+	// the expand clause
+	nested := func(err error) error {
+		if syntaxErr, ok := err.(*SyntaxError); ok {
+			return &SyntaxError{offset + syntaxErr.Offset, syntaxErr.Message + " in " + head}
+		}
+		return err
+	}
+
 	if head == "$filter" {
-		filter, err := ParseFilterString(body)
+		filter, err := parseFilterString(body, service)
 		if err == nil {
 			item.Filter = filter
 		} else {
-			return err
+			return nested(err)
 		}
 	}
 
 	if head == "$search" {
-		search, err := ParseSearchString(body)
+		search, err := parseSearchString(body)
 		if err == nil {
 			item.Search = search
 		} else {
-			return err
+			return nested(err)
 		}
 	}
 
 	if head == "$orderby" {
-		orderby, err := ParseOrderByString(body)
+		orderby, err := parseOrderByString(body, service)
 		if err == nil {
 			item.OrderBy = orderby
 		} else {
-			return err
+			return nested(err)
 		}
 	}
 
@@ -204,7 +275,7 @@ func ParseExpandOption(queue *tokenQueue, item *ExpandItem) error {
 		if err == nil {
 			item.Skip = skip
 		} else {
-			return err
+			return &SyntaxError{offset, "Expected a number in $skip"}
 		}
 	}
 
@@ -213,32 +284,45 @@ func ParseExpandOption(queue *tokenQueue, item *ExpandItem) error {
 		if err == nil {
 			item.Top = top
 		} else {
-			return err
+			return &SyntaxError{offset, "Expected a number in $top"}
+		}
+	}
+
+	if head == "$count" {
+		count, err := ParseCountString(body)
+		if err == nil {
+			item.Count = count
+		} else {
+			return &SyntaxError{offset, "Expected true or false in $count"}
 		}
 	}
 
 	if head == "$select" {
-		sel, err := ParseSelectString(body)
+		sel, err := parseSelectString(body, service)
 		if err == nil {
 			item.Select = sel
 		} else {
-			return err
+			return nested(err)
 		}
 	}
 
 	if head == "$expand" {
-		expand, err := ParseExpandString(body)
+		expand, err := parseExpandString(body, service)
 		if err == nil {
 			item.Expand = expand
 		} else {
-			return err
+			return nested(err)
 		}
 	}
 
 	if head == "$levels" {
+		if body == "max" {
+			item.Levels = ExpandLevelsMax
+			return nil
+		}
 		i, err := strconv.Atoi(body)
-		if err != nil {
-			return err
+		if err != nil || i < 0 {
+			return &SyntaxError{offset, "Expected a number or max in $levels"}
 		}
 		item.Levels = i
 	}
@@ -246,97 +330,393 @@ func ParseExpandOption(queue *tokenQueue, item *ExpandItem) error {
 	return nil
 }
 
+// Resolve the expand against the entity type. The items are rewritten: a
+// wildcard becomes an item for each navigation property, $levels becomes a
+// nested item and paths through several navigation properties become nested
+// items as well.
 func SemanticizeExpandQuery(
 	expand *GoDataExpandQuery,
 	service *GoDataService,
 	entity *GoDataEntityType,
 ) error {
+	semantics := &expandSemantics{service: service, shared: map[string]*GoDataExpandQuery{}}
+	return semantics.semanticize(expand, entity)
+}
+
+// The state of the resolution of an expand tree.
+type expandSemantics struct {
+	service *GoDataService
+	// the entity types expanded on the way to the current expand, starting
+	// with the entity type of the request
+	path []*GoDataEntityType
+	// the resolved nested expands by their text and entity type
+	shared map[string]*GoDataExpandQuery
+}
+
+func (s *expandSemantics) semanticize(expand *GoDataExpandQuery, entity *GoDataEntityType) error {
 	if expand == nil {
 		return nil
 	}
-
-	// Replace $levels with a nested expand clause
-	for _, item := range expand.ExpandItems {
-		if item.Levels > 0 {
-			if item.Expand == nil {
-				item.Expand = &GoDataExpandQuery{[]*ExpandItem{}}
-			}
-			// Future recursive calls to SemanticizeExpandQuery() will build out
-			// this expand tree completely
-			item.Expand.ExpandItems = append(
-				item.Expand.ExpandItems,
-				&ExpandItem{
-					Path:   item.Path,
-					Levels: item.Levels - 1,
-				},
-			)
-			item.Levels = 0
-		}
-	}
+	s.path = append(s.path, entity)
+	defer func() {
+		s.path = s.path[:len(s.path)-1]
+	}()
 
 	// we're gonna rebuild the items list, replacing wildcards where possible
-	// TODO: can we save the garbage collector some heartache?
 	newItems := []*ExpandItem{}
-
 	for _, item := range expand.ExpandItems {
 		if item.Path[0].Value == "*" {
-			// replace wildcard with a copy of every navigation property
-			for _, navProp := range service.NavigationPropertyLookup[entity] {
+			// replace wildcard with an item for every navigation property,
+			// which share the nested expand that repeats the wildcard for
+			// $levels. The levels of other items are repeated once their
+			// path is resolved.
+			if err := s.repeatLevels(item); err != nil {
+				return err
+			}
+			for _, navProp := range s.service.NavigationPropertyLookup[entity] {
 				path := []*Token{{Value: navProp.Name, Type: ExpandTokenLiteral}}
 				newItem := &ExpandItem{
-					Path:   append(path, item.Path[1:]...),
-					Levels: item.Levels,
-					Expand: item.Expand,
+					Path:       append(path, item.Path[1:]...),
+					Levels:     item.Levels,
+					Expand:     item.Expand,
+					untilCycle: item.untilCycle,
 				}
 				newItems = append(newItems, newItem)
 			}
-			// TODO: check for duplicates?
 		} else {
 			newItems = append(newItems, item)
 		}
 	}
 
-	expand.ExpandItems = newItems
-
-	for _, item := range expand.ExpandItems {
-		err := semanticizeExpandItem(item, service, entity)
+	expand.ExpandItems = []*ExpandItem{}
+	for _, item := range newItems {
+		keep, err := s.semanticizeItem(item, entity)
 		if err != nil {
 			return err
 		}
+		if keep {
+			expand.ExpandItems = append(expand.ExpandItems, item)
+		}
 	}
+	expand.ExpandItems = mergeExpandItems(expand.ExpandItems)
 
 	return nil
 }
 
-func semanticizeExpandItem(
-	item *ExpandItem,
-	service *GoDataService,
-	entity *GoDataEntityType,
-) error {
-	// TODO: allow multiple path segments in expand clause
-	// TODO: handle $ref
-	if len(item.Path) > 1 {
-		return NotImplementedError("Multiple path segments not currently supported in expand clauses.")
+// Replace $levels with a nested expand clause that repeats the item with one
+// level less. Future recursive calls will build out this expand tree
+// completely.
+func (s *expandSemantics) repeatLevels(item *ExpandItem) error {
+	if err := s.service.limits().checkLevels(item.Levels); err != nil {
+		return err
 	}
+	if item.Levels == 0 {
+		return nil
+	}
+	if final := item.Path[len(item.Path)-1].Value; final == "$ref" || final == "$count" {
+		return BadRequestError("Cannot use $levels with '" + printPath(item.Path) + "'.")
+	}
+	next := &ExpandItem{Path: levelsPath(item.Path), Levels: item.Levels - 1}
+	if item.Levels == ExpandLevelsMax {
+		// max is bounded by the depth of the expand tree and by cycles,
+		// which only end the generated levels
+		next.Levels = ExpandLevelsMax
+		next.untilCycle = true
+		if len(s.path) >= s.service.limits().maxLevels() {
+			next = nil
+		}
+	}
+	if next != nil {
+		if item.Expand == nil {
+			item.Expand = &GoDataExpandQuery{[]*ExpandItem{}}
+		}
+		item.Expand.ExpandItems = append(item.Expand.ExpandItems, next)
+	}
+	item.Levels = 0
+	return nil
+}
 
-	navProps := service.NavigationPropertyLookup[entity]
-	target := item.Path[len(item.Path)-1]
-	if prop, ok := navProps[target.Value]; ok {
-		target.SemanticType = SemanticTypeEntity
-		entityType, err := service.LookupEntityType(prop.Type)
-		if err != nil {
-			return err
+// Resolve a nested expand against the entity type. Nested expands may be
+// shared by several items, e.g. the items of a wildcard, so each item gets a
+// copy, and the copies for the same entity type and text are shared. Where
+// $levels=max is repeated, the copy also depends on the depth and on the
+// entity types expanded on the way, which are part of the key. So the levels
+// of one repetition, e.g. Parent($levels=max), are separate copies, which
+// only end at a cycle or at the depth limit.
+func (s *expandSemantics) semanticizeNested(expand *GoDataExpandQuery, entity *GoDataEntityType) (*GoDataExpandQuery, error) {
+	if expand == nil {
+		return nil, nil
+	}
+	key := entity.Name + "|" + expand.String()
+	if repeatsLevelsMax(expand) {
+		expanded := map[string]bool{}
+		names := []string{}
+		for _, t := range s.path {
+			if !expanded[t.Name] {
+				expanded[t.Name] = true
+				names = append(names, t.Name)
+			}
 		}
-		target.SemanticReference = entityType
+		sort.Strings(names)
+		key += "|" + strconv.Itoa(len(s.path)) + "|" + strings.Join(names, ",") + "|" + untilCycleItems(expand)
+	}
+	if resolved, ok := s.shared[key]; ok {
+		return resolved, nil
+	}
 
-		SemanticizeFilterQuery(item.Filter, service, entityType)
-		SemanticizeExpandQuery(item.Expand, service, entityType)
-		SemanticizeSelectQuery(item.Select, service, entityType)
-		SemanticizeOrderByQuery(item.OrderBy, service, entityType)
+	resolved := expand.clone()
+	if err := s.semanticize(resolved, entity); err != nil {
+		return nil, err
+	}
+	s.shared[key] = resolved
+	return resolved, nil
+}
 
-	} else {
-		return BadRequestError("Entity type " + entity.Name + " has no navigational property " + target.Value)
+// Check whether an item of the expand or of its nested expands has
+// $levels=max.
+func repeatsLevelsMax(expand *GoDataExpandQuery) bool {
+	if expand == nil {
+		return false
 	}
+	for _, item := range expand.ExpandItems {
+		if item.Levels == ExpandLevelsMax || item.untilCycle || repeatsLevelsMax(item.Expand) {
+			return true
+		}
+	}
+	return false
+}
 
-	return nil
+// The items of the expand and of its nested expands that are generated
+// repetitions of $levels=max, which print like the requested items.
+func untilCycleItems(expand *GoDataExpandQuery) string {
+	if expand == nil {
+		return ""
+	}
+	result := ""
+	for _, item := range expand.ExpandItems {
+		if item.untilCycle {
+			result += "1"
+		} else {
+			result += "0"
+		}
+		result += "(" + untilCycleItems(item.Expand) + ")"
+	}
+	return result
+}
+
+// Check whether the entity type was expanded on the way to the current
+// expand.
+func (s *expandSemantics) expanded(entity *GoDataEntityType) bool {
+	for _, t := range s.path {
+		if t == entity {
+			return true
+		}
+	}
+	return false
+}
+
+// The part of the path that is expanded again at each level: the last
+// navigation property and the type casts following it.
+func levelsPath(path []*Token) []*Token {
+	i := len(path) - 1
+	for i > 0 && strings.Contains(path[i].Value, ".") {
+		i--
+	}
+	return path[i:]
+}
+
+// Resolve the path of the item, which consists of complex properties and type
+// casts up to a navigation property, optionally followed by a type cast and
+// $ref or $count. Further segments are expanded within the entities of the
+// navigation property, so the item is replaced by a generated item for the
+// navigation property that expands the rest of the path. Returns false if
+// the item is dropped because it repeats $levels=max through a cycle.
+func (s *expandSemantics) semanticizeItem(item *ExpandItem, entity *GoDataEntityType) (bool, error) {
+	service := s.service
+	t := service.entityStructuredType(entity)
+	if t == nil {
+		return false, BadRequestError("Entity type " + entity.Name + " is not defined in a schema.")
+	}
+	path := printPath(item.Path)
+	if item.untilCycle && service.structuredNavigationProperty(t, item.Path[0].Value) == nil {
+		// the repetition of $levels=max stops at an entity type without the
+		// navigation property
+		return false, nil
+	}
+
+	var navProp *GoDataNavigationProperty
+	var last *Token
+	for i, segment := range item.Path {
+		final := i == len(item.Path)-1
+		if navProp == nil {
+			switch {
+			case segment.Value == "$ref" || segment.Value == "$count":
+				return false, BadRequestError("Cannot expand '" + path + "', " + segment.Value + " must follow a navigation property.")
+			case service.structuredProperty(t, segment.Value) != nil:
+				prop := service.structuredProperty(t, segment.Value)
+				if t = service.lookupStructuredType(prop.Type); t == nil || t.entity != nil {
+					return false, BadRequestError("Cannot expand '" + path + "', " + prop.Name + " is not a navigation property.")
+				}
+				segment.SemanticType = SemanticTypeProperty
+				segment.SemanticReference = prop
+			case service.structuredNavigationProperty(t, segment.Value) != nil:
+				navProp = service.structuredNavigationProperty(t, segment.Value)
+				if t = service.lookupStructuredType(navProp.Type); t == nil || t.entity == nil {
+					return false, BadRequestError("Navigation property " + navProp.Name + " has the unknown entity type " + navProp.Type + ".")
+				}
+				segment.SemanticType = SemanticTypeEntity
+				segment.SemanticReference = t.entity
+			default:
+				cast := service.lookupStructuredType(segment.Value)
+				if cast == nil || !strings.Contains(segment.Value, ".") || final {
+					return false, BadRequestError("Entity type " + t.name() + " has no navigational property " + segment.Value)
+				}
+				if !service.isDerivedType(cast, t) {
+					return false, BadRequestError("Type " + segment.Value + " is not derived from " + t.name() + ".")
+				}
+				segment.SemanticType = SemanticTypeDerivedEntity
+				segment.SemanticReference = cast.reference()
+				t = cast
+			}
+			last = segment
+			continue
+		}
+
+		// a segment after the navigation property
+		if segment.Value == "$ref" || segment.Value == "$count" {
+			if !final {
+				return false, BadRequestError("Cannot expand '" + path + "', " + segment.Value + " must be the last segment.")
+			}
+			if _, isCollection := collectionElementType(navProp.Type); segment.Value == "$count" && !isCollection {
+				return false, BadRequestError("Cannot count '" + navProp.Name + "', it is not a collection.")
+			}
+			if segment.Value == "$ref" {
+				segment.SemanticType = SemanticTypeRef
+			} else {
+				segment.SemanticType = SemanticTypeCount
+			}
+			last = segment
+			break
+		}
+		if cast := service.lookupStructuredType(segment.Value); cast != nil && last.SemanticType == SemanticTypeEntity &&
+			strings.Contains(segment.Value, ".") {
+			if !service.isDerivedType(cast, t) {
+				return false, BadRequestError("Type " + segment.Value + " is not derived from " + t.name() + ".")
+			}
+			segment.SemanticType = SemanticTypeDerivedEntity
+			segment.SemanticReference = cast.reference()
+			t = cast
+			last = segment
+			continue
+		}
+		rest := &ExpandItem{
+			Path:    item.Path[i:],
+			Filter:  item.Filter,
+			Search:  item.Search,
+			OrderBy: item.OrderBy,
+			Skip:    item.Skip,
+			Top:     item.Top,
+			Count:   item.Count,
+			Select:  item.Select,
+			Expand:  item.Expand,
+			Levels:  item.Levels,
+		}
+		*item = ExpandItem{
+			Path:        item.Path[:i],
+			Expand:      &GoDataExpandQuery{[]*ExpandItem{rest}},
+			IsGenerated: true,
+		}
+		if err := s.semanticize(item.Expand, t.entity); err != nil {
+			return false, err
+		}
+		if len(item.Expand.ExpandItems) == 0 {
+			// the rest was dropped at a cycle
+			item.Expand = nil
+		}
+		return true, nil
+	}
+	if navProp == nil {
+		return false, BadRequestError("Cannot expand '" + path + "', it does not end with a navigation property.")
+	}
+	if err := s.repeatLevels(item); err != nil {
+		return false, err
+	}
+	if item.untilCycle && t.entity != entity && s.expanded(t.entity) {
+		// the navigation property leads back to an entity type expanded
+		// through another one, e.g. Thing in Things/Datastreams/Thing
+		return false, nil
+	}
+
+	switch last.SemanticType {
+	case SemanticTypeRef:
+		if item.Select != nil || item.Expand != nil {
+			return false, BadRequestError("Cannot use $select or $expand with '" + path + "'.")
+		}
+	case SemanticTypeCount:
+		if item.OrderBy != nil || item.Skip != nil || item.Top != nil || item.Count != nil ||
+			item.Select != nil || item.Expand != nil || item.Levels != 0 {
+			return false, BadRequestError("Only $filter and $search may be used with '" + path + "'.")
+		}
+	}
+	if _, isCollection := collectionElementType(navProp.Type); item.Count != nil && !isCollection {
+		return false, BadRequestError("Cannot count '" + navProp.Name + "', it is not a collection.")
+	}
+
+	if err := SemanticizeFilterQuery(item.Filter, service, t.entity); err != nil {
+		return false, err
+	}
+	OptimizeFilterQuery(item.Filter)
+	expand, err := s.semanticizeNested(item.Expand, t.entity)
+	if err != nil {
+		return false, err
+	}
+	if expand != nil && len(expand.ExpandItems) == 0 {
+		// all nested items were dropped at cycles
+		expand = nil
+	}
+	item.Expand = expand
+	if err := SemanticizeSelectQuery(item.Select, service, t.entity); err != nil {
+		return false, err
+	}
+	return true, SemanticizeOrderByQuery(item.OrderBy, service, t.entity)
+}
+
+// Merge the items generated for longer paths into the item with the same
+// path, e.g. Datastreams/Observations and Datastreams/Sensor into
+// Datastreams($expand=Observations,Sensor). The expansions moved into an item
+// with a filter are marked with HasOuterFilter.
+func mergeExpandItems(items []*ExpandItem) []*ExpandItem {
+	targets := map[string]*ExpandItem{}
+	for _, item := range items {
+		if _, ok := targets[printPath(item.Path)]; !ok && !item.IsGenerated {
+			targets[printPath(item.Path)] = item
+		}
+	}
+
+	result := []*ExpandItem{}
+	for _, item := range items {
+		target, ok := targets[printPath(item.Path)]
+		if !ok {
+			targets[printPath(item.Path)] = item
+		}
+		if !ok || !item.IsGenerated || target == item {
+			result = append(result, item)
+			continue
+		}
+		if item.Expand == nil {
+			// nothing is left to expand within the target
+			continue
+		}
+		// the expand of the target may be shared, so it is replaced
+		merged := &GoDataExpandQuery{[]*ExpandItem{}}
+		if target.Expand != nil {
+			merged.ExpandItems = append(merged.ExpandItems, target.Expand.ExpandItems...)
+		}
+		for _, nested := range item.Expand.ExpandItems {
+			nested.HasOuterFilter = nested.HasOuterFilter || target.Filter != nil
+			merged.ExpandItems = append(merged.ExpandItems, nested)
+		}
+		target.Expand = merged
+	}
+	return result
 }
@@ -1,6 +1,7 @@
 package godata
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -115,3 +116,204 @@ func TestExpandNestedParens(t *testing.T) {
 		return
 	}
 }
+
+func semanticizeExpand(entityType, input string) (*GoDataExpandQuery, error) {
+	service, err := BuildService(&thingsProvider{}, "http://localhost")
+	if err != nil {
+		return nil, err
+	}
+	entity, err := service.LookupEntityType(entityType)
+	if err != nil {
+		return nil, err
+	}
+	expand, err := ParseExpandString(input)
+	if err != nil {
+		return nil, err
+	}
+	return expand, SemanticizeExpandQuery(expand, service, entity)
+}
+
+func TestSemanticizeExpandPaths(t *testing.T) {
+	tests := map[string]string{
+		"Datastreams":                                "Datastreams",
+		"Datastreams/Observations($top=2)":           "Datastreams($expand=Observations($top=2))",
+		"Datastreams/$ref":                           "Datastreams/$ref",
+		"Datastreams/$count($filter=Id gt 1)":        "Datastreams/$count($filter=Id gt 1)",
+		"Datastreams($count=true)":                   "Datastreams($count=true)",
+		"Things.Sensor/Datastreams/Thing/$ref":       "Things.Sensor/Datastreams($expand=Thing/$ref)",
+		"Datastreams/Thing/Things.Sensor":            "Datastreams($expand=Thing/Things.Sensor)",
+		"Datastreams/Observations,Datastreams/Thing": "Datastreams($expand=Observations,Thing)",
+		"Datastreams($top=1),Datastreams/Thing":      "Datastreams($top=1;$expand=Thing)",
+	}
+	for input, expected := range tests {
+		expand, err := semanticizeExpand("Thing", input)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		if expand.String() != expected {
+			t.Error(input + ": expected " + expected + ", got " + expand.String())
+		}
+	}
+
+	expand, err := semanticizeExpand("Thing", "Datastreams($filter=Id eq 1),Datastreams/Observations")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(expand.ExpandItems) != 1 || expand.ExpandItems[0].IsGenerated {
+		t.Error("Expected the generated Datastreams to be merged into the explicit one")
+		return
+	}
+	nested := expand.ExpandItems[0].Expand.ExpandItems[0]
+	if !nested.HasOuterFilter || nested.Path[0].Value != "Observations" {
+		t.Error("Expected Observations to have an outer filter")
+	}
+
+	expand, err = semanticizeExpand("Thing", "Datastreams/Observations/$count")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	item := expand.ExpandItems[0]
+	if !item.IsGenerated || item.HasOuterFilter {
+		t.Error("Expected Datastreams to be generated without an outer filter")
+	}
+	count := item.Expand.ExpandItems[0].Path[1]
+	if count.SemanticType != SemanticTypeCount {
+		t.Error("Expected $count to have the semantic type count")
+	}
+	if entity, ok := item.Path[0].SemanticReference.(*GoDataEntityType); !ok || entity.Name != "Datastream" {
+		t.Error("Expected Datastreams to refer to the entity type Datastream")
+	}
+}
+
+func TestSemanticizeExpandPathErrors(t *testing.T) {
+	tests := map[string]string{
+		"Unknown":                        "Entity type Thing has no navigational property Unknown",
+		"Name":                           "Name is not a navigation property",
+		"$ref":                           "$ref must follow a navigation property",
+		"Datastreams/$ref/Thing":         "$ref must be the last segment",
+		"Datastreams/Thing/$count":       "Cannot count 'Thing', it is not a collection.",
+		"Datastreams/$ref($select=Id)":   "Cannot use $select or $expand with 'Datastreams/$ref'.",
+		"Datastreams/$count($top=1)":     "Only $filter and $search may be used",
+		"Datastreams/$ref($levels=2)":    "Cannot use $levels with 'Datastreams/$ref'.",
+		"Things.Datastream/Thing":        "Type Things.Datastream is not derived from Thing.",
+		"Datastreams/Observations/Other": "Entity type Observation has no navigational property Other",
+		"Datastreams($filter=Unknown)":   "Unknown",
+	}
+	for input, expected := range tests {
+		_, err := semanticizeExpand("Thing", input)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Error("Expected an error containing '" + expected + "' for " + input)
+		}
+	}
+}
+
+func TestExpandLevelsMax(t *testing.T) {
+	expand, err := ParseExpandString("Previous($levels=max)")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if expand.ExpandItems[0].Levels != ExpandLevelsMax || expand.String() != "Previous($levels=max)" {
+		t.Error("Expected $levels=max, got " + expand.String())
+	}
+	if _, err := ParseExpandString("Previous($levels=all)"); err == nil ||
+		!strings.Contains(err.Error(), "position 17: Expected a number or max in $levels") {
+		t.Error("Expected an error for $levels=all")
+	}
+
+	service, err := BuildService(&thingsProvider{}, "http://localhost")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	service.Limits = &QueryLimits{MaxLevels: 4}
+	thing, _ := service.LookupEntityType("Thing")
+	tests := map[string]string{
+		// Thing is not expanded again within Datastreams
+		"*($levels=max)": "Datastreams($expand=Observations($expand=Previous($expand=Previous)))",
+		"Datastreams/Observations/Previous($levels=max)":                   "Datastreams($expand=Observations($expand=Previous($expand=Previous)))",
+		"Datastreams($expand=Thing($levels=max))":                          "Datastreams($expand=Thing)",
+		"Datastreams($expand=Observations($expand=Previous($levels=max)))": "Datastreams($expand=Observations($expand=Previous($expand=Previous)))",
+		// Datastream has no Datastreams and Thing no Thing to repeat, but the
+		// requested level is kept
+		"Datastreams($levels=max;$filter=Id gt 1)":           "Datastreams($filter=Id gt 1)",
+		"Datastreams/Thing($levels=max)":                     "Datastreams($expand=Thing)",
+		"Datastreams($top=1),Datastreams/Thing($levels=max)": "Datastreams($top=1;$expand=Thing)",
+	}
+	for input, expected := range tests {
+		expand, err := ParseExpandString(input)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		if err := SemanticizeExpandQuery(expand, service, thing); err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		if expand.String() != expected {
+			t.Error(input + ": expected " + expected + ", got " + expand.String())
+		}
+	}
+
+	// the depth is also bounded by the expand depth limit
+	service.Limits = &QueryLimits{MaxLevels: 4, MaxExpandDepth: 2}
+	expand, _ = ParseExpandString("Datastreams/Observations/Previous($levels=max)")
+	if err := SemanticizeExpandQuery(expand, service, thing); err != nil {
+		t.Error(err)
+	} else if expand.String() != "Datastreams($expand=Observations($expand=Previous))" {
+		t.Error("Expected no repetition beyond the depth limit, got " + expand.String())
+	}
+}
+
+func TestExpandSharedSubtrees(t *testing.T) {
+	expand, err := semanticizeExpand("Thing", "Datastreams($expand=Observations),Datastreams($top=1;$expand=Observations)")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if expand.ExpandItems[0].Expand != expand.ExpandItems[1].Expand {
+		t.Error("Expected the nested expands of the same entity type to be shared")
+	}
+
+	// the same nested expand of the same entity type is shared at any depth
+	expand, err = semanticizeExpand("Thing",
+		"Datastreams($expand=Observations($expand=Previous),Thing($expand=Datastreams($expand=Observations($expand=Previous))))")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	outer := expand.ExpandItems[0].Expand.ExpandItems[0]
+	inner := expand.ExpandItems[0].Expand.ExpandItems[1].Expand.ExpandItems[0].Expand.ExpandItems[0]
+	if outer.Expand == nil || outer.Expand != inner.Expand {
+		t.Error("Expected the nested expands of Observations to be shared, got " + expand.String())
+	}
+
+	// the repetitions of $levels=max at the same depth are shared, the levels
+	// of one repetition are not
+	expand, err = semanticizeExpand("Thing",
+		"Datastreams($expand=Observations($expand=Previous($levels=max)),Observations($top=1;$expand=Previous($levels=max)))")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	first := expand.ExpandItems[0].Expand.ExpandItems[0].Expand
+	second := expand.ExpandItems[0].Expand.ExpandItems[1].Expand
+	if first == nil || first != second {
+		t.Error("Expected the repetitions of Previous to be shared, got " + expand.String())
+	} else if first.ExpandItems[0].Expand == nil || first.ExpandItems[0].Expand == first {
+		t.Error("Expected a separate copy for the next level of Previous, got " + expand.String())
+	}
+
+	expand, err = semanticizeExpand("Thing", "*($expand=*)")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if expand.String() != "Datastreams($expand=Thing,Observations)" &&
+		expand.String() != "Datastreams($expand=Observations,Thing)" {
+		t.Error("Expected the navigation properties of Datastream, got " + expand.String())
+	}
+}
@@ -0,0 +1,1164 @@
+package godata
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	minDateTime = time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC)
+	maxDateTime = time.Date(9999, 12, 31, 23, 59, 59, 999999999, time.UTC)
+)
+
+// A FilterEvaluator executes filter queries against Go values without a
+// database, e.g. to filter cached data or test fixtures with the semantics of
+// the HTTP layer.
+//
+// Values are either maps with string keys or structs. Struct fields are
+// matched by their `odata` tag, their `json` tag or their name, in that order.
+// Integers are compared as int64, floating point numbers as float64,
+// Edm.Date and Edm.DateTimeOffset values are time.Time, Edm.Duration values
+// are time.Duration and Edm.TimeOfDay values are TimeOfDay. Strings are
+// parsed as dates when compared to a date.
+type FilterEvaluator struct {
+	// Returns the current time for the now() function. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Check whether the value matches the filter, using a default evaluator.
+func EvaluateFilter(filter *GoDataFilterQuery, value interface{}) (bool, error) {
+	return (&FilterEvaluator{}).Evaluate(filter, value)
+}
+
+// Check whether the value matches the filter. An empty filter matches
+// everything. A filter that evaluates to null does not match.
+func (e *FilterEvaluator) Evaluate(filter *GoDataFilterQuery, value interface{}) (bool, error) {
+	expr, err := filter.Expression()
+	if err != nil {
+		return false, err
+	}
+	if expr == nil {
+		return true, nil
+	}
+	return e.EvaluateExpression(expr, value)
+}
+
+// Check whether the value matches the filter expression. Use this to avoid
+// building the expression of the same filter for many values.
+func (e *FilterEvaluator) EvaluateExpression(expr FilterExpression, value interface{}) (bool, error) {
+	eval := &filterEvaluation{e, value, map[string]interface{}{}}
+	result, err := expr.Accept(eval)
+	if err != nil {
+		return false, err
+	}
+	switch result := result.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return result, nil
+	default:
+		return false, BadRequestError("The filter does not evaluate to a boolean value.")
+	}
+}
+
+// Sort the values by the order by expressions, keeping the order of values
+// that are equal. As defined by OData, null sorts before all other values in
+// ascending order and after them in descending order.
+func (e *FilterEvaluator) SortOrderBy(orderby *GoDataOrderByQuery, values []interface{}) error {
+	if orderby == nil {
+		return nil
+	}
+	exprs := make([]FilterExpression, len(orderby.OrderByItems))
+	for i, item := range orderby.OrderByItems {
+		expr, err := item.Expression()
+		if err != nil {
+			return err
+		}
+		exprs[i] = expr
+	}
+
+	// the values of the expressions for each value
+	keys := make([][]interface{}, len(values))
+	for i, value := range values {
+		keys[i] = make([]interface{}, len(exprs))
+		for j, expr := range exprs {
+			key, err := expr.Accept(&filterEvaluation{e, value, map[string]interface{}{}})
+			if err != nil {
+				return err
+			}
+			keys[i][j] = normalizeValue(key)
+		}
+	}
+
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+	var err error
+	sort.SliceStable(order, func(i, j int) bool {
+		for k, item := range orderby.OrderByItems {
+			c, cerr := compareOrderByKeys(keys[order[i]][k], keys[order[j]][k])
+			if cerr != nil && err == nil {
+				err = cerr
+			}
+			if c != 0 {
+				return (c < 0) == (item.Order != DESC)
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+
+	sorted := make([]interface{}, len(values))
+	for i, index := range order {
+		sorted[i] = values[index]
+	}
+	copy(values, sorted)
+	return nil
+}
+
+// Compare two keys of an order by, where null is the smallest value.
+func compareOrderByKeys(a, b interface{}) (int, error) {
+	switch {
+	case a == nil && b == nil:
+		return 0, nil
+	case a == nil:
+		return -1, nil
+	case b == nil:
+		return 1, nil
+	}
+	return compareValues(a, b)
+}
+
+// The state of a single evaluation: the instance being filtered and the
+// lambda variables in scope.
+type filterEvaluation struct {
+	evaluator *FilterEvaluator
+	it        interface{}
+	vars      map[string]interface{}
+}
+
+func (ev *filterEvaluation) eval(expr FilterExpression) (interface{}, error) {
+	return expr.Accept(ev)
+}
+
+func (ev *filterEvaluation) VisitBinary(e *BinaryExpression) (interface{}, error) {
+	left, err := ev.eval(e.Left)
+	if err != nil {
+		return nil, err
+	}
+
+	// short circuit the logical operators, using three-valued logic for nulls
+	switch e.Operator {
+	case "and":
+		if left == false {
+			return false, nil
+		}
+	case "or":
+		if left == true {
+			return true, nil
+		}
+	}
+
+	right, err := ev.eval(e.Right)
+	if err != nil {
+		return nil, err
+	}
+	left, right = coerceEnum(left, right)
+
+	switch e.Operator {
+	case "and", "or":
+		return evaluateLogical(e.Operator, left, right)
+	case "eq":
+		return equalValues(left, right)
+	case "ne":
+		eq, err := equalValues(left, right)
+		return !eq, err
+	case "gt", "ge", "lt", "le":
+		if left == nil || right == nil {
+			return false, nil
+		}
+		c, err := compareValues(left, right)
+		if err != nil {
+			return nil, err
+		}
+		switch e.Operator {
+		case "gt":
+			return c > 0, nil
+		case "ge":
+			return c >= 0, nil
+		case "lt":
+			return c < 0, nil
+		default:
+			return c <= 0, nil
+		}
+	case "add", "sub", "mul", "div", "mod":
+		return evaluateArithmetic(e.Operator, left, right)
+	case "has":
+		return evaluateHas(left, right)
+	case "in":
+		return evaluateIn(left, right)
+	}
+
+	return nil, NotImplementedError("Operator " + e.Operator + " is not supported by the filter evaluator.")
+}
+
+func (ev *filterEvaluation) VisitUnary(e *UnaryExpression) (interface{}, error) {
+	operand, err := ev.eval(e.Operand)
+	if err != nil || operand == nil {
+		return nil, err
+	}
+
+	switch e.Operator {
+	case "not":
+		b, ok := operand.(bool)
+		if !ok {
+			return nil, BadRequestError("Operator not requires a boolean operand.")
+		}
+		return !b, nil
+	case "-":
+		switch v := operand.(type) {
+		case int64:
+			return -v, nil
+		case float64:
+			return -v, nil
+		case time.Duration:
+			return -v, nil
+		}
+		return nil, BadRequestError("Operator - requires a numeric operand.")
+	}
+
+	return nil, NotImplementedError("Operator " + e.Operator + " is not supported by the filter evaluator.")
+}
+
+func (ev *filterEvaluation) VisitFunctionCall(e *FunctionCallExpression) (interface{}, error) {
+	switch e.Name {
+	case "isof", "cast":
+		return ev.evaluateTypeFunction(e)
+	case "now":
+		if ev.evaluator.Now != nil {
+			return ev.evaluator.Now(), nil
+		}
+		return time.Now(), nil
+	}
+
+	args := make([]interface{}, len(e.Arguments))
+	for i, arg := range e.Arguments {
+		v, err := ev.eval(arg)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			// functions applied to null return null
+			return nil, nil
+		}
+		args[i] = v
+	}
+
+	return callFilterFunction(e.Name, args)
+}
+
+func (ev *filterEvaluation) VisitPropertyPath(e *PropertyPathExpression) (interface{}, error) {
+	current := ev.it
+	segments := e.Segments
+
+	switch e.Base.(type) {
+	case *RootExpression:
+		return nil, NotImplementedError("$root is not supported by the filter evaluator.")
+	case nil:
+		if v, ok := ev.vars[segments[0].Value]; ok {
+			// the path starts with a lambda variable
+			current = v
+			segments = segments[1:]
+		}
+	}
+
+	for _, segment := range segments {
+		if current == nil {
+			return nil, nil
+		}
+		v, err := propertyValue(current, segment.Value)
+		if err != nil {
+			return nil, err
+		}
+		current = v
+	}
+
+	return normalizeValue(current), nil
+}
+
+func (ev *filterEvaluation) VisitLiteral(e *LiteralExpression) (interface{}, error) {
+	v, err := e.Token.LiteralValue()
+	if err != nil {
+		return nil, err
+	}
+	switch v.(type) {
+	case *GoDataEnumValue:
+		// converted when the operand it is compared with is known
+		return v, nil
+	case *SpatialLiteral:
+		return v, nil
+	}
+	return normalizeValue(v), nil
+}
+
+func (ev *filterEvaluation) VisitList(e *ListExpression) (interface{}, error) {
+	items := make([]interface{}, len(e.Items))
+	for i, item := range e.Items {
+		v, err := ev.eval(item)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = v
+	}
+	return items, nil
+}
+
+func (ev *filterEvaluation) VisitLambda(e *LambdaExpression) (interface{}, error) {
+	coll, err := ev.eval(e.Collection)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []interface{}{}
+	if coll != nil {
+		rv := reflect.ValueOf(coll)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return nil, BadRequestError("The " + e.Operator + " operator must be applied to a collection.")
+		}
+		for i := 0; i < rv.Len(); i++ {
+			items = append(items, rv.Index(i).Interface())
+		}
+	}
+
+	if e.Predicate == nil {
+		return len(items) > 0, nil
+	}
+
+	vars := make(map[string]interface{}, len(ev.vars)+1)
+	for k, v := range ev.vars {
+		vars[k] = v
+	}
+	inner := &filterEvaluation{ev.evaluator, ev.it, vars}
+
+	for _, item := range items {
+		vars[e.Variable] = item
+		result, err := inner.eval(e.Predicate)
+		if err != nil {
+			return nil, err
+		}
+		if e.Operator == "any" && result == true {
+			return true, nil
+		}
+		if e.Operator == "all" && result != true {
+			return false, nil
+		}
+	}
+
+	return e.Operator == "all", nil
+}
+
+func (ev *filterEvaluation) VisitIt(e *ItExpression) (interface{}, error) {
+	return normalizeValue(ev.it), nil
+}
+
+func (ev *filterEvaluation) VisitThis(e *ThisExpression) (interface{}, error) {
+	return normalizeValue(ev.it), nil
+}
+
+func (ev *filterEvaluation) VisitRoot(e *RootExpression) (interface{}, error) {
+	return nil, NotImplementedError("$root is not supported by the filter evaluator.")
+}
+
+// Evaluate isof and cast, whose last argument is a type name. Without a
+// second argument, they apply to the current instance.
+func (ev *filterEvaluation) evaluateTypeFunction(e *FunctionCallExpression) (interface{}, error) {
+	if len(e.Arguments) == 0 || len(e.Arguments) > 2 {
+		return nil, BadRequestError("Function " + e.Name + " requires one or two arguments.")
+	}
+	typeName := e.Arguments[len(e.Arguments)-1].Node().Token.Value
+
+	value := normalizeValue(ev.it)
+	if len(e.Arguments) == 2 {
+		v, err := ev.eval(e.Arguments[0])
+		if err != nil {
+			return nil, err
+		}
+		value = v
+	}
+
+	if e.Name == "isof" {
+		return isOfEdmType(value, typeName), nil
+	}
+	return castToEdmType(value, typeName), nil
+}
+
+// Lookup a property of a map or struct.
+func propertyValue(value interface{}, name string) (interface{}, error) {
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		v := rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()))
+		if !v.IsValid() {
+			return nil, nil
+		}
+		return v.Interface(), nil
+	case reflect.Struct:
+		if f, ok := structField(rv.Type(), name); ok {
+			return rv.FieldByIndex(f.Index).Interface(), nil
+		}
+		return nil, nil
+	}
+
+	return nil, BadRequestError("Cannot read property " + name + " of a " + rv.Kind().String() + " value.")
+}
+
+// Find the field of a struct that represents the named property.
+func structField(t reflect.Type, name string) (reflect.StructField, bool) {
+	fields := reflect.VisibleFields(t)
+	for _, tag := range []string{"odata", "json"} {
+		for _, f := range fields {
+			if !f.IsExported() {
+				continue
+			}
+			if tagName, _, _ := strings.Cut(f.Tag.Get(tag), ","); tagName == name {
+				return f, true
+			}
+		}
+	}
+	for _, f := range fields {
+		if f.IsExported() && !f.Anonymous && f.Name == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// Convert a value to the representation used by the evaluator: int64 for
+// integers, float64 for floating point numbers and nil for nil pointers.
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool, string, int64, float64, time.Time, time.Duration, TimeOfDay:
+		return v
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case *big.Rat:
+		if v == nil {
+			return nil
+		}
+		f, _ := v.Float64()
+		return f
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		return normalizeValue(rv.Elem().Interface())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Slice, reflect.Map:
+		if rv.IsNil() {
+			return nil
+		}
+	}
+	return value
+}
+
+func evaluateLogical(op string, left, right interface{}) (interface{}, error) {
+	_, lok := left.(bool)
+	_, rok := right.(bool)
+	if (left != nil && !lok) || (right != nil && !rok) {
+		return nil, BadRequestError("Operator " + op + " requires boolean operands.")
+	}
+
+	if op == "and" {
+		if left == false || right == false {
+			return false, nil
+		}
+		if left == nil || right == nil {
+			return nil, nil
+		}
+		return true, nil
+	}
+
+	if left == true || right == true {
+		return true, nil
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	return false, nil
+}
+
+// Convert a string to a date if the other operand is a date, so values
+// decoded from JSON can be compared to date literals.
+func coerceTemporal(a, b interface{}) (interface{}, interface{}) {
+	if s, ok := a.(string); ok {
+		if _, isTime := b.(time.Time); isTime {
+			if t, ok := parseTemporal(s); ok {
+				return t, b
+			}
+		}
+		if _, isTime := b.(TimeOfDay); isTime {
+			if t, ok := parseTemporal(s); ok {
+				return t, b
+			}
+		}
+	}
+	if s, ok := b.(string); ok {
+		if _, isTime := a.(time.Time); isTime {
+			if t, ok := parseTemporal(s); ok {
+				return a, t
+			}
+		}
+		if _, isTime := a.(TimeOfDay); isTime {
+			if t, ok := parseTemporal(s); ok {
+				return a, t
+			}
+		}
+	}
+	return a, b
+}
+
+func equalValues(a, b interface{}) (bool, error) {
+	if a == nil || b == nil {
+		return a == nil && b == nil, nil
+	}
+	c, err := compareValues(a, b)
+	if err != nil {
+		// values without an order, e.g. complex values, are compared deeply
+		return reflect.DeepEqual(a, b), nil
+	}
+	return c == 0, nil
+}
+
+// Compare two non-null values, returning -1, 0 or 1.
+func compareValues(a, b interface{}) (int, error) {
+	a, b = coerceTemporal(a, b)
+
+	switch a := a.(type) {
+	case int64:
+		switch b := b.(type) {
+		case int64:
+			return compareOrdered(a, b), nil
+		case float64:
+			return compareOrdered(float64(a), b), nil
+		}
+	case float64:
+		switch b := b.(type) {
+		case int64:
+			return compareOrdered(a, float64(b)), nil
+		case float64:
+			return compareOrdered(a, b), nil
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), nil
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			switch {
+			case a == b:
+				return 0, nil
+			case b:
+				return -1, nil
+			default:
+				return 1, nil
+			}
+		}
+	case time.Time:
+		if b, ok := b.(time.Time); ok {
+			return a.Compare(b), nil
+		}
+	case time.Duration:
+		if b, ok := b.(time.Duration); ok {
+			return compareOrdered(a, b), nil
+		}
+	case TimeOfDay:
+		if b, ok := b.(TimeOfDay); ok {
+			return compareOrdered(a, b), nil
+		}
+	}
+
+	return 0, BadRequestError("Cannot compare values of type " + reflect.TypeOf(a).String() +
+		" and " + reflect.TypeOf(b).String() + ".")
+}
+
+func compareOrdered[T int64 | float64 | time.Duration | TimeOfDay](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func evaluateArithmetic(op string, left, right interface{}) (interface{}, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	left, right = coerceTemporal(left, right)
+
+	switch l := left.(type) {
+	case int64:
+		switch r := right.(type) {
+		case int64:
+			return integerArithmetic(op, l, r)
+		case float64:
+			return floatArithmetic(op, float64(l), r), nil
+		case time.Duration:
+			if op == "mul" {
+				return time.Duration(l) * r, nil
+			}
+		}
+	case float64:
+		switch r := right.(type) {
+		case int64:
+			return floatArithmetic(op, l, float64(r)), nil
+		case float64:
+			return floatArithmetic(op, l, r), nil
+		case time.Duration:
+			if op == "mul" {
+				return time.Duration(l * float64(r)), nil
+			}
+		}
+	case time.Time:
+		switch r := right.(type) {
+		case time.Duration:
+			switch op {
+			case "add":
+				return l.Add(r), nil
+			case "sub":
+				return l.Add(-r), nil
+			}
+		case time.Time:
+			if op == "sub" {
+				return l.Sub(r), nil
+			}
+		}
+	case time.Duration:
+		switch r := right.(type) {
+		case time.Duration:
+			switch op {
+			case "add":
+				return l + r, nil
+			case "sub":
+				return l - r, nil
+			}
+		case int64:
+			switch op {
+			case "mul":
+				return l * time.Duration(r), nil
+			case "div":
+				if r == 0 {
+					return nil, BadRequestError("Division by zero.")
+				}
+				return l / time.Duration(r), nil
+			}
+		case float64:
+			switch op {
+			case "mul":
+				return time.Duration(float64(l) * r), nil
+			case "div":
+				return time.Duration(float64(l) / r), nil
+			}
+		}
+	}
+
+	return nil, BadRequestError("Operator " + op + " cannot be applied to values of type " +
+		reflect.TypeOf(left).String() + " and " + reflect.TypeOf(right).String() + ".")
+}
+
+// Integer arithmetic, which fails instead of wrapping around on overflow.
+func integerArithmetic(op string, l, r int64) (interface{}, error) {
+	if (op == "div" || op == "mod") && r == 0 {
+		return nil, BadRequestError("Division by zero.")
+	}
+	var result int64
+	switch op {
+	case "add":
+		result = l + r
+		if (result > l) != (r > 0) {
+			return nil, BadRequestError("Integer overflow in add.")
+		}
+	case "sub":
+		result = l - r
+		if (result < l) != (r > 0) {
+			return nil, BadRequestError("Integer overflow in sub.")
+		}
+	case "mul":
+		result = l * r
+		if l != 0 && (result/l != r || (l == -1 && r == math.MinInt64)) {
+			return nil, BadRequestError("Integer overflow in mul.")
+		}
+	case "div":
+		if l == math.MinInt64 && r == -1 {
+			return nil, BadRequestError("Integer overflow in div.")
+		}
+		result = l / r
+	default:
+		result = l % r
+	}
+	return result, nil
+}
+
+func floatArithmetic(op string, l, r float64) float64 {
+	switch op {
+	case "add":
+		return l + r
+	case "sub":
+		return l - r
+	case "mul":
+		return l * r
+	case "div":
+		return l / r
+	default:
+		return math.Mod(l, r)
+	}
+}
+
+// Convert a resolved enumeration literal to the representation of the value
+// it is compared with, i.e. to an integer or to member names.
+func coerceEnum(a, b interface{}) (interface{}, interface{}) {
+	convert := func(v *GoDataEnumValue, other interface{}) interface{} {
+		if _, ok := other.(int64); ok {
+			return v.Value
+		}
+		return v.String()
+	}
+	if v, ok := a.(*GoDataEnumValue); ok {
+		a = convert(v, b)
+	}
+	if v, ok := b.(*GoDataEnumValue); ok {
+		b = convert(v, a)
+	}
+	return a, b
+}
+
+// Evaluate the has operator for flags given as integers or as comma
+// separated member names.
+func evaluateHas(left, right interface{}) (interface{}, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	switch l := left.(type) {
+	case int64:
+		if r, ok := right.(int64); ok {
+			return l&r == r, nil
+		}
+	case string:
+		if r, ok := right.(string); ok {
+			members := map[string]bool{}
+			for _, m := range strings.Split(l, ",") {
+				members[strings.TrimSpace(m)] = true
+			}
+			for _, m := range strings.Split(r, ",") {
+				if !members[strings.TrimSpace(m)] {
+					return false, nil
+				}
+			}
+			return true, nil
+		}
+	}
+	return nil, BadRequestError("Operator has requires enumeration operands.")
+}
+
+// Evaluate the in operator, which is true if the left operand equals one of
+// the items of the list or collection on the right.
+func evaluateIn(left, right interface{}) (interface{}, error) {
+	if right == nil {
+		return nil, nil
+	}
+	rv := reflect.ValueOf(right)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, BadRequestError("Operator in requires a list or a collection.")
+	}
+	for i := 0; i < rv.Len(); i++ {
+		l, item := coerceEnum(left, normalizeValue(rv.Index(i).Interface()))
+		eq, err := equalValues(l, item)
+		if err != nil || eq {
+			return eq, err
+		}
+	}
+	return false, nil
+}
+
+// Convert a value to a spatial value. Values that are not literals are
+// GeoJSON, given as decoded JSON, as JSON text or as a struct that encodes to
+// it, or WKT in a string. Both are taken as geographies.
+func spatialValue(value interface{}) (*SpatialLiteral, error) {
+	switch v := value.(type) {
+	case *SpatialLiteral:
+		return v, nil
+	case map[string]interface{}:
+		return geoJSONLiteral(v)
+	case string:
+		if strings.HasPrefix(strings.TrimSpace(v), "{") {
+			return ParseGeoJSON([]byte(v))
+		}
+		literal, err := parseSpatialLiteral(true, v)
+		if err != nil {
+			return nil, BadRequestError("Invalid spatial value '" + v + "': " + err.Error())
+		}
+		return literal, nil
+	case []byte:
+		return ParseGeoJSON(v)
+	case json.RawMessage:
+		return ParseGeoJSON(v)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, BadRequestError("Value is not a spatial value.")
+	}
+	literal, err := ParseGeoJSON(data)
+	if err != nil {
+		return nil, BadRequestError("Value is not a spatial value.")
+	}
+	return literal, nil
+}
+
+// Evaluate the geo.* and st_* functions with planar predicates. Distances and
+// lengths of geographies are measured along great circles in meters.
+func evaluateSpatialFunction(name string, args []interface{}) (interface{}, error) {
+	a, err := spatialValue(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if name == "geo.length" {
+		length := PlanarLength(a.Geometry)
+		if a.Geography {
+			length = GreatCircleLength(a.Geometry)
+		}
+		if math.IsNaN(length) {
+			return nil, nil
+		}
+		return length, nil
+	}
+
+	b, err := spatialValue(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if name == "geo.distance" {
+		distance := PlanarDistance(a.Geometry, b.Geometry)
+		if a.Geography && b.Geography {
+			distance = GreatCircleDistance(a.Geometry, b.Geometry)
+		}
+		if math.IsNaN(distance) {
+			return nil, nil
+		}
+		return distance, nil
+	}
+
+	m := Relate(a.Geometry, b.Geometry)
+	switch name {
+	case "geo.intersects", "st_intersects":
+		return m.Intersects(), nil
+	case "st_equals":
+		return m.Equals(), nil
+	case "st_disjoint":
+		return m.Disjoint(), nil
+	case "st_touches":
+		return m.Touches(), nil
+	case "st_within":
+		return m.Within(), nil
+	case "st_overlaps":
+		return m.Overlaps(), nil
+	case "st_crosses":
+		return m.Crosses(), nil
+	case "st_contains":
+		return m.Contains(), nil
+	}
+	pattern, ok := args[2].(string)
+	if !ok {
+		return nil, BadRequestError("Function st_relate requires a pattern string.")
+	}
+	return m.Matches(pattern)
+}
+
+// Call a function of the filter language with non-null arguments.
+func callFilterFunction(name string, args []interface{}) (interface{}, error) {
+	switch name {
+	case "contains", "endswith", "startswith", "indexof", "substringof", "concat":
+		a, aok := args[0].(string)
+		b, bok := args[1].(string)
+		if !aok || !bok {
+			break
+		}
+		switch name {
+		case "contains":
+			return strings.Contains(a, b), nil
+		case "endswith":
+			return strings.HasSuffix(a, b), nil
+		case "startswith":
+			return strings.HasPrefix(a, b), nil
+		case "substringof":
+			return strings.Contains(b, a), nil
+		case "concat":
+			return a + b, nil
+		default:
+			i := strings.Index(a, b)
+			if i < 0 {
+				return int64(-1), nil
+			}
+			return int64(utf8.RuneCountInString(a[:i])), nil
+		}
+	case "length", "tolower", "toupper", "trim":
+		s, ok := args[0].(string)
+		if !ok {
+			break
+		}
+		switch name {
+		case "length":
+			return int64(utf8.RuneCountInString(s)), nil
+		case "tolower":
+			return strings.ToLower(s), nil
+		case "toupper":
+			return strings.ToUpper(s), nil
+		default:
+			return strings.TrimSpace(s), nil
+		}
+	case "substring":
+		return evaluateSubstring(args)
+	case "year", "month", "day", "hour", "minute", "second", "fractionalseconds",
+		"date", "time", "totaloffsetminutes":
+		return evaluateDatePart(name, args[0])
+	case "maxdatetime":
+		return maxDateTime, nil
+	case "mindatetime":
+		return minDateTime, nil
+	case "totalseconds":
+		if d, ok := args[0].(time.Duration); ok {
+			return d.Seconds(), nil
+		}
+	case "geo.distance", "geo.intersects", "geo.length", "st_equals", "st_disjoint", "st_touches",
+		"st_within", "st_overlaps", "st_crosses", "st_intersects", "st_contains", "st_relate":
+		return evaluateSpatialFunction(name, args)
+	case "round", "floor", "ceiling":
+		switch v := args[0].(type) {
+		case int64:
+			return v, nil
+		case float64:
+			switch name {
+			case "round":
+				return math.Round(v), nil
+			case "floor":
+				return math.Floor(v), nil
+			default:
+				return math.Ceil(v), nil
+			}
+		}
+	default:
+		return nil, NotImplementedError("Function " + name + " is not supported by the filter evaluator.")
+	}
+
+	return nil, BadRequestError("Function " + name + " cannot be applied to the given arguments.")
+}
+
+func evaluateSubstring(args []interface{}) (interface{}, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, BadRequestError("Function substring requires two or three arguments.")
+	}
+	s, ok := args[0].(string)
+	start, sok := args[1].(int64)
+	if !ok || !sok {
+		return nil, BadRequestError("Function substring cannot be applied to the given arguments.")
+	}
+
+	runes := []rune(s)
+	start = max(0, min(start, int64(len(runes))))
+	end := int64(len(runes))
+	if len(args) == 3 {
+		length, ok := args[2].(int64)
+		if !ok {
+			return nil, BadRequestError("Function substring cannot be applied to the given arguments.")
+		}
+		end = max(start, min(start+length, end))
+	}
+	return string(runes[start:end]), nil
+}
+
+func evaluateDatePart(name string, arg interface{}) (interface{}, error) {
+	if s, ok := arg.(string); ok {
+		if v, ok := parseTemporal(s); ok {
+			arg = v
+		}
+	}
+
+	switch v := arg.(type) {
+	case time.Time:
+		switch name {
+		case "year":
+			return int64(v.Year()), nil
+		case "month":
+			return int64(v.Month()), nil
+		case "day":
+			return int64(v.Day()), nil
+		case "hour":
+			return int64(v.Hour()), nil
+		case "minute":
+			return int64(v.Minute()), nil
+		case "second":
+			return int64(v.Second()), nil
+		case "fractionalseconds":
+			return float64(v.Nanosecond()) / 1e9, nil
+		case "date":
+			return time.Date(v.Year(), v.Month(), v.Day(), 0, 0, 0, 0, time.UTC), nil
+		case "time":
+			midnight := time.Date(v.Year(), v.Month(), v.Day(), 0, 0, 0, 0, v.Location())
+			return TimeOfDay(v.Sub(midnight)), nil
+		case "totaloffsetminutes":
+			_, offset := v.Zone()
+			return int64(offset / 60), nil
+		}
+	case TimeOfDay:
+		d := time.Duration(v)
+		switch name {
+		case "hour":
+			return int64(d / time.Hour), nil
+		case "minute":
+			return int64(d % time.Hour / time.Minute), nil
+		case "second":
+			return int64(d % time.Minute / time.Second), nil
+		case "fractionalseconds":
+			return float64(d%time.Second) / 1e9, nil
+		}
+	}
+
+	return nil, BadRequestError("Function " + name + " cannot be applied to the given arguments.")
+}
+
+// Check whether a value is of the given primitive type.
+func isOfEdmType(value interface{}, typeName string) bool {
+	switch v := value.(type) {
+	case string:
+		return typeName == GoDataString
+	case bool:
+		return typeName == GoDataBoolean
+	case int64:
+		switch typeName {
+		case GoDataByte:
+			return v >= 0 && v <= math.MaxUint8
+		case GoDataSByte:
+			return v >= math.MinInt8 && v <= math.MaxInt8
+		case GoDataInt16:
+			return v >= math.MinInt16 && v <= math.MaxInt16
+		case GoDataInt32:
+			return v >= math.MinInt32 && v <= math.MaxInt32
+		}
+		return typeName == GoDataInt64 || typeName == GoDataDecimal ||
+			typeName == GoDataSingle || typeName == GoDataDouble
+	case float64:
+		return typeName == GoDataDecimal || typeName == GoDataSingle || typeName == GoDataDouble
+	case time.Time:
+		return typeName == GoDataDateTimeOffset || typeName == GoDataDate
+	case time.Duration:
+		return typeName == GoDataDuration
+	case TimeOfDay:
+		return typeName == GoDataTimeOfDay
+	case []byte:
+		return typeName == GoDataBinary
+	}
+	return false
+}
+
+// Cast a value to the given primitive type, returning null if the value
+// cannot be cast.
+func castToEdmType(value interface{}, typeName string) interface{} {
+	if value == nil || isOfEdmType(value, typeName) {
+		return value
+	}
+
+	switch typeName {
+	case GoDataString:
+		switch v := value.(type) {
+		case int64:
+			return strconv.FormatInt(v, 10)
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			return strconv.FormatBool(v)
+		case time.Time:
+			return v.Format(time.RFC3339Nano)
+		case TimeOfDay:
+			return v.String()
+		case time.Duration:
+			return formatDuration(v)
+		}
+	case GoDataByte, GoDataSByte, GoDataInt16, GoDataInt32, GoDataInt64:
+		var i int64
+		switch v := value.(type) {
+		case float64:
+			i = int64(v)
+		case string:
+			parsed, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil
+			}
+			i = parsed
+		default:
+			return nil
+		}
+		if isOfEdmType(i, typeName) {
+			return i
+		}
+	case GoDataDecimal, GoDataSingle, GoDataDouble:
+		if s, ok := value.(string); ok {
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				return f
+			}
+		}
+	case GoDataBoolean:
+		if s, ok := value.(string); ok {
+			if b, err := strconv.ParseBool(s); err == nil {
+				return b
+			}
+		}
+	case GoDataDateTimeOffset, GoDataDate:
+		if s, ok := value.(string); ok {
+			if t, ok := parseTemporal(s); ok {
+				if t, ok := t.(time.Time); ok {
+					return t
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package godata
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testEvaluatorTag struct {
+	Key   string
+	Value int `json:"value"`
+}
+
+type testEvaluatorProduct struct {
+	Name     string `odata:"Name"`
+	Price    float64
+	Released time.Time
+	Discount *float64
+	Tags     []testEvaluatorTag
+}
+
+func evaluateTestFilter(t *testing.T, input string, value interface{}) bool {
+	filter, err := ParseFilterString(input)
+	if err != nil {
+		t.Error(input + ": " + err.Error())
+		return false
+	}
+	evaluator := &FilterEvaluator{
+		Now: func() time.Time { return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC) },
+	}
+	result, err := evaluator.Evaluate(filter, value)
+	if err != nil {
+		t.Error(input + ": " + err.Error())
+		return false
+	}
+	return result
+}
+
+func TestEvaluateStruct(t *testing.T) {
+	product := &testEvaluatorProduct{
+		Name:     "Milk",
+		Price:    2.5,
+		Released: time.Date(2015, 10, 14, 23, 30, 0, 0, time.UTC),
+		Tags: []testEvaluatorTag{
+			{Key: "Site", Value: 3},
+			{Key: "Shelf", Value: 12},
+		},
+	}
+
+	tests := map[string]bool{
+		"Name eq 'Milk' and Price lt 2.55":                          true,
+		"Name eq 'Milk' and Price gt 2.55":                          false,
+		"not endswith(Name,'ilk')":                                  false,
+		"tolower(Name) eq 'milk' or Price eq 0":                     true,
+		"Price mul 2 eq 5":                                          true,
+		"length(concat(Name,'shake')) eq 9":                         true,
+		"substring(Name,1) eq 'ilk'":                                true,
+		"indexof(Name,'lk') eq 2":                                   true,
+		"year(Released) eq 2015 and month(Released) ge 10":          true,
+		"Released lt 2015-10-15":                                    true,
+		"Released lt now()":                                         true,
+		"Discount eq null":                                          true,
+		"Discount gt 1":                                             false,
+		"not (Discount gt 1)":                                       true,
+		"Tags/any(d:d/Key eq 'Site' and d/value lt 10)":             true,
+		"Tags/all(d:d/value lt 10)":                                 false,
+		"Tags/any(d:d/Key eq 'Site' and $it/Price gt 2)":            true,
+		"round(Price) eq 3 and floor(Price) eq 2":                   true,
+		"isof(Name,Edm.String) and cast(Price,Edm.String) eq '2.5'": true,
+	}
+
+	for input, expected := range tests {
+		if evaluateTestFilter(t, input, product) != expected {
+			t.Errorf("%s: expected %v", input, expected)
+		}
+	}
+}
+
+func TestEvaluateJsonPayload(t *testing.T) {
+	payload := `{
+		"result": 21.5,
+		"phenomenonTime": "2020-06-01T10:00:00Z",
+		"parameters": {"unit": "degC"},
+		"tags": ["indoor", "kitchen"]
+	}`
+	decoder := json.NewDecoder(strings.NewReader(payload))
+	decoder.UseNumber()
+	var value map[string]interface{}
+	if err := decoder.Decode(&value); err != nil {
+		t.Error(err)
+		return
+	}
+
+	tests := map[string]bool{
+		"result gt 20 and result le 21.5":          true,
+		"phenomenonTime ge 2020-06-01T00:00:00Z":   true,
+		"hour(phenomenonTime) eq 10":               true,
+		"parameters/unit eq 'degC'":                true,
+		"tags/any(t:t eq 'kitchen')":               true,
+		"tags/all(t:startswith(t,'in'))":           false,
+		"missing eq null and not (missing eq 'x')": true,
+	}
+
+	for input, expected := range tests {
+		if evaluateTestFilter(t, input, value) != expected {
+			t.Errorf("%s: expected %v", input, expected)
+		}
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	inputs := []string{
+		"Name div 0 eq 1",
+		"Name add 9223372036854775807 eq 1",
+		"Name mul 9223372036854775807 mul 2 eq 1",
+		"st_within(Name,geography'POINT(1 2)')",
+	}
+
+	for _, input := range inputs {
+		filter, err := ParseFilterString(input)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		_, err = EvaluateFilter(filter, map[string]interface{}{"Name": 1})
+		if err == nil {
+			t.Error("Expected an error for " + input)
+		}
+	}
+}
+
+func TestEvaluateEnum(t *testing.T) {
+	customer := map[string]interface{}{"Name": "Bob", "Channels": 3, "Tier": "Gold"}
+
+	tests := map[string]bool{
+		"Channels has Store.Channels'Phone'":      true,
+		"Channels has Store.Channels'Email,Post'": false,
+		"Tier eq Store.Tier'Gold'":                true,
+		"not (Tier eq Store.Tier'Silver')":        true,
+		"Channels eq Store.Channels'Email,Phone'": true,
+	}
+	for input, expected := range tests {
+		filter, err := semanticizeCustomerFilter(input)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		result, err := EvaluateFilter(filter, customer)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		if result != expected {
+			t.Errorf("%s: expected %v", input, expected)
+		}
+	}
+
+	// without semantic analysis enum values are compared by member names
+	if !evaluateTestFilter(t, "Channels has Store.Channels'Phone'", map[string]interface{}{"Channels": "Email,Phone"}) {
+		t.Error("Expected Email,Phone to have Phone")
+	}
+}
+
+func TestEvaluateSpatial(t *testing.T) {
+	var location map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"name": "Dortmund",
+		"location": {"type": "Point", "coordinates": [7.47, 51.51]},
+		"feature": {"type": "Feature", "geometry": {"type": "LineString", "coordinates": [[7, 51], [8, 51]]}}
+	}`), &location)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	tests := map[string]bool{
+		"st_within(location,geography'POLYGON((7 51,8 51,8 52,7 52,7 51))')":      true,
+		"st_within(location,geography'POLYGON((0 0,1 0,1 1,0 1,0 0))')":           false,
+		"geo.intersects(location,geography'POLYGON((7 51,8 51,8 52,7 52,7 51))')": true,
+		"st_disjoint(location,geography'POINT(7 51)')":                            true,
+		"geo.distance(location,geography'POINT(7.47 51.51)') eq 0":                true,
+		"geo.distance(location,geography'POINT(7.47 52.51)') lt 112000":           true,
+		"geo.distance(location,geography'POINT(7.47 52.51)') gt 110000":           true,
+		"geo.distance(geometry'POINT(0 0)',geometry'POINT(3 4)') eq 5":            true,
+		"geo.length(feature) gt 69000 and geo.length(feature) lt 70500":           true,
+		"st_crosses(feature,geography'LINESTRING(7.5 50,7.5 52)')":                true,
+		"st_relate(location,geography'POINT(7.47 51.51)','0FFFFFFF2')":            true,
+		"geo.length(location) eq null":                                            true,
+	}
+	for input, expected := range tests {
+		if evaluateTestFilter(t, input, location) != expected {
+			t.Errorf("%s: expected %v", input, expected)
+		}
+	}
+}
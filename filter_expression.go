@@ -0,0 +1,272 @@
+package godata
+
+// A typed view of a node in a $filter parse tree. Expressions are built from
+// the output of ParseFilterString, so providers can translate a filter by
+// implementing a FilterVisitor instead of switching on raw token values.
+type FilterExpression interface {
+	// Call the method of the visitor that matches the type of the expression.
+	Accept(visitor FilterVisitor) (interface{}, error)
+	// The node in the parse tree this expression was built from. Semantic
+	// information is stored on the token of this node.
+	Node() *ParseNode
+}
+
+// A FilterVisitor is implemented by anything that translates or evaluates a
+// filter expression, e.g. to produce a SQL WHERE clause.
+type FilterVisitor interface {
+	VisitBinary(*BinaryExpression) (interface{}, error)
+	VisitUnary(*UnaryExpression) (interface{}, error)
+	VisitFunctionCall(*FunctionCallExpression) (interface{}, error)
+	VisitPropertyPath(*PropertyPathExpression) (interface{}, error)
+	VisitLiteral(*LiteralExpression) (interface{}, error)
+	VisitList(*ListExpression) (interface{}, error)
+	VisitLambda(*LambdaExpression) (interface{}, error)
+	VisitIt(*ItExpression) (interface{}, error)
+	VisitRoot(*RootExpression) (interface{}, error)
+	VisitThis(*ThisExpression) (interface{}, error)
+}
+
+type expressionNode struct {
+	node *ParseNode
+}
+
+func (e *expressionNode) Node() *ParseNode {
+	return e.node
+}
+
+// An operator applied to two operands, e.g. "Price lt 2.55" or "A and B".
+type BinaryExpression struct {
+	expressionNode
+	Operator string
+	Left     FilterExpression
+	Right    FilterExpression
+}
+
+func (e *BinaryExpression) Accept(visitor FilterVisitor) (interface{}, error) {
+	return visitor.VisitBinary(e)
+}
+
+// An operator applied to a single operand, e.g. "not A".
+type UnaryExpression struct {
+	expressionNode
+	Operator string
+	Operand  FilterExpression
+}
+
+func (e *UnaryExpression) Accept(visitor FilterVisitor) (interface{}, error) {
+	return visitor.VisitUnary(e)
+}
+
+// A call of one of the functions of the filter language, e.g.
+// "contains(Name,'ilk')".
+type FunctionCallExpression struct {
+	expressionNode
+	Name      string
+	Arguments []FilterExpression
+}
+
+func (e *FunctionCallExpression) Accept(visitor FilterVisitor) (interface{}, error) {
+	return visitor.VisitFunctionCall(e)
+}
+
+// A path to a property, e.g. "Name" or "Address/City". If the path starts
+// with $it or $root, Base holds the reference, otherwise it is nil and the
+// path is relative to the entity being filtered (or a lambda variable, in
+// which case the first segment is the variable name).
+type PropertyPathExpression struct {
+	expressionNode
+	Base     FilterExpression
+	Segments []*Token
+}
+
+func (e *PropertyPathExpression) Accept(visitor FilterVisitor) (interface{}, error) {
+	return visitor.VisitPropertyPath(e)
+}
+
+// A literal value, e.g. a string, number, date or null. The type of the
+// literal is given by the type of the token.
+type LiteralExpression struct {
+	expressionNode
+	Token *Token
+}
+
+func (e *LiteralExpression) Accept(visitor FilterVisitor) (interface{}, error) {
+	return visitor.VisitLiteral(e)
+}
+
+// A list of values, the right operand of the in operator, e.g. "(1,2,3)" in
+// "Id in (1,2,3)". JSON arrays are lists as well. Providers can translate a
+// binary in expression with a list to SQL IN.
+type ListExpression struct {
+	expressionNode
+	Items []FilterExpression
+}
+
+func (e *ListExpression) Accept(visitor FilterVisitor) (interface{}, error) {
+	return visitor.VisitList(e)
+}
+
+// An any or all operator applied to a collection, e.g.
+// "Tags/any(d:d/Key eq 'Site')". Variable and Predicate are empty for the
+// parameterless form "Tags/any()".
+type LambdaExpression struct {
+	expressionNode
+	Operator   string
+	Collection FilterExpression
+	Variable   string
+	Predicate  FilterExpression
+}
+
+func (e *LambdaExpression) Accept(visitor FilterVisitor) (interface{}, error) {
+	return visitor.VisitLambda(e)
+}
+
+// A reference to the current instance of the collection being filtered.
+type ItExpression struct {
+	expressionNode
+}
+
+func (e *ItExpression) Accept(visitor FilterVisitor) (interface{}, error) {
+	return visitor.VisitIt(e)
+}
+
+// A reference to the root of the service, used to address other entities.
+type RootExpression struct {
+	expressionNode
+}
+
+func (e *RootExpression) Accept(visitor FilterVisitor) (interface{}, error) {
+	return visitor.VisitRoot(e)
+}
+
+// A reference to the current element of a collection in the nested options
+// of $select and $expand, or to the current instance like $it.
+type ThisExpression struct {
+	expressionNode
+}
+
+func (e *ThisExpression) Accept(visitor FilterVisitor) (interface{}, error) {
+	return visitor.VisitThis(e)
+}
+
+// Build the typed expression for the filter tree.
+func (filter *GoDataFilterQuery) Expression() (FilterExpression, error) {
+	if filter == nil || filter.Tree == nil {
+		return nil, nil
+	}
+	return BuildFilterExpression(filter.Tree)
+}
+
+// Convert a node of a parse tree produced by ParseFilterString into a typed
+// expression.
+func BuildFilterExpression(node *ParseNode) (FilterExpression, error) {
+	base := expressionNode{node}
+
+	switch node.Token.Type {
+	case FilterTokenNav:
+		if len(node.Children) != 2 {
+			return nil, BadRequestError("Path operator requires two operands.")
+		}
+		if node.Children[1].Token.Type == FilterTokenLambda {
+			return buildLambdaExpression(node.Children[1], node.Children[0])
+		}
+		left, err := BuildFilterExpression(node.Children[0])
+		if err != nil {
+			return nil, err
+		}
+		right := node.Children[1]
+		if right.Token.Type != FilterTokenLiteral || len(right.Children) > 0 {
+			return nil, BadRequestError("Invalid path segment " + right.Token.Value)
+		}
+		switch left := left.(type) {
+		case *PropertyPathExpression:
+			segments := append(append([]*Token{}, left.Segments...), right.Token)
+			return &PropertyPathExpression{base, left.Base, segments}, nil
+		case *ItExpression, *RootExpression, *ThisExpression:
+			return &PropertyPathExpression{base, left, []*Token{right.Token}}, nil
+		default:
+			return nil, BadRequestError("Invalid path before segment " + right.Token.Value)
+		}
+	case FilterTokenLiteral:
+		return &PropertyPathExpression{base, nil, []*Token{node.Token}}, nil
+	case FilterTokenIt:
+		return &ItExpression{base}, nil
+	case FilterTokenRoot:
+		return &RootExpression{base}, nil
+	case FilterTokenThis:
+		return &ThisExpression{base}, nil
+	case FilterTokenLambda:
+		return nil, BadRequestError("The " + node.Token.Value + " operator must be applied to a collection.")
+	case FilterTokenColon:
+		return nil, BadRequestError("A lambda variable must be declared inside an any or all operator.")
+	case FilterTokenFunc:
+		args, err := buildFilterExpressions(node.Children)
+		if err != nil {
+			return nil, err
+		}
+		return &FunctionCallExpression{base, node.Token.Value, args}, nil
+	case FilterTokenList:
+		items, err := buildFilterExpressions(node.Children)
+		if err != nil {
+			return nil, err
+		}
+		return &ListExpression{base, items}, nil
+	case FilterTokenLogical, FilterTokenOp:
+		operands, err := buildFilterExpressions(node.Children)
+		if err != nil {
+			return nil, err
+		}
+		switch len(operands) {
+		case 1:
+			return &UnaryExpression{base, node.Token.Value, operands[0]}, nil
+		case 2:
+			return &BinaryExpression{base, node.Token.Value, operands[0], operands[1]}, nil
+		default:
+			return nil, BadRequestError("Wrong number of operands for operator " + node.Token.Value)
+		}
+	default:
+		return &LiteralExpression{base, node.Token}, nil
+	}
+}
+
+func buildFilterExpressions(nodes []*ParseNode) ([]FilterExpression, error) {
+	result := make([]FilterExpression, 0, len(nodes))
+	for _, node := range nodes {
+		expr, err := BuildFilterExpression(node)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, expr)
+	}
+	return result, nil
+}
+
+func buildLambdaExpression(node, collection *ParseNode) (FilterExpression, error) {
+	coll, err := BuildFilterExpression(collection)
+	if err != nil {
+		return nil, err
+	}
+	result := &LambdaExpression{
+		expressionNode: expressionNode{node},
+		Operator:       node.Token.Value,
+		Collection:     coll,
+	}
+
+	if len(node.Children) == 0 {
+		// any() without a predicate
+		return result, nil
+	}
+
+	colon := node.Children[0]
+	if colon.Token.Type != FilterTokenColon || len(colon.Children) != 2 ||
+		colon.Children[0].Token.Type != FilterTokenLiteral {
+		return nil, BadRequestError("The " + node.Token.Value + " operator requires a lambda variable and a predicate.")
+	}
+	result.Variable = colon.Children[0].Token.Value
+	result.Predicate, err = BuildFilterExpression(colon.Children[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,206 @@
+package godata
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilterExpressionBinary(t *testing.T) {
+	filter, err := ParseFilterString("Name eq 'Milk' and Price lt 2.55")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expr, err := filter.Expression()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	and, ok := expr.(*BinaryExpression)
+	if !ok || and.Operator != "and" {
+		t.Error("Root expression is not an 'and' binary expression")
+		return
+	}
+	eq, ok := and.Left.(*BinaryExpression)
+	if !ok || eq.Operator != "eq" {
+		t.Error("Left operand is not an 'eq' binary expression")
+		return
+	}
+	path, ok := eq.Left.(*PropertyPathExpression)
+	if !ok || len(path.Segments) != 1 || path.Segments[0].Value != "Name" {
+		t.Error("Left operand of 'eq' is not the property path Name")
+		return
+	}
+	lit, ok := eq.Right.(*LiteralExpression)
+	if !ok || lit.Token.Type != FilterTokenString {
+		t.Error("Right operand of 'eq' is not a string literal")
+		return
+	}
+}
+
+func TestFilterExpressionPathAndFunction(t *testing.T) {
+	filter, err := ParseFilterString("not contains(Address/City,'Red')")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expr, err := filter.Expression()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	not, ok := expr.(*UnaryExpression)
+	if !ok || not.Operator != "not" {
+		t.Error("Root expression is not a 'not' unary expression")
+		return
+	}
+	call, ok := not.Operand.(*FunctionCallExpression)
+	if !ok || call.Name != "contains" || len(call.Arguments) != 2 {
+		t.Error("Operand of 'not' is not a call of contains with two arguments")
+		return
+	}
+	path, ok := call.Arguments[0].(*PropertyPathExpression)
+	if !ok || len(path.Segments) != 2 {
+		t.Error("First argument of contains is not a two segment path")
+		return
+	}
+	if path.Segments[0].Value != "Address" || path.Segments[1].Value != "City" {
+		t.Error("Path segments are not Address/City")
+		return
+	}
+}
+
+func TestFilterExpressionLambda(t *testing.T) {
+	filter, err := ParseFilterString("Tags/any(d:d/Key eq 'Site' and $it/Name ne null)")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expr, err := filter.Expression()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	lambda, ok := expr.(*LambdaExpression)
+	if !ok {
+		t.Error("Root expression is not a lambda expression")
+		return
+	}
+	if lambda.Operator != "any" || lambda.Variable != "d" {
+		t.Error("Lambda is '" + lambda.Operator + "' with variable '" + lambda.Variable + "'")
+		return
+	}
+	coll, ok := lambda.Collection.(*PropertyPathExpression)
+	if !ok || coll.Segments[0].Value != "Tags" {
+		t.Error("Lambda collection is not Tags")
+		return
+	}
+	and, ok := lambda.Predicate.(*BinaryExpression)
+	if !ok || and.Operator != "and" {
+		t.Error("Lambda predicate is not an 'and' expression")
+		return
+	}
+	ne, ok := and.Right.(*BinaryExpression)
+	if !ok || ne.Operator != "ne" {
+		t.Fatalf("Right operand of 'and' is not a 'ne' expression: %T", and.Right)
+	}
+	it, ok := ne.Left.(*PropertyPathExpression)
+	if !ok {
+		t.Error("Left operand of 'ne' is not a path")
+		return
+	}
+	if _, ok := it.Base.(*ItExpression); !ok {
+		t.Error("Path does not start with $it")
+		return
+	}
+}
+
+// A visitor that prints expressions in prefix notation.
+type prefixVisitor struct{}
+
+func (v *prefixVisitor) visitAll(name string, exprs ...FilterExpression) (interface{}, error) {
+	parts := []string{name}
+	for _, expr := range exprs {
+		s, err := expr.Accept(v)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, s.(string))
+	}
+	return "(" + strings.Join(parts, " ") + ")", nil
+}
+
+func (v *prefixVisitor) VisitBinary(e *BinaryExpression) (interface{}, error) {
+	return v.visitAll(e.Operator, e.Left, e.Right)
+}
+
+func (v *prefixVisitor) VisitUnary(e *UnaryExpression) (interface{}, error) {
+	return v.visitAll(e.Operator, e.Operand)
+}
+
+func (v *prefixVisitor) VisitFunctionCall(e *FunctionCallExpression) (interface{}, error) {
+	return v.visitAll(e.Name, e.Arguments...)
+}
+
+func (v *prefixVisitor) VisitPropertyPath(e *PropertyPathExpression) (interface{}, error) {
+	segments := []string{}
+	for _, s := range e.Segments {
+		segments = append(segments, s.Value)
+	}
+	return strings.Join(segments, "."), nil
+}
+
+func (v *prefixVisitor) VisitLiteral(e *LiteralExpression) (interface{}, error) {
+	return e.Token.Value, nil
+}
+
+func (v *prefixVisitor) VisitList(e *ListExpression) (interface{}, error) {
+	return v.visitAll("list", e.Items...)
+}
+
+func (v *prefixVisitor) VisitLambda(e *LambdaExpression) (interface{}, error) {
+	return v.visitAll(e.Operator+" "+e.Variable, e.Collection, e.Predicate)
+}
+
+func (v *prefixVisitor) VisitIt(e *ItExpression) (interface{}, error) {
+	return "$it", nil
+}
+
+func (v *prefixVisitor) VisitRoot(e *RootExpression) (interface{}, error) {
+	return "$root", nil
+}
+
+func (v *prefixVisitor) VisitThis(e *ThisExpression) (interface{}, error) {
+	return "$this", nil
+}
+
+func TestFilterVisitor(t *testing.T) {
+	filter, err := ParseFilterString("Price mul 2 gt 10 or startswith(Name,'A')")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expr, err := filter.Expression()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	result, err := expr.Accept(&prefixVisitor{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := "(or (gt (mul Price 2) 10) (startswith Name 'A'))"
+	if result.(string) != expected {
+		t.Error("Expected " + expected + " got " + result.(string))
+	}
+}
@@ -0,0 +1,178 @@
+package godata
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A function that can be used in $filter expressions of a service in addition
+// to the functions defined by OData, e.g. a domain specific predicate.
+type FilterFunction struct {
+	Name string
+	// The type signatures of the function, one for each overload
+	Signatures []*FunctionSignature
+	// How the provider implements the function, e.g. an SQL template. It is
+	// not used by the parser, providers look it up when they translate a filter.
+	Translation interface{}
+}
+
+var filterFunctionName = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_.]*$")
+
+// Add a custom function to the $filter language of the service. Provide the
+// translation used by the provider, the return type and the types of the
+// parameters. Defining a function again adds another signature and replaces
+// the translation. Functions and operators defined by OData cannot be
+// redefined. Define the functions before the service handles requests, the
+// lookup and the rebuilt tokenizer and parser are not synchronized.
+func (service *GoDataService) DefineFilterFunction(
+	name string,
+	translation interface{},
+	returns string,
+	params ...string,
+) error {
+	if !filterFunctionName.MatchString(name) {
+		return errors.New("Invalid filter function name " + name)
+	}
+	if _, ok := GlobalFilterParser.Functions[name]; ok {
+		return errors.New("Filter function " + name + " is already defined by OData")
+	}
+	if _, ok := GlobalFilterParser.Operators[name]; ok {
+		return errors.New("Filter function " + name + " is an operator")
+	}
+
+	if service.FilterFunctionLookup == nil {
+		service.FilterFunctionLookup = map[string]*FilterFunction{}
+	}
+	f, ok := service.FilterFunctionLookup[name]
+	if !ok {
+		f = &FilterFunction{Name: name}
+		service.FilterFunctionLookup[name] = f
+	}
+	f.Signatures = append(f.Signatures, &FunctionSignature{params, returns})
+	f.Translation = translation
+
+	service.buildFilterLanguage()
+	return nil
+}
+
+// Lookup a custom filter function of the service, e.g. the function of a
+// node of a filter tree, to get its translation.
+func (service *GoDataService) LookupFilterFunction(name string) (*FilterFunction, error) {
+	f, ok := service.FilterFunctionLookup[name]
+	if !ok {
+		return nil, NotImplementedError("Filter function " + name + " is not supported.")
+	}
+	return f, nil
+}
+
+// Convert an input string from the $filter part of the URL into a parse tree,
+// allowing the custom filter functions of the service.
+func (service *GoDataService) ParseFilterString(filter string) (*GoDataFilterQuery, error) {
+	result, err := parseFilterString(filter, service)
+	if err != nil {
+		return nil, optionError("$filter", filter, err)
+	}
+	return result, nil
+}
+
+// Parse an expand clause, allowing the custom filter functions of the service
+// in the filters of the expand options.
+func (service *GoDataService) ParseExpandString(expand string) (*GoDataExpandQuery, error) {
+	result, err := parseExpandString(expand, service)
+	if err != nil {
+		return nil, optionError("$expand", expand, err)
+	}
+	return result, nil
+}
+
+// Parse a select clause, allowing the custom filter functions of the service
+// in the filters of the options of the items.
+func (service *GoDataService) ParseSelectString(sel string) (*GoDataSelectQuery, error) {
+	result, err := parseSelectString(sel, service)
+	if err != nil {
+		return nil, optionError("$select", sel, err)
+	}
+	return result, nil
+}
+
+// Parse an orderby clause, allowing the custom filter functions of the service
+// in the expressions of the items.
+func (service *GoDataService) ParseOrderByString(orderby string) (*GoDataOrderByQuery, error) {
+	result, err := parseOrderByString(orderby, service)
+	if err != nil {
+		return nil, optionError("$orderby", orderby, err)
+	}
+	return result, nil
+}
+
+// Parse an apply clause, allowing the custom filter functions of the service
+// in the expressions of the transformations.
+func (service *GoDataService) ParseApplyString(apply string) (*GoDataApplyQuery, error) {
+	result, err := parseApplyString(apply, service)
+	if err != nil {
+		return nil, optionError("$apply", apply, err)
+	}
+	return result, nil
+}
+
+// Rebuild the filter tokenizer and parser of the service from the global ones
+// and the custom functions.
+func (service *GoDataService) buildFilterLanguage() {
+	names := make([]string, 0, len(service.FilterFunctionLookup))
+	for name := range service.FilterFunctionLookup {
+		names = append(names, name)
+	}
+	// try longer names first so a name is not cut at the end of another one
+	sort.Slice(names, func(i, j int) bool {
+		return len(names[i]) > len(names[j]) || len(names[i]) == len(names[j]) && names[i] < names[j]
+	})
+
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	tokenizer := FilterTokenizer()
+	pattern := "^(" + strings.Join(quoted, "|") + ")"
+	matcher := &TokenMatcher{pattern, regexp.MustCompile(pattern), FilterTokenFunc}
+	tokenizer.TokenMatchers = append([]*TokenMatcher{matcher}, tokenizer.TokenMatchers...)
+
+	parser := FilterParser()
+	for name, f := range service.FilterFunctionLookup {
+		params := []int{}
+		seen := map[int]bool{}
+		for _, sig := range f.Signatures {
+			if !seen[len(sig.Params)] {
+				seen[len(sig.Params)] = true
+				params = append(params, len(sig.Params))
+			}
+		}
+		parser.DefineFunction(name, params...)
+		for _, sig := range f.Signatures {
+			parser.DefineSignature(name, sig.Returns, sig.Params...)
+		}
+	}
+
+	service.FilterTokenizer = tokenizer
+	service.FilterLexer = filterLexer(names)
+	service.FilterParser = parser
+}
+
+// The lexer for $filter of the service, or the global one if the service is
+// nil or has no custom functions.
+func (service *GoDataService) filterLexer() *Lexer {
+	if service == nil || service.FilterLexer == nil {
+		return GlobalFilterLexer
+	}
+	return service.FilterLexer
+}
+
+// The parser for $filter of the service, or the global one if the service is
+// nil or has no custom functions.
+func (service *GoDataService) filterParser() *Parser {
+	if service == nil || service.FilterParser == nil {
+		return GlobalFilterParser
+	}
+	return service.FilterParser
+}
@@ -0,0 +1,118 @@
+package godata
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFilterFunction(t *testing.T) {
+	service, err := BuildService(&DummyProvider{}, "http://localhost")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = service.DefineFilterFunction("sta.overlaps", "overlaps(%s, %s)", GoDataBoolean, GoDataString, GoDataString)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = service.DefineFilterFunction("sta.overlaps", "overlaps(%s, %s, %s)", GoDataBoolean, GoDataString, GoDataString, GoDataInt32)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	parsedUrl, err := url.Parse("Customers?$filter=sta.overlaps(Name,'x') and sta.overlaps(Name,'y',Age)" +
+		"&$expand=Orders($filter=sta.overlaps(Id,'z'))&$orderby=sta.overlaps(Name,'o') desc")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	request, err := service.ParseRequest(parsedUrl.Path, parsedUrl.Query())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := SemanticizeRequest(request, service); err != nil {
+		t.Error(err)
+		return
+	}
+
+	call := request.Query.Filter.Tree.Children[0]
+	if call.Token.Type != FilterTokenFunc || call.EdmType != GoDataBoolean {
+		t.Error("sta.overlaps is not parsed as a boolean function")
+	}
+	f, err := service.LookupFilterFunction(call.Token.Value)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if f.Translation != "overlaps(%s, %s, %s)" || len(f.Signatures) != 2 {
+		t.Error("Unexpected definition of sta.overlaps")
+	}
+	if request.Query.Expand.ExpandItems[0].Filter.Tree.Token.Value != "sta.overlaps" {
+		t.Error("sta.overlaps is not parsed in the expand filter")
+	}
+	if item := request.Query.OrderBy.OrderByItems[0]; item.Tree.Token.Type != FilterTokenFunc || item.Order != DESC {
+		t.Error("sta.overlaps is not parsed in the orderby")
+	}
+	if _, err := service.ParseSelectString("Tags($filter=sta.overlaps($this,'s'))"); err != nil {
+		t.Error(err)
+	}
+
+	// the function is unknown outside of the service
+	if _, err := ParseFilterString("sta.overlaps(Name,'x')"); err == nil {
+		t.Error("Expected an error without the service")
+	}
+}
+
+func TestFilterFunctionErrors(t *testing.T) {
+	service, err := BuildService(&DummyProvider{}, "http://localhost")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, name := range []string{"contains", "eq", "sta overlaps"} {
+		err := service.DefineFilterFunction(name, nil, GoDataBoolean)
+		if err == nil {
+			t.Error("Expected an error defining " + name)
+			continue
+		}
+		if _, ok := err.(*GoDataError); ok {
+			t.Error("Expected an error of the definition, not of a request, defining " + name)
+		}
+	}
+	if err := service.DefineFilterFunction("sta.overlaps", nil, GoDataBoolean, GoDataString, GoDataString); err != nil {
+		t.Error(err)
+		return
+	}
+
+	entity, err := service.LookupEntityType("Customer")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	tests := map[string]string{
+		"sta.overlaps(Name)":          "expects 2 arguments",
+		"sta.overlaps(Name,Age)":      "cannot be applied to arguments of type (Edm.String, Edm.Int32)",
+		"sta.overlaps(Name,'x') eq 1": "sta.overlaps(Name,'x') eq 1",
+	}
+	for input, expected := range tests {
+		filter, err := service.ParseFilterString(input)
+		if err == nil {
+			err = SemanticizeFilterQuery(filter, service, entity)
+		}
+		if err == nil {
+			t.Error("Expected an error for " + input)
+			continue
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Error("Error for " + input + " does not contain '" + expected + "': " + err.Error())
+		}
+	}
+
+	if _, err := service.LookupFilterFunction("sta.unknown"); err == nil {
+		t.Error("Expected an error looking up an undefined function")
+	}
+}
@@ -0,0 +1,69 @@
+package godata
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Mark the open parens of lists and rewrite JSON arrays as lists, so that
+// "Id in [1,2,3]" is parsed like "Id in (1,2,3)".
+func expandListTokens(tokens []*Token) ([]*Token, error) {
+	result := make([]*Token, 0, len(tokens))
+	for i, token := range tokens {
+		afterIn := i > 0 && tokens[i-1].Type == FilterTokenLogical && tokens[i-1].Value == "in"
+		switch {
+		case token.Type == FilterTokenArray:
+			if !afterIn {
+				return nil, &SyntaxError{token.Offset, "A JSON array is only allowed after in"}
+			}
+			items, err := arrayListTokens(token)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, items...)
+			continue
+		case token.Value == "(" && afterIn:
+			token.Type = FilterTokenList
+		}
+		result = append(result, token)
+	}
+	return result, nil
+}
+
+// Convert a JSON array of primitive values into the tokens of a list of the
+// equivalent literals.
+func arrayListTokens(array *Token) ([]*Token, error) {
+	decoder := json.NewDecoder(strings.NewReader(array.Value))
+	decoder.UseNumber()
+	var items []interface{}
+	if err := decoder.Decode(&items); err != nil {
+		return nil, &SyntaxError{array.Offset, "Invalid JSON array"}
+	}
+
+	result := []*Token{{Value: "(", Type: FilterTokenList, Offset: array.Offset}}
+	for i, item := range items {
+		if i > 0 {
+			result = append(result, &Token{Value: ",", Type: FilterTokenComma, Offset: array.Offset})
+		}
+		token := &Token{Offset: array.Offset}
+		switch item := item.(type) {
+		case nil:
+			token.Value, token.Type = "null", FilterTokenNull
+		case bool:
+			token.Value, token.Type = strconv.FormatBool(item), FilterTokenBoolean
+		case string:
+			token.Value, token.Type = "'"+strings.ReplaceAll(item, "'", "''")+"'", FilterTokenString
+		case json.Number:
+			token.Value, token.Type = item.String(), FilterTokenFloat
+			if _, err := item.Int64(); err == nil {
+				token.Type = FilterTokenInteger
+			}
+		default:
+			return nil, &SyntaxError{array.Offset, "Expected primitive values in this JSON array"}
+		}
+		result = append(result, token)
+	}
+	end := array.Offset + len(array.Value) - 1
+	return append(result, &Token{Value: ")", Type: FilterTokenCloseParen, Offset: end}), nil
+}
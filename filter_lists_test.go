@@ -0,0 +1,124 @@
+package godata
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilterInList(t *testing.T) {
+	tests := map[string]string{
+		"Id in (1,2,3)":                  "Id in (1,2,3)",
+		"Id in (1)":                      "Id in (1)",
+		"Name in ('Milk', 'Cheese')":     "Name in ('Milk','Cheese')",
+		"Name in [\"Milk\",\"It's\"]":    "Name in ('Milk','It''s')",
+		"Id in [1, 2.5, null]":           "Id in (1,2.5,null)",
+		"not Id in (1,2) and Age gt 3":   "not Id in (1,2) and Age gt 3",
+		"Id in (1,(2))":                  "Id in (1,2)",
+		"Id in (Age add 1,length(Name))": "Id in (Age add 1,length(Name))",
+	}
+	for input, expected := range tests {
+		filter, err := ParseFilterString(input)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		if actual := filter.String(); actual != expected {
+			t.Error(input + " is printed as " + actual + " not " + expected)
+		}
+	}
+
+	filter, err := ParseFilterString("Id in [1,2,3]")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	list := filter.Tree.Children[1]
+	if filter.Tree.Token.Value != "in" || list.Token.Type != FilterTokenList || len(list.Children) != 3 {
+		t.Error("Unexpected tree for Id in [1,2,3]")
+	}
+	expr, err := filter.Expression()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	result, err := expr.Accept(&prefixVisitor{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if result.(string) != "(in Id (list 1 2 3))" {
+		t.Error("Unexpected expression " + result.(string))
+	}
+}
+
+func TestFilterInListErrors(t *testing.T) {
+	tests := map[string]string{
+		"Id in ()":            "Expected an item in this list",
+		"Id in (1,)":          "Expected an argument after this comma",
+		"Id in [1,{\"a\":2}]": "Expected primitive values in this JSON array",
+		"Id in [1,":           "No matching token",
+		"Id eq [1]":           "A JSON array is only allowed after in",
+		"Id in (1,2) (3,4)":   "Expected an operator",
+	}
+	for input, expected := range tests {
+		_, err := ParseFilterString(input)
+		if err == nil {
+			t.Error("Expected an error for " + input)
+			continue
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Error("Error for " + input + " does not contain '" + expected + "': " + err.Error())
+		}
+	}
+}
+
+func TestFilterInListTypes(t *testing.T) {
+	filter, err := semanticizeCustomerFilter("Age in (1,2.5,null) and Name in ('a','b')")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	list := filter.Tree.Children[0].Children[1]
+	if list.EdmType != "Collection("+GoDataDecimal+")" {
+		t.Error("Type of the list is " + list.EdmType)
+	}
+
+	tests := map[string]string{
+		"Name in (1,2)":     "Operator in cannot be applied to operands of type Edm.String and Collection(Edm.Int32)",
+		"Age in (1,'a')":    "are of different types Edm.Int32 and Edm.String",
+		"Age in Name":       "Operator in cannot be applied",
+		"Age in (1) eq 'a'": "Age in (1) eq 'a'",
+	}
+	for input, expected := range tests {
+		_, err := semanticizeCustomerFilter(input)
+		if err == nil {
+			t.Error("Expected an error for " + input)
+			continue
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Error("Error for " + input + " does not contain '" + expected + "': " + err.Error())
+		}
+	}
+}
+
+func TestEvaluateInList(t *testing.T) {
+	value := map[string]interface{}{
+		"Id":   int64(2),
+		"Name": "Milk",
+		"Tags": []string{"dairy", "fresh"},
+	}
+	tests := map[string]bool{
+		"Id in (1,2,3)":                 true,
+		"Id in [4,5]":                   false,
+		"Name in [\"Milk\",\"Cheese\"]": true,
+		"'fresh' in Tags":               true,
+		"'stale' in Tags":               false,
+		"Id in (1 add 1)":               true,
+		"not (Id in (1))":               true,
+	}
+	for input, expected := range tests {
+		if evaluateTestFilter(t, input, value) != expected {
+			t.Errorf("%s: expected %v", input, expected)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package godata
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The time elapsed since midnight, used to represent Edm.TimeOfDay values.
+type TimeOfDay time.Duration
+
+func (t TimeOfDay) String() string {
+	return time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(t)).Format("15:04:05.999999999")
+}
+
+var durationLiteral = regexp.MustCompile(
+	`^(-)?P(?:([0-9]+)D)?(?:T(?:([0-9]+)H)?(?:([0-9]+)M)?(?:([0-9]+(?:\.[0-9]+)?)S)?)?$`)
+
+// Decode the value of a literal token of a filter. The Go types of the values
+// are:
+//
+//	null                   nil
+//	Edm.Boolean            bool
+//	Edm.Int32, Edm.Int64   int64
+//	Edm.Decimal            *big.Rat
+//	Edm.Double             float64
+//	Edm.Single             float32
+//	Edm.String             string
+//	Edm.Date               time.Time at midnight UTC
+//	Edm.DateTimeOffset     time.Time
+//	Edm.TimeOfDay          TimeOfDay
+//	Edm.Duration           time.Duration
+//	Edm.Binary             []byte
+//	Edm.Guid               string in lower case
+//	Edm.Geography...       *SpatialLiteral
+//	Edm.Geometry...        *SpatialLiteral
+//	JSON object            map[string]interface{}
+//
+// Enumeration literals decode to their *GoDataEnumValue once the filter has
+// been semanticized, and to the member names before. Other tokens, e.g.
+// property names, cannot be decoded.
+func (t *Token) LiteralValue() (interface{}, error) {
+	switch t.Type {
+	case FilterTokenNull:
+		return nil, nil
+	case FilterTokenBoolean:
+		return t.Value == "true", nil
+	case FilterTokenInteger:
+		i, err := strconv.ParseInt(strings.TrimRight(t.Value, "lL"), 10, 64)
+		if err != nil {
+			return nil, BadRequestError("Invalid integer " + t.Value)
+		}
+		return i, nil
+	case FilterTokenFloat:
+		return decodeFloatLiteral(t.Value)
+	case FilterTokenString:
+		s := t.Value[1 : len(t.Value)-1]
+		return strings.ReplaceAll(s, "''", "'"), nil
+	case FilterTokenDate, FilterTokenDateTime, FilterTokenTime:
+		v, ok := parseTemporal(t.Value)
+		if !ok {
+			return nil, BadRequestError("Invalid date or time " + t.Value)
+		}
+		return v, nil
+	case FilterTokenDuration:
+		d, ok := parseDuration(quotedLiteralValue(t.Value))
+		if !ok {
+			return nil, BadRequestError("Invalid duration " + t.Value)
+		}
+		return d, nil
+	case FilterTokenBinary:
+		b, ok := parseBinary(quotedLiteralValue(t.Value))
+		if !ok {
+			return nil, BadRequestError("Invalid binary " + t.Value)
+		}
+		return b, nil
+	case FilterTokenGuid:
+		return strings.ToLower(t.Value), nil
+	case FilterTokenEnum:
+		if v, ok := t.SemanticReference.(*GoDataEnumValue); ok {
+			return v, nil
+		}
+		_, value := splitEnumLiteral(t.Value)
+		return value, nil
+	case FilterTokenGeography, FilterTokenGeometry:
+		if literal, ok := t.SemanticReference.(*SpatialLiteral); ok {
+			return literal, nil
+		}
+		i := strings.Index(t.Value, "'")
+		if i < 0 {
+			return nil, BadRequestError(t.Value + " is not a literal.")
+		}
+		literal, err := parseSpatialLiteral(t.Type == FilterTokenGeography, quotedLiteralValue(t.Value))
+		if err != nil {
+			return nil, BadRequestError("Invalid spatial literal " + t.Value + ": " + err.Error())
+		}
+		return literal, nil
+	case FilterTokenObject:
+		var value map[string]interface{}
+		if err := json.Unmarshal([]byte(t.Value), &value); err != nil {
+			return nil, BadRequestError("Invalid JSON object " + t.Value)
+		}
+		return value, nil
+	}
+	return nil, BadRequestError(t.Value + " is not a literal.")
+}
+
+// Decode a floating point literal. Literals with an exponent, a d suffix or
+// INF and NaN are doubles, literals with an f suffix singles and all other
+// literals decimals.
+func decodeFloatLiteral(s string) (interface{}, error) {
+	switch floatLiteralEdmType(s) {
+	case GoDataSingle:
+		f, err := strconv.ParseFloat(strings.TrimRight(s, "fF"), 32)
+		if err != nil {
+			return nil, BadRequestError("Invalid number " + s)
+		}
+		return float32(f), nil
+	case GoDataDouble:
+		switch s {
+		case "INF":
+			return math.Inf(1), nil
+		case "-INF":
+			return math.Inf(-1), nil
+		case "NaN":
+			return math.NaN(), nil
+		}
+		f, err := strconv.ParseFloat(strings.TrimRight(s, "dD"), 64)
+		if err != nil {
+			return nil, BadRequestError("Invalid number " + s)
+		}
+		return f, nil
+	}
+	r, ok := new(big.Rat).SetString(strings.TrimRight(s, "mM"))
+	if !ok {
+		return nil, BadRequestError("Invalid number " + s)
+	}
+	return r, nil
+}
+
+// The Edm type of a floating point literal.
+func floatLiteralEdmType(s string) string {
+	switch {
+	case strings.HasSuffix(s, "INF") || s == "NaN":
+		return GoDataDouble
+	case strings.HasSuffix(s, "m") || strings.HasSuffix(s, "M"):
+		return GoDataDecimal
+	case strings.HasSuffix(s, "f") || strings.HasSuffix(s, "F"):
+		return GoDataSingle
+	case strings.HasSuffix(s, "d") || strings.HasSuffix(s, "D") || strings.ContainsAny(s, "eE"):
+		return GoDataDouble
+	}
+	return GoDataDecimal
+}
+
+// The value between the quotes of a literal like duration'P1D'.
+func quotedLiteralValue(s string) string {
+	i := strings.Index(s, "'")
+	if i < 0 || !strings.HasSuffix(s, "'") || len(s) < i+2 {
+		return ""
+	}
+	return s[i+1 : len(s)-1]
+}
+
+// Parse an ISO 8601 duration with days, hours, minutes and seconds, e.g.
+// P1DT2H30M or -PT0.5S. Years and months are not allowed in Edm.Duration.
+func parseDuration(s string) (time.Duration, bool) {
+	match := durationLiteral.FindStringSubmatch(s)
+	if match == nil || s == "P" || s == "-P" || strings.HasSuffix(s, "T") {
+		return 0, false
+	}
+	var result time.Duration
+	units := []time.Duration{24 * time.Hour, time.Hour, time.Minute}
+	for i, unit := range units {
+		if match[i+2] == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(match[i+2], 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		result += time.Duration(n) * unit
+	}
+	if match[5] != "" {
+		seconds, err := strconv.ParseFloat(match[5], 64)
+		if err != nil {
+			return 0, false
+		}
+		result += time.Duration(math.Round(seconds * float64(time.Second)))
+	}
+	if match[1] == "-" {
+		result = -result
+	}
+	return result, true
+}
+
+// Format a duration as an ISO 8601 duration.
+func formatDuration(d time.Duration) string {
+	result := "P"
+	if d < 0 {
+		result = "-P"
+		d = -d
+	}
+	if days := d / (24 * time.Hour); days > 0 {
+		result += strconv.FormatInt(int64(days), 10) + "D"
+		d -= days * 24 * time.Hour
+	}
+	if d == 0 {
+		if result == "P" || result == "-P" {
+			return "PT0S"
+		}
+		return result
+	}
+	result += "T"
+	if hours := d / time.Hour; hours > 0 {
+		result += strconv.FormatInt(int64(hours), 10) + "H"
+		d -= hours * time.Hour
+	}
+	if minutes := d / time.Minute; minutes > 0 {
+		result += strconv.FormatInt(int64(minutes), 10) + "M"
+		d -= minutes * time.Minute
+	}
+	if d > 0 {
+		result += strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "S"
+	}
+	return result
+}
+
+// Decode a binary literal, which is base64url encoded with optional padding.
+// Standard base64 is accepted as well.
+func parseBinary(s string) ([]byte, bool) {
+	trimmed := strings.TrimRight(s, "=")
+	if b, err := base64.RawURLEncoding.DecodeString(trimmed); err == nil {
+		return b, true
+	}
+	if b, err := base64.RawStdEncoding.DecodeString(trimmed); err == nil {
+		return b, true
+	}
+	return nil, false
+}
+
+// Parse a date, date time or time of day.
+func parseTemporal(s string) (interface{}, bool) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse("2006-01-02T15:04Z07:00", s); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, true
+	}
+	for _, layout := range []string{"15:04:05.999999999", "15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return TimeOfDay(t.Sub(time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC))), true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,144 @@
+package godata
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestFilterLiteralTokens(t *testing.T) {
+	tests := map[string]int{
+		"true":                                 FilterTokenBoolean,
+		"false":                                FilterTokenBoolean,
+		"null":                                 FilterTokenNull,
+		"42":                                   FilterTokenInteger,
+		"42L":                                  FilterTokenInteger,
+		"-1.5":                                 FilterTokenFloat,
+		"1.5M":                                 FilterTokenFloat,
+		"1.5e-3":                               FilterTokenFloat,
+		"2E10":                                 FilterTokenFloat,
+		"2d":                                   FilterTokenFloat,
+		"2.5f":                                 FilterTokenFloat,
+		"INF":                                  FilterTokenFloat,
+		"-INF":                                 FilterTokenFloat,
+		"NaN":                                  FilterTokenFloat,
+		"duration'P1DT2H'":                     FilterTokenDuration,
+		"binary'T0RhdGE'":                      FilterTokenBinary,
+		"01234567-89ab-cdef-0123-456789ABCDEF": FilterTokenGuid,
+		"2015-10-14":                           FilterTokenDate,
+		"address":                              FilterTokenLiteral,
+		"anything":                             FilterTokenLiteral,
+		"nullable":                             FilterTokenLiteral,
+		"trueValue":                            FilterTokenLiteral,
+		"INFO":                                 FilterTokenLiteral,
+	}
+
+	for input, expected := range tests {
+		tokens, err := GlobalFilterTokenizer.Tokenize(input)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		if len(tokens) != 1 {
+			t.Errorf("%s is split into %d tokens", input, len(tokens))
+			continue
+		}
+		if tokens[0].Type != expected {
+			t.Errorf("%s is of token type %d not %d", input, tokens[0].Type, expected)
+		}
+	}
+}
+
+func TestFilterLiteralValues(t *testing.T) {
+	tests := []struct {
+		input   string
+		edmType string
+		value   interface{}
+	}{
+		{"true", GoDataBoolean, true},
+		{"42", GoDataInt32, int64(42)},
+		{"42L", GoDataInt64, int64(42)},
+		{"-1.25", GoDataDecimal, big.NewRat(-5, 4)},
+		{"1.25M", GoDataDecimal, big.NewRat(5, 4)},
+		{"1.5e3", GoDataDouble, 1500.0},
+		{"2d", GoDataDouble, 2.0},
+		{"2.5f", GoDataSingle, float32(2.5)},
+		{"-INF", GoDataDouble, math.Inf(-1)},
+		{"'It''s'", GoDataString, "It's"},
+		{"duration'-P1DT2H30M0.5S'", GoDataDuration, -(26*time.Hour + 30*time.Minute + 500*time.Millisecond)},
+		{"binary'T0RhdGE'", GoDataBinary, []byte("OData")},
+		{"01234567-89AB-CDEF-0123-456789ABCDEF", GoDataGuid, "01234567-89ab-cdef-0123-456789abcdef"},
+		{"2015-10-14", GoDataDate, time.Date(2015, 10, 14, 0, 0, 0, 0, time.UTC)},
+		{"12:30", GoDataTimeOfDay, TimeOfDay(12*time.Hour + 30*time.Minute)},
+	}
+
+	for _, test := range tests {
+		tokens, err := GlobalFilterTokenizer.Tokenize(test.input)
+		if err != nil {
+			t.Error(test.input + ": " + err.Error())
+			continue
+		}
+		token := tokens[0]
+		if edmType := literalEdmType(token); edmType != test.edmType {
+			t.Error(test.input + " is of type " + edmType + " not " + test.edmType)
+		}
+		value, err := token.LiteralValue()
+		if err != nil {
+			t.Error(test.input + ": " + err.Error())
+			continue
+		}
+		equal := false
+		switch expected := test.value.(type) {
+		case *big.Rat:
+			r, ok := value.(*big.Rat)
+			equal = ok && r.Cmp(expected) == 0
+		case []byte:
+			b, ok := value.([]byte)
+			equal = ok && bytes.Equal(b, expected)
+		case time.Time:
+			tm, ok := value.(time.Time)
+			equal = ok && tm.Equal(expected)
+		default:
+			equal = value == test.value
+		}
+		if !equal {
+			t.Errorf("%s is decoded as %#v not %#v", test.input, value, test.value)
+		}
+	}
+
+	for _, input := range []string{"duration'P1Y'", "duration'PT'", "binary'***'"} {
+		tokens, err := GlobalFilterTokenizer.Tokenize(input)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		if _, err := tokens[0].LiteralValue(); err == nil {
+			t.Error("Expected an error decoding " + input)
+		}
+	}
+}
+
+func TestFilterLiteralEvaluation(t *testing.T) {
+	value := map[string]interface{}{
+		"Ratio":    0.5,
+		"Timeout":  90 * time.Minute,
+		"Payload":  []byte("OData"),
+		"Disabled": false,
+		"address":  "Main Street",
+	}
+	tests := map[string]bool{
+		"Ratio eq 5e-1 and Ratio lt 1M and Ratio gt 0.25f":          true,
+		"Timeout eq duration'PT1H30M' and Timeout gt duration'P0D'": true,
+		"Payload eq binary'T0RhdGE='":                               true,
+		"Disabled eq false and not Disabled":                        true,
+		"address eq 'Main Street'":                                  true,
+		"cast(Timeout,Edm.String) eq 'PT1H30M'":                     true,
+	}
+	for input, expected := range tests {
+		if evaluateTestFilter(t, input, value) != expected {
+			t.Errorf("%s: expected %v", input, expected)
+		}
+	}
+}
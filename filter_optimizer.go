@@ -0,0 +1,384 @@
+package godata
+
+import (
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Rewrite a semanticized filter tree into a smaller, canonical tree with the
+// same meaning, so equivalent filters produce the same tree:
+//
+//   - subexpressions of literals are folded into a literal, e.g. 1 add 2
+//   - not is pushed down to the comparisons by De Morgan's laws, and
+//     not (a eq b) becomes a ne b
+//   - nested and and or operators are flattened, duplicate operands are
+//     removed and the operands are sorted by their printed form
+//   - true and false operands are simplified, and a conjunction of a
+//     predicate and its negation, or of Name eq 'x' and Name eq 'y', is false
+//
+// Constants are folded with the semantics of the FilterEvaluator. Expressions
+// that fail to evaluate, like a division by zero, are kept for the provider
+// to report. Contradictions are only replaced where null and false both mean
+// that an entity does not match, i.e. not inside other operators or functions.
+func OptimizeFilterQuery(filter *GoDataFilterQuery) {
+	if filter == nil || filter.Tree == nil {
+		return
+	}
+	filter.Tree = optimizeFilterNode(filter.Tree, false, true)
+	filter.Tree.Parent = nil
+}
+
+// Optimize the node, negated if negate is set. A predicate node is in a
+// position where null and false have the same meaning.
+func optimizeFilterNode(node *ParseNode, negate, predicate bool) *ParseNode {
+	if isFilterOperator(node, "not", 1) {
+		return optimizeFilterNode(node.Children[0], !negate, predicate)
+	}
+	if isFilterOperator(node, "and", 2) || isFilterOperator(node, "or", 2) {
+		return optimizeFilterChain(node, negate, predicate)
+	}
+
+	for i, child := range node.Children {
+		// the predicate of a lambda is matched like the filter
+		nested := node.Token.Type == FilterTokenColon && i == 1
+		node.Children[i] = optimizeFilterNode(child, false, nested)
+		node.Children[i].Parent = node
+	}
+	node = foldFilterConstant(node)
+	if !negate {
+		return node
+	}
+
+	switch {
+	case isFilterOperator(node, "eq", 2):
+		node.Token.Value = "ne"
+		return node
+	case isFilterOperator(node, "ne", 2):
+		node.Token.Value = "eq"
+		return node
+	case node.Token.Type == FilterTokenNull:
+		// not null is null
+		return node
+	case node.Token.Type == FilterTokenBoolean:
+		if b, err := node.Token.LiteralValue(); err == nil {
+			return newFilterNode(node, strconv.FormatBool(!b.(bool)), FilterTokenBoolean, GoDataBoolean)
+		}
+	}
+	negated := negateFilterNode(node)
+	node.Parent = negated
+	return negated
+}
+
+// Optimize a chain of and or or operators. Negating a chain negates its
+// operands and swaps the operator.
+func optimizeFilterChain(node *ParseNode, negate, predicate bool) *ParseNode {
+	op := node.Token.Value
+	if negate {
+		op = map[string]string{"and": "or", "or": "and"}[op]
+	}
+	identity, absorbing := op == "and", op == "or"
+
+	operands := []*ParseNode{}
+	keys := map[string]bool{}
+	var collect func(*ParseNode)
+	collect = func(n *ParseNode) {
+		if isFilterOperator(n, op, 2) {
+			collect(n.Children[0])
+			collect(n.Children[1])
+			return
+		}
+		key := printFilterNode(n, GlobalFilterParser)
+		if !keys[key] {
+			keys[key] = true
+			operands = append(operands, n)
+		}
+	}
+	for _, child := range node.Children {
+		collect(optimizeFilterNode(child, negate, predicate))
+	}
+
+	result := operands[:0]
+	for _, operand := range operands {
+		if operand.Token.Type == FilterTokenBoolean && len(operand.Children) == 0 {
+			if b, err := operand.Token.LiteralValue(); err == nil {
+				if b.(bool) == absorbing {
+					return newFilterNode(node, strconv.FormatBool(absorbing), FilterTokenBoolean, GoDataBoolean)
+				}
+				if b.(bool) == identity {
+					continue
+				}
+			}
+		}
+		result = append(result, operand)
+	}
+	if op == "and" && predicate && isFilterContradiction(result, keys) {
+		return newFilterNode(node, "false", FilterTokenBoolean, GoDataBoolean)
+	}
+	if len(result) == 0 {
+		return newFilterNode(node, strconv.FormatBool(identity), FilterTokenBoolean, GoDataBoolean)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return printFilterNode(result[i], GlobalFilterParser) < printFilterNode(result[j], GlobalFilterParser)
+	})
+	chain := result[0]
+	for _, operand := range result[1:] {
+		parent := newFilterNode(node, op, FilterTokenLogical, GoDataBoolean)
+		parent.Children = []*ParseNode{chain, operand}
+		chain.Parent = parent
+		operand.Parent = parent
+		chain = parent
+	}
+	return chain
+}
+
+// Check whether a conjunction of the operands is always false: it contains a
+// predicate and its negation, or compares an expression to different
+// literals with eq.
+func isFilterContradiction(operands []*ParseNode, keys map[string]bool) bool {
+	values := map[string]interface{}{}
+	for _, operand := range operands {
+		if keys[printFilterNode(negateFilterNode(operand), GlobalFilterParser)] {
+			return true
+		}
+		if !isFilterOperator(operand, "eq", 2) {
+			continue
+		}
+		left, right := operand.Children[0], operand.Children[1]
+		if isComparableLiteral(left) {
+			left, right = right, left
+		}
+		if !isComparableLiteral(right) {
+			continue
+		}
+		value, err := right.Token.LiteralValue()
+		if err != nil {
+			continue
+		}
+		value = normalizeValue(value)
+		key := printFilterNode(left, GlobalFilterParser)
+		if other, ok := values[key]; ok {
+			if eq, err := equalValues(other, value); err == nil && !eq {
+				return true
+			}
+			continue
+		}
+		values[key] = value
+	}
+	return false
+}
+
+// Literals whose values can be compared without knowing the other operand.
+func isComparableLiteral(node *ParseNode) bool {
+	if len(node.Children) > 0 {
+		return false
+	}
+	switch node.Token.Type {
+	case FilterTokenNull, FilterTokenInteger, FilterTokenFloat, FilterTokenString, FilterTokenBoolean,
+		FilterTokenDate, FilterTokenTime, FilterTokenDateTime, FilterTokenGuid, FilterTokenDuration:
+		return true
+	}
+	return false
+}
+
+// Replace an operator or function applied to literals by its value. The node
+// is kept if the value cannot be evaluated or written as a literal.
+func foldFilterConstant(node *ParseNode) *ParseNode {
+	if len(node.Children) == 0 || node.Token.Type == FilterTokenList || !isFilterConstant(node) {
+		return node
+	}
+	if hasDecimalOperand(node) {
+		// the evaluator computes decimals as float64, which is not exact
+		return foldDecimalConstant(node)
+	}
+	expr, err := BuildFilterExpression(node)
+	if err != nil {
+		return node
+	}
+	value, err := expr.Accept(&filterEvaluation{&FilterEvaluator{}, nil, map[string]interface{}{}})
+	if err != nil {
+		return node
+	}
+
+	switch value := value.(type) {
+	case nil:
+		return newFilterNode(node, "null", FilterTokenNull, "")
+	case bool:
+		return newFilterNode(node, strconv.FormatBool(value), FilterTokenBoolean, GoDataBoolean)
+	case int64:
+		return newFilterNode(node, strconv.FormatInt(value, 10), FilterTokenInteger, node.EdmType)
+	case float64:
+		return newFilterNode(node, printFloatValue(value), FilterTokenFloat, node.EdmType)
+	case string:
+		return newFilterNode(node, "'"+strings.ReplaceAll(value, "'", "''")+"'", FilterTokenString, GoDataString)
+	}
+	return node
+}
+
+// Check whether the node has an operand of type Edm.Decimal.
+func hasDecimalOperand(node *ParseNode) bool {
+	for _, child := range node.Children {
+		if child.EdmType == GoDataDecimal || hasDecimalOperand(child) {
+			return true
+		}
+		if child.Token.Type == FilterTokenFloat && floatLiteralEdmType(child.Token.Value) == GoDataDecimal {
+			return true
+		}
+	}
+	return false
+}
+
+// Fold an arithmetic operator or a comparison of integer and decimal literals
+// exactly. The node is kept for other operands and for results that have no
+// finite decimal representation.
+func foldDecimalConstant(node *ParseNode) *ParseNode {
+	if len(node.Children) != 2 {
+		return node
+	}
+	l, lok := decimalLiteralValue(node.Children[0])
+	r, rok := decimalLiteralValue(node.Children[1])
+	if !lok || !rok {
+		return node
+	}
+
+	var result *big.Rat
+	switch node.Token.Value {
+	case "add":
+		result = new(big.Rat).Add(l, r)
+	case "sub":
+		result = new(big.Rat).Sub(l, r)
+	case "mul":
+		result = new(big.Rat).Mul(l, r)
+	case "div":
+		if r.Sign() == 0 {
+			return node
+		}
+		result = new(big.Rat).Quo(l, r)
+	case "eq", "ne", "gt", "ge", "lt", "le":
+		c := l.Cmp(r)
+		value := map[string]bool{"eq": c == 0, "ne": c != 0, "gt": c > 0, "ge": c >= 0, "lt": c < 0, "le": c <= 0}[node.Token.Value]
+		return newFilterNode(node, strconv.FormatBool(value), FilterTokenBoolean, GoDataBoolean)
+	default:
+		return node
+	}
+	literal, ok := printDecimalValue(result)
+	if !ok {
+		return node
+	}
+	return newFilterNode(node, literal, FilterTokenFloat, GoDataDecimal)
+}
+
+// The exact value of an integer or decimal literal.
+func decimalLiteralValue(node *ParseNode) (*big.Rat, bool) {
+	if len(node.Children) > 0 {
+		return nil, false
+	}
+	switch node.Token.Type {
+	case FilterTokenInteger:
+		if i, err := node.Token.LiteralValue(); err == nil {
+			return new(big.Rat).SetInt64(i.(int64)), true
+		}
+	case FilterTokenFloat:
+		if r, err := node.Token.LiteralValue(); err == nil {
+			r, ok := r.(*big.Rat)
+			return r, ok
+		}
+	}
+	return nil, false
+}
+
+// Print a rational number as a decimal literal if it has finitely many
+// digits.
+func printDecimalValue(r *big.Rat) (string, bool) {
+	denom := new(big.Int).Set(r.Denom())
+	digits := 0
+	for _, factor := range []int64{2, 5} {
+		n := 0
+		f := big.NewInt(factor)
+		m := new(big.Int)
+		for {
+			q, rem := new(big.Int).QuoRem(denom, f, m)
+			if rem.Sign() != 0 {
+				break
+			}
+			denom = q
+			n++
+		}
+		digits = max(digits, n)
+	}
+	if denom.Cmp(big.NewInt(1)) != 0 {
+		return "", false
+	}
+	return r.FloatString(max(digits, 1)), true
+}
+
+// Print a float so it is tokenized as a float again.
+func printFloatValue(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "INF"
+	case math.IsInf(f, -1):
+		return "-INF"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// Check whether the value of the node only depends on literals.
+func isFilterConstant(node *ParseNode) bool {
+	switch node.Token.Type {
+	case FilterTokenNull, FilterTokenInteger, FilterTokenFloat, FilterTokenString, FilterTokenBoolean,
+		FilterTokenDate, FilterTokenTime, FilterTokenDateTime, FilterTokenDuration, FilterTokenBinary,
+		FilterTokenGuid, FilterTokenEnum, FilterTokenGeography, FilterTokenGeometry:
+		return len(node.Children) == 0
+	case FilterTokenFunc:
+		if node.Token.Value == "now" {
+			return false
+		}
+	case FilterTokenLogical, FilterTokenOp, FilterTokenList:
+	default:
+		return false
+	}
+	for _, child := range node.Children {
+		if !isFilterConstant(child) {
+			return false
+		}
+	}
+	return true
+}
+
+func isFilterOperator(node *ParseNode, op string, operands int) bool {
+	return node.Token.Type == FilterTokenLogical && node.Token.Value == op && len(node.Children) == operands
+}
+
+// The negation of a node without modifying it: the operand of not, the
+// opposite of eq and ne, or a new not node.
+func negateFilterNode(node *ParseNode) *ParseNode {
+	if isFilterOperator(node, "not", 1) {
+		return node.Children[0]
+	}
+	if isFilterOperator(node, "eq", 2) || isFilterOperator(node, "ne", 2) {
+		op := map[string]string{"eq": "ne", "ne": "eq"}[node.Token.Value]
+		negated := newFilterNode(node, op, FilterTokenLogical, GoDataBoolean)
+		negated.Children = node.Children
+		return negated
+	}
+	negated := newFilterNode(node, "not", FilterTokenLogical, GoDataBoolean)
+	negated.Children = []*ParseNode{node}
+	return negated
+}
+
+// Create a node in place of the given node.
+func newFilterNode(from *ParseNode, value string, tokenType int, edmType string) *ParseNode {
+	token := &Token{Value: value, Type: tokenType, Offset: from.Token.Offset, SemanticType: SemanticTypePropertyValue}
+	token.SemanticReference = &token.Value
+	return &ParseNode{Token: token, Parent: from.Parent, EdmType: edmType}
+}
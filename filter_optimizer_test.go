@@ -0,0 +1,69 @@
+package godata
+
+import (
+	"testing"
+)
+
+func TestOptimizeFilter(t *testing.T) {
+	tests := map[string]string{
+		"not (Age ne 1) and true and (Name eq 'x' or Name eq 'x')": "Age eq 1 and Name eq 'x'",
+		"Age gt 1 add 2 mul 3":                                  "Age gt 7",
+		"Age gt 5 div 2.0":                                      "Age gt 2.5",
+		"Name eq concat('a','b')":                               "Name eq 'ab'",
+		"not (Age lt 1 or Name eq 'x')":                         "Name ne 'x' and not (Age lt 1)",
+		"not (not (Age lt 1))":                                  "Age lt 1",
+		"not (Age lt 1 and not (Name eq 'x'))":                  "Name eq 'x' or not (Age lt 1)",
+		"Name eq 'b' and (Age gt 1 and Name eq 'a' or false)":   "false",
+		"Age gt 1 and not (Age gt 1)":                           "false",
+		"Age eq 1 and Age ne 1":                                 "false",
+		"Age eq 1 and (Age eq 1 or false)":                      "Age eq 1",
+		"Age lt 1 or 1 eq 1":                                    "true",
+		"Age lt 1 or 1 eq 2":                                    "Age lt 1",
+		"(Age lt 1 or Age gt 5) or (Name eq 'x' or Age lt 1)":   "Age gt 5 or Age lt 1 or Name eq 'x'",
+		"not true or Age eq 1":                                  "Age eq 1",
+		"Age div 0 eq 1":                                        "Age div 0 eq 1",
+		"1 div 0 eq Age":                                        "1 div 0 eq Age",
+		"Age lt 1 or not (Age lt 1)":                            "Age lt 1 or not (Age lt 1)",
+		"Orders/any(o:o/Id eq 'a' and o/Id eq 'b') or Age eq 1": "Age eq 1 or Orders/any(o:false)",
+		"(Age eq 1 and Age eq 2) eq false":                      "(Age eq 1 and Age eq 2) eq false",
+		"Age in (1 add 1,3) and hour(now()) eq 1":               "Age in (2,3) and hour(now()) eq 1",
+		"0.1 add 0.2 eq 0.3 or Age eq 1":                        "true",
+		"Age eq 9223372036854775807 add 1":                      "Age eq 9223372036854775807 add 1",
+		"Age gt 1 div 3.0":                                      "Age gt 1 div 3.0",
+		"Age gt 0.1 add 0.2":                                    "Age gt 0.3",
+		"Age gt 5 div 2.0 mul 2":                                "Age gt 5.0",
+	}
+	for input, expected := range tests {
+		filter, err := semanticizeCustomerFilter(input)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		OptimizeFilterQuery(filter)
+		if actual := filter.String(); actual != expected {
+			t.Error(input + " is optimized to " + actual + " not " + expected)
+		}
+		if filter.Tree.Parent != nil {
+			t.Error(input + ": the root has a parent")
+		}
+	}
+}
+
+func TestOptimizeFilterCanonical(t *testing.T) {
+	a, _ := semanticizeCustomerFilter("Name eq 'x' and (Age gt 2 and not (Age eq 5))")
+	b, _ := semanticizeCustomerFilter("not (Age eq 5 or Age le 2) and Name eq 'x'")
+	OptimizeFilterQuery(a)
+	OptimizeFilterQuery(b)
+	if a.String() == b.String() {
+		t.Error("Different filters are equal: " + a.String())
+	}
+
+	b, _ = semanticizeCustomerFilter("Age ne 5 and Name eq 'x' and Age gt 2")
+	OptimizeFilterQuery(b)
+	if a.String() != b.String() {
+		t.Error(a.String() + " is not optimized like " + b.String())
+	}
+	if a.Tree.EdmType != GoDataBoolean || a.Tree.Children[0].EdmType != GoDataBoolean {
+		t.Error("The optimized tree has no types")
+	}
+}
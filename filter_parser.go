@@ -23,6 +23,16 @@ const (
 	FilterTokenBoolean
 	FilterTokenLiteral // 20
 	FilterTokenGeography
+	FilterTokenEnum
+	FilterTokenDuration
+	FilterTokenBinary
+	FilterTokenGuid
+	FilterTokenList   // the open paren of a list, e.g. the operand of 'in'
+	FilterTokenArray  // a JSON array, rewritten as a list before parsing
+	FilterTokenAlias  // a parameter alias like @p, replaced by its value
+	FilterTokenObject // a JSON object given as the value of an alias
+	FilterTokenGeometry
+	FilterTokenThis // the current element in the nested options of a collection
 )
 
 var (
@@ -33,16 +43,32 @@ var (
 // Convert an input string from the $filter part of the URL into a parse
 // tree that can be used by providers to create a response.
 func ParseFilterString(filter string) (*GoDataFilterQuery, error) {
-	tokens, err := GlobalFilterTokenizer.Tokenize(filter)
+	result, err := parseFilterString(filter, nil)
+	if err != nil {
+		return nil, optionError("$filter", filter, err)
+	}
+	return result, nil
+}
+
+// Parse the filter with the custom functions of the service. The service may
+// be nil to only allow the functions defined by OData.
+func parseFilterString(filter string, service *GoDataService) (*GoDataFilterQuery, error) {
+	tokens, err := service.filterLexer().Tokenize(filter)
 	if err != nil {
 		return nil, err
 	}
-	// TODO: can we do this in one fell swoop?
-	postfix, err := GlobalFilterParser.InfixToPostfix(tokens)
+	if len(tokens) == 0 {
+		return nil, &SyntaxError{0, "Empty expression"}
+	}
+	tokens, err = foldSpatialTokens(tokens)
 	if err != nil {
 		return nil, err
 	}
-	tree, err := GlobalFilterParser.PostfixToTree(postfix)
+	tokens, err = expandListTokens(tokens)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := service.filterParser().ParseTree(tokens)
 	if err != nil {
 		return nil, err
 	}
@@ -54,27 +80,39 @@ func FilterTokenizer() *Tokenizer {
 	t := Tokenizer{}
 
 	t.Add("^/", FilterTokenNav)
+	t.Add("^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\\b", FilterTokenGuid)
 	t.Add("^[0-9]{4,4}-[0-9]{2,2}-[0-9]{2,2}T[0-9]{2,2}:[0-9]{2,2}(:[0-9]{2,2}(.[0-9]+)?)?(Z|[+-][0-9]{2,2}:[0-9]{2,2})", FilterTokenDateTime)
 	t.Add("^[0-9]{2,2}:[0-9]{2,2}(:[0-9]{2,2}(.[0-9]+)?)?", FilterTokenTime)
 	t.Add("^-?[0-9]{4,4}-[0-9]{2,2}-[0-9]{2,2}", FilterTokenDate)
 	t.Add("^:", FilterTokenColon)
 	t.Add("^,", FilterTokenComma)
+	t.Add("^[a-zA-Z_][a-zA-Z0-9_]*(\\.[a-zA-Z_][a-zA-Z0-9_]*)+'[^']*'", FilterTokenEnum)
 	t.Add("^(contains|endswith|startswith|length|indexof|substringof|substring|tolower|toupper|"+
 		"trim|concat|year|month|day|hour|minute|second|fractionalseconds|date|"+
 		"time|totaloffsetminutes|now|maxdatetime|mindatetime|totalseconds|round|"+
 		"floor|ceiling|isof|cast|geo.distance|geo.intersects|geo.length)", FilterTokenFunc)
 	t.Add("^(st_disjoint|st_touches|st_within|st_overlaps|st_crosses|st_intersects|st_contains|st_relate|st_equals)", FilterTokenFunc)
-	t.Add("^geography", FilterTokenGeography)
-	t.Add("^(eq|ne|gt|ge|lt|le|and|or|not|has)\\b", FilterTokenLogical)
-	t.Add("^(add|sub|mul|div|mod)", FilterTokenOp)
+	t.Add("^geography\\b", FilterTokenGeography)
+	t.Add("^geometry\\b", FilterTokenGeometry)
+	t.Add("^(?i:duration)'[^']*'", FilterTokenDuration)
+	t.Add("^(?i:binary)'[^']*'", FilterTokenBinary)
+	t.Add("^(eq|ne|gt|ge|lt|le|and|or|not|has|in)\\b", FilterTokenLogical)
+	t.Add("^(add|sub|mul|div|mod)\\b", FilterTokenOp)
 	t.Add("^\\(", FilterTokenOpenParen)
 	t.Add("^\\)", FilterTokenCloseParen)
-	t.Add("^(any|all)", FilterTokenLambda)
-	t.Add("^null", FilterTokenNull)
-	t.Add("^\\$it", FilterTokenIt)
-	t.Add("^\\$root", FilterTokenRoot)
-	t.Add("^-?[0-9]+\\.[0-9]+", FilterTokenFloat)
-	t.Add("^-?[0-9]+", FilterTokenInteger)
+	t.Add(`^\[("(\\.|[^"\\])*"|[^\]"])*\]`, FilterTokenArray)
+	t.Add("^(any|all)\\b", FilterTokenLambda)
+	t.Add("^null\\b", FilterTokenNull)
+	t.Add("^(true|false)\\b", FilterTokenBoolean)
+	t.Add("^\\$it\\b", FilterTokenIt)
+	t.Add("^\\$root\\b", FilterTokenRoot)
+	t.Add("^\\$this\\b", FilterTokenThis)
+	t.Add("^@[a-zA-Z_][a-zA-Z0-9_]*", FilterTokenAlias)
+	t.Add("^(NaN|-?INF)\\b", FilterTokenFloat)
+	t.Add("^-?[0-9]+(\\.[0-9]+([eE][+-]?[0-9]+)?|[eE][+-]?[0-9]+)[mMdDfF]?\\b", FilterTokenFloat)
+	t.Add("^-?[0-9]+[mMdDfF]\\b", FilterTokenFloat)
+	t.Add("^-?[0-9]+([lL]\\b)?", FilterTokenInteger)
+	t.Add("^-", FilterTokenOp)
 	t.Add("^'(''|[^'])*'", FilterTokenString)
 	t.Add("^[a-zA-Z][a-zA-Z0-9_.]*", FilterTokenLiteral)
 	t.Ignore("^ ", FilterTokenWhitespace)
@@ -86,14 +124,15 @@ func FilterParser() *Parser {
 	parser := EmptyParser()
 	parser.DefineOperator("/", 2, OpAssociationLeft, 8)
 	parser.DefineOperator("has", 2, OpAssociationLeft, 8)
+	parser.DefineListOperator("in", OpAssociationLeft, 8)
 	parser.DefineOperator("-", 1, OpAssociationNone, 7)
 	parser.DefineOperator("not", 1, OpAssociationLeft, 7)
 	parser.DefineOperator("cast", 2, OpAssociationNone, 7)
-	parser.DefineOperator("mul", 2, OpAssociationNone, 6)
-	parser.DefineOperator("div", 2, OpAssociationNone, 6)
-	parser.DefineOperator("mod", 2, OpAssociationNone, 6)
-	parser.DefineOperator("add", 2, OpAssociationNone, 5)
-	parser.DefineOperator("sub", 2, OpAssociationNone, 5)
+	parser.DefineOperator("mul", 2, OpAssociationLeft, 6)
+	parser.DefineOperator("div", 2, OpAssociationLeft, 6)
+	parser.DefineOperator("mod", 2, OpAssociationLeft, 6)
+	parser.DefineOperator("add", 2, OpAssociationLeft, 5)
+	parser.DefineOperator("sub", 2, OpAssociationLeft, 5)
 	parser.DefineOperator("gt", 2, OpAssociationLeft, 4)
 	parser.DefineOperator("ge", 2, OpAssociationLeft, 4)
 	parser.DefineOperator("lt", 2, OpAssociationLeft, 4)
@@ -103,15 +142,14 @@ func FilterParser() *Parser {
 	parser.DefineOperator("ne", 2, OpAssociationLeft, 3)
 	parser.DefineOperator("and", 2, OpAssociationLeft, 2)
 	parser.DefineOperator("or", 2, OpAssociationLeft, 1)
-	parser.DefineOperator("geography", 1, OpAssociationLeft, 1)
-	parser.DefineOperator(":", 2, OpAssociationLeft, 1)
+	parser.DefineOperator(":", 2, OpAssociationRight, 1)
 	parser.DefineFunction("contains", 2)
 	parser.DefineFunction("endswith", 2)
 	parser.DefineFunction("startswith", 2)
 	parser.DefineFunction("length", 1)
 	parser.DefineFunction("indexof", 2)
 	parser.DefineFunction("substringof", 2)
-	parser.DefineFunction("substring", 3)
+	parser.DefineFunction("substring", 2, 3)
 	parser.DefineFunction("tolower", 1)
 	parser.DefineFunction("toupper", 1)
 	parser.DefineFunction("trim", 1)
@@ -138,7 +176,7 @@ func FilterParser() *Parser {
 	parser.DefineFunction("geo.distance", 2)
 	parser.DefineFunction("geo.intersects", 2)
 	parser.DefineFunction("geo.length", 1)
-	parser.DefineFunction("any", 1)
+	parser.DefineFunction("any", 0, 1)
 	parser.DefineFunction("all", 1)
 	parser.DefineFunction("st_equals", 2)
 	parser.DefineFunction("st_disjoint", 2)
@@ -150,6 +188,60 @@ func FilterParser() *Parser {
 	parser.DefineFunction("st_contains", 2)
 	parser.DefineFunction("st_relate", 3)
 
+	// type signatures of the functions, the return type comes first
+	parser.DefineSignature("contains", GoDataBoolean, GoDataString, GoDataString)
+	parser.DefineSignature("endswith", GoDataBoolean, GoDataString, GoDataString)
+	parser.DefineSignature("startswith", GoDataBoolean, GoDataString, GoDataString)
+	parser.DefineSignature("length", GoDataInt32, GoDataString)
+	parser.DefineSignature("indexof", GoDataInt32, GoDataString, GoDataString)
+	parser.DefineSignature("substringof", GoDataBoolean, GoDataString, GoDataString)
+	parser.DefineSignature("substring", GoDataString, GoDataString, GoDataInt32)
+	parser.DefineSignature("substring", GoDataString, GoDataString, GoDataInt32, GoDataInt32)
+	parser.DefineSignature("tolower", GoDataString, GoDataString)
+	parser.DefineSignature("toupper", GoDataString, GoDataString)
+	parser.DefineSignature("trim", GoDataString, GoDataString)
+	parser.DefineSignature("concat", GoDataString, GoDataString, GoDataString)
+	parser.DefineSignature("year", GoDataInt32, GoDataDate)
+	parser.DefineSignature("year", GoDataInt32, GoDataDateTimeOffset)
+	parser.DefineSignature("month", GoDataInt32, GoDataDate)
+	parser.DefineSignature("month", GoDataInt32, GoDataDateTimeOffset)
+	parser.DefineSignature("day", GoDataInt32, GoDataDate)
+	parser.DefineSignature("day", GoDataInt32, GoDataDateTimeOffset)
+	parser.DefineSignature("hour", GoDataInt32, GoDataTimeOfDay)
+	parser.DefineSignature("hour", GoDataInt32, GoDataDateTimeOffset)
+	parser.DefineSignature("minute", GoDataInt32, GoDataTimeOfDay)
+	parser.DefineSignature("minute", GoDataInt32, GoDataDateTimeOffset)
+	parser.DefineSignature("second", GoDataInt32, GoDataTimeOfDay)
+	parser.DefineSignature("second", GoDataInt32, GoDataDateTimeOffset)
+	parser.DefineSignature("fractionalseconds", GoDataDecimal, GoDataTimeOfDay)
+	parser.DefineSignature("fractionalseconds", GoDataDecimal, GoDataDateTimeOffset)
+	parser.DefineSignature("date", GoDataDate, GoDataDateTimeOffset)
+	parser.DefineSignature("time", GoDataTimeOfDay, GoDataDateTimeOffset)
+	parser.DefineSignature("totaloffsetminutes", GoDataInt32, GoDataDateTimeOffset)
+	parser.DefineSignature("now", GoDataDateTimeOffset)
+	parser.DefineSignature("maxdatetime", GoDataDateTimeOffset)
+	parser.DefineSignature("mindatetime", GoDataDateTimeOffset)
+	parser.DefineSignature("totalseconds", GoDataDecimal, GoDataDuration)
+	parser.DefineSignature("round", GoDataDecimal, GoDataDecimal)
+	parser.DefineSignature("round", GoDataDouble, GoDataDouble)
+	parser.DefineSignature("floor", GoDataDecimal, GoDataDecimal)
+	parser.DefineSignature("floor", GoDataDouble, GoDataDouble)
+	parser.DefineSignature("ceiling", GoDataDecimal, GoDataDecimal)
+	parser.DefineSignature("ceiling", GoDataDouble, GoDataDouble)
+	parser.DefineSignature("geo.distance", GoDataDouble, GoDataGeography, GoDataGeography)
+	parser.DefineSignature("geo.distance", GoDataDouble, GoDataGeometry, GoDataGeometry)
+	parser.DefineSignature("geo.intersects", GoDataBoolean, GoDataGeography, GoDataGeography)
+	parser.DefineSignature("geo.intersects", GoDataBoolean, GoDataGeometry, GoDataGeometry)
+	parser.DefineSignature("geo.length", GoDataDouble, GoDataGeography)
+	parser.DefineSignature("geo.length", GoDataDouble, GoDataGeometry)
+	for _, f := range []string{"st_equals", "st_disjoint", "st_touches", "st_within",
+		"st_overlaps", "st_crosses", "st_intersects", "st_contains"} {
+		parser.DefineSignature(f, GoDataBoolean, GoDataGeography, GoDataGeography)
+		parser.DefineSignature(f, GoDataBoolean, GoDataGeometry, GoDataGeometry)
+	}
+	parser.DefineSignature("st_relate", GoDataBoolean, GoDataGeography, GoDataGeography, GoDataString)
+	parser.DefineSignature("st_relate", GoDataBoolean, GoDataGeometry, GoDataGeometry, GoDataString)
+
 	return parser
 }
 
@@ -162,29 +254,301 @@ func SemanticizeFilterQuery(
 		return nil
 	}
 
-	var semanticizeFilterNode func(node *ParseNode) error
-	semanticizeFilterNode = func(node *ParseNode) error {
-		if node.Token.Type == FilterTokenLiteral {
-			prop, ok := service.PropertyLookup[entity][node.Token.Value]
-			if !ok {
-				return BadRequestError("No property found " + node.Token.Value + " on entity " + entity.Name)
-			}
-			node.Token.SemanticType = SemanticTypeProperty
-			node.Token.SemanticReference = prop
-		} else {
+	semantics := &filterSemantics{service: service, parser: service.filterParser(), entity: entity}
+	return semanticizeFilter(filter, semantics)
+}
+
+// Resolve the filter with the semantics and check that it is a boolean
+// expression.
+func semanticizeFilter(filter *GoDataFilterQuery, semantics *filterSemantics) error {
+	if _, err := semantics.semanticize(filter.Tree, filterScope{}); err != nil {
+		return err
+	}
+
+	if !edmTypeAssignable(filter.Tree.EdmType, GoDataBoolean) {
+		return BadRequestError("The filter '" + filter.String() +
+			"' is of type " + describeEdmType(filter.Tree.EdmType) + ", not a boolean expression.")
+	}
+
+	return nil
+}
+
+// The lambda variables declared by the enclosing any and all operators, mapped
+// to the node that declares them.
+type filterScope map[string]*ParseNode
+
+// The semantic analysis of a filter tree. Property paths are resolved relative
+// to the entity type the filter applies to, which is also the type of $it, or
+// to a lambda variable in scope.
+type filterSemantics struct {
+	service *GoDataService
+	parser  *Parser
+	entity  *GoDataEntityType
+	// The Edm types of the dynamic properties introduced by $apply, e.g.
+	// the aliases of aggregates. If it is set, names that are neither an
+	// alias nor a property of the entity type are rejected, even without an
+	// entity type.
+	aliases map[string]string
+	// The element type of the collection whose nested options are resolved,
+	// which is the type of $this. Property paths are resolved against it if it
+	// is a complex type. If it is empty, $this is the entity like $it.
+	this string
+}
+
+// Annotate the node and its children with the properties they refer to and
+// their Edm types. Returns the entity type the node refers to if it is a path
+// to an entity or to a collection of entities.
+func (s *filterSemantics) semanticize(node *ParseNode, scope filterScope) (*GoDataEntityType, error) {
+	if isTypeNameArgument(node) {
+		// the type name given to cast and isof is not a property
+		node.Token.SemanticType = SemanticTypeUnknown
+		node.EdmType = node.Token.Value
+		return nil, nil
+	}
+
+	switch node.Token.Type {
+	case FilterTokenLiteral:
+		if decl, ok := scope[node.Token.Value]; ok {
+			node.Token.SemanticType = SemanticTypeLambdaVariable
+			node.Token.SemanticReference = decl.Token.SemanticReference
+			node.EdmType = decl.EdmType
+			entity, _ := decl.Token.SemanticReference.(*GoDataEntityType)
+			return entity, nil
+		}
+		if edmType, ok := s.aliases[node.Token.Value]; ok {
 			node.Token.SemanticType = SemanticTypePropertyValue
 			node.Token.SemanticReference = &node.Token.Value
+			node.EdmType = edmType
+			if isPrimitiveEdmType(edmType) {
+				return nil, nil
+			}
+			// grouped by a navigation property
+			entity, _ := s.service.LookupEntityType(edmType)
+			return entity, nil
 		}
+		if s.aliases != nil && s.entity == nil {
+			return nil, BadRequestError("No property found " + node.Token.Value + " after aggregating")
+		}
+		return s.semanticizeSegment(node, nil, s.entity)
+	case FilterTokenIt:
+		node.Token.SemanticType = SemanticTypeEntity
+		node.Token.SemanticReference = s.entity
+		return s.entity, nil
+	case FilterTokenThis:
+		if s.this == "" {
+			node.Token.SemanticType = SemanticTypeEntity
+			node.Token.SemanticReference = s.entity
+			return s.entity, nil
+		}
+		node.Token.SemanticType = SemanticTypePropertyValue
+		node.Token.SemanticReference = &node.Token.Value
+		node.EdmType = s.this
+		return nil, nil
+	case FilterTokenRoot:
+		// paths starting at the service root are not checked
+		node.Token.SemanticType = SemanticTypeUnknown
+		return nil, nil
+	case FilterTokenNav:
+		if len(node.Children) != 2 {
+			return nil, BadRequestError("Path operator requires two operands.")
+		}
+		node.Token.SemanticType = SemanticTypePropertyValue
+		node.Token.SemanticReference = &node.Token.Value
+		base, segment := node.Children[0], node.Children[1]
+		base.Parent = node
+		segment.Parent = node
 
-		for _, child := range node.Children {
-			err := semanticizeFilterNode(child)
-			if err != nil {
-				return err
+		entity, err := s.semanticize(base, scope)
+		if err != nil {
+			return nil, err
+		}
+		if segment.Token.Type == FilterTokenLambda {
+			if err := s.semanticizeLambda(segment, base, entity, scope); err != nil {
+				return nil, err
 			}
+			return nil, inferFilterNodeType(node, s.parser)
+		}
+		if segment.Token.Type != FilterTokenLiteral || len(segment.Children) > 0 {
+			return nil, BadRequestError("Invalid path segment '" +
+				printFilterNode(segment, GlobalFilterParser) + "' in '" + printFilterNode(node, GlobalFilterParser) + "'.")
 		}
+		target, err := s.semanticizeSegment(segment, base, entity)
+		if err != nil {
+			return nil, err
+		}
+		return target, inferFilterNodeType(node, s.parser)
+	case FilterTokenEnum:
+		if err := s.semanticizeEnum(node); err != nil {
+			return nil, err
+		}
+		return nil, inferFilterNodeType(node, s.parser)
+	case FilterTokenLambda:
+		return nil, BadRequestError("The " + node.Token.Value + " operator must be applied to a collection.")
+	case FilterTokenColon:
+		return nil, BadRequestError("A lambda variable must be declared inside an any or all operator.")
+	case FilterTokenGeography, FilterTokenGeometry:
+		// the reference is the parsed literal
+		return nil, inferFilterNodeType(node, s.parser)
+	case FilterTokenAlias:
+		// aliases are resolved by ParseRequest
+		return nil, BadRequestError("Parameter alias " + node.Token.Value + " is not defined.")
+	}
 
-		return nil
+	node.Token.SemanticType = SemanticTypePropertyValue
+	node.Token.SemanticReference = &node.Token.Value
+
+	for _, child := range node.Children {
+		child.Parent = node
+		if _, err := s.semanticize(child, scope); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, inferFilterNodeType(node, s.parser)
+}
+
+// Resolve a segment of a path to a property or navigation property of the
+// entity type the path before it refers to. The base is nil for the first
+// segment of a path.
+func (s *filterSemantics) semanticizeSegment(
+	segment *ParseNode,
+	base *ParseNode,
+	entity *GoDataEntityType,
+) (*GoDataEntityType, error) {
+	name := segment.Token.Value
+
+	if entity == nil {
+		edmType := s.this
+		if base != nil {
+			edmType = base.EdmType
+		}
+		if edmType != "" && isPrimitiveEdmType(edmType) {
+			return nil, BadRequestError("No property found " + name + " on type " + edmType)
+		}
+		if _, isCollection := collectionElementType(edmType); !isCollection && s.service != nil {
+			if t := s.service.lookupStructuredType(edmType); t != nil && t.complex != nil {
+				return s.semanticizeMember(segment, t)
+			}
+		}
+		// the segment is a member of a complex or untyped value, which cannot
+		// be checked
+		segment.Token.SemanticType = SemanticTypeUnknown
+		return nil, nil
+	}
+
+	if prop, ok := s.service.PropertyLookup[entity][name]; ok {
+		segment.Token.SemanticType = SemanticTypeProperty
+		segment.Token.SemanticReference = prop
+		return nil, inferFilterNodeType(segment, s.parser)
+	}
+
+	if navProp, ok := s.service.NavigationPropertyLookup[entity][name]; ok {
+		target, err := s.service.LookupEntityType(navProp.Type)
+		if err != nil {
+			return nil, err
+		}
+		if _, isCollection := collectionElementType(navProp.Type); isCollection {
+			segment.Token.SemanticType = SemanticTypeEntitySet
+		} else {
+			segment.Token.SemanticType = SemanticTypeEntity
+		}
+		segment.Token.SemanticReference = navProp
+		return target, inferFilterNodeType(segment, s.parser)
+	}
+
+	return nil, BadRequestError("No property found " + name + " on entity " + entity.Name)
+}
+
+// Resolve a segment of a path to a property or navigation property of a
+// complex type.
+func (s *filterSemantics) semanticizeMember(segment *ParseNode, t *structuredType) (*GoDataEntityType, error) {
+	name := segment.Token.Value
+	if prop := s.service.structuredProperty(t, name); prop != nil {
+		segment.Token.SemanticType = SemanticTypeProperty
+		segment.Token.SemanticReference = prop
+		return nil, inferFilterNodeType(segment, s.parser)
+	}
+	if navProp := s.service.structuredNavigationProperty(t, name); navProp != nil {
+		target, err := s.service.LookupEntityType(navProp.Type)
+		if err != nil {
+			return nil, err
+		}
+		if _, isCollection := collectionElementType(navProp.Type); isCollection {
+			segment.Token.SemanticType = SemanticTypeEntitySet
+		} else {
+			segment.Token.SemanticType = SemanticTypeEntity
+		}
+		segment.Token.SemanticReference = navProp
+		return target, inferFilterNodeType(segment, s.parser)
 	}
+	return nil, BadRequestError("No property found " + name + " on type " + t.name())
+}
+
+// Resolve an enumeration literal to the value of its enumeration type.
+func (s *filterSemantics) semanticizeEnum(node *ParseNode) error {
+	value, err := s.service.ParseEnumLiteral(node.Token.Value)
+	if err != nil {
+		return err
+	}
+	node.Token.SemanticType = SemanticTypePropertyValue
+	node.Token.SemanticReference = value
+	return nil
+}
 
-	return semanticizeFilterNode(filter.Tree)
+// Bind the variable of an any or all operator to the elements of the
+// collection it is applied to, and semanticize the predicate with the variable
+// in scope.
+func (s *filterSemantics) semanticizeLambda(
+	lambda *ParseNode,
+	collection *ParseNode,
+	entity *GoDataEntityType,
+	scope filterScope,
+) error {
+	elementType, isCollection := collectionElementType(collection.EdmType)
+	if !isCollection && collection.EdmType != "" {
+		return BadRequestError("The " + lambda.Token.Value + " operator cannot be applied to '" +
+			printFilterNode(collection, GlobalFilterParser) + "' of type " + collection.EdmType + ", it is not a collection.")
+	}
+
+	lambda.Token.SemanticType = SemanticTypePropertyValue
+	lambda.Token.SemanticReference = &lambda.Token.Value
+
+	if len(lambda.Children) == 0 {
+		// any() without a predicate
+		return inferFilterNodeType(lambda, s.parser)
+	}
+
+	colon := lambda.Children[0]
+	colon.Parent = lambda
+	if colon.Token.Type != FilterTokenColon || len(colon.Children) != 2 ||
+		colon.Children[0].Token.Type != FilterTokenLiteral {
+		return BadRequestError("The " + lambda.Token.Value + " operator requires a lambda variable and a predicate.")
+	}
+	colon.Token.SemanticType = SemanticTypePropertyValue
+	colon.Token.SemanticReference = &colon.Token.Value
+
+	variable, predicate := colon.Children[0], colon.Children[1]
+	variable.Parent = colon
+	predicate.Parent = colon
+	if _, ok := scope[variable.Token.Value]; ok {
+		return BadRequestError("The lambda variable " + variable.Token.Value + " is already declared.")
+	}
+	variable.Token.SemanticType = SemanticTypeLambdaVariable
+	if entity != nil {
+		variable.Token.SemanticReference = entity
+	}
+	variable.EdmType = elementType
+
+	nested := filterScope{variable.Token.Value: variable}
+	for name, decl := range scope {
+		nested[name] = decl
+	}
+	if _, err := s.semanticize(predicate, nested); err != nil {
+		return err
+	}
+
+	if err := inferFilterNodeType(colon, s.parser); err != nil {
+		return err
+	}
+	return inferFilterNodeType(lambda, s.parser)
 }
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -327,3 +328,94 @@ func TestLambda(t *testing.T) {
 		t.Error("First child is '" + tree.Children[1].Children[0].Token.Value + "' not ':'")
 	}
 }
+
+func TestSemanticizeLambda(t *testing.T) {
+	filter, err := semanticizeCustomerFilter("Orders/any(o:o/Id eq 'x' and o/Customer/Orders/all(p:p/Id ne o/Id and $it/Age gt 18))")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	orders := filter.Tree.Children[0]
+	if orders.Token.SemanticType != SemanticTypeEntitySet {
+		t.Error("Orders is not resolved to a collection navigation property")
+	}
+	if navProp, ok := orders.Token.SemanticReference.(*GoDataNavigationProperty); !ok || navProp.Name != "Orders" {
+		t.Error("Orders does not refer to the Orders navigation property")
+	}
+
+	colon := filter.Tree.Children[1].Children[0]
+	variable := colon.Children[0]
+	if variable.Token.SemanticType != SemanticTypeLambdaVariable || variable.EdmType != "Store.Order" {
+		t.Error("Variable o is not bound to the elements of Orders: " + variable.EdmType)
+	}
+	if entity, ok := variable.Token.SemanticReference.(*GoDataEntityType); !ok || entity.Name != "Order" {
+		t.Error("Variable o does not refer to the Order entity type")
+	}
+
+	// o/Id in the first comparison
+	id := colon.Children[1].Children[0].Children[0].Children[1]
+	if prop, ok := id.Token.SemanticReference.(*GoDataProperty); !ok || prop.Name != "Id" || id.EdmType != GoDataString {
+		t.Error("o/Id does not refer to the Id property of Order")
+	}
+}
+
+func TestSemanticizeLambdaErrors(t *testing.T) {
+	tests := map[string]string{
+		"Orders/any(o:o/Name eq 'x')":                 "No property found Name on entity Order",
+		"Orders/any(o:Id eq 'x')":                     "No property found Id on entity Customer",
+		"Orders/any(o:o/Id)":                          "not a boolean expression",
+		"Name/any(n:n eq 'x')":                        "not a collection",
+		"Orders/any(o:o/Customer/Name eq 1)":          "Customer/Name eq 1",
+		"Orders/any(o:o/Customer/Orders/any(o:true))": "already declared",
+		"Name/Length eq 1":                            "No property found Length on type Edm.String",
+		"any(o:o eq 1)":                               "must be applied to a collection",
+	}
+
+	for input, expected := range tests {
+		_, err := semanticizeCustomerFilter(input)
+		if err == nil {
+			t.Error("Expected an error for " + input)
+			continue
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Error("Error for " + input + " does not contain '" + expected + "': " + err.Error())
+		}
+	}
+}
+
+func TestFilterArityErrors(t *testing.T) {
+	tests := map[string]string{
+		"contains(Name)":       "Function contains expects 2 arguments, got 1",
+		"substring(Name)":      "Function substring expects 2 or 3 arguments, got 1",
+		"length(Name,1)":       "Function length expects 1 argument, got 2",
+		"now(1)":               "Function now expects 0 arguments, got 1",
+		"eq 5":                 "Missing operand for eq",
+		"Name eq":              "Missing operand for eq",
+		"not":                  "Missing operand for not",
+		"Name eq 'a' Age eq 1": "Expected an operator",
+		"contains(Name,)":      "Expected an argument after this comma",
+		"contains(,'a')":       "Expected an argument before this comma",
+		"Tags/all()":           "Function all expects 1 argument, got 0",
+	}
+
+	for input, expected := range tests {
+		_, err := ParseFilterString(input)
+		if err == nil {
+			t.Error("Expected an error for " + input)
+			continue
+		}
+		if err.(*GoDataError).ResponseCode != 400 {
+			t.Error("Expected a bad request for " + input)
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Error("Error for " + input + " does not contain '" + expected + "': " + err.Error())
+		}
+	}
+
+	for _, input := range []string{"substring(Name,1,2) eq 'a'", "Tags/any()", "now() gt 2020-01-01", "Name eq contains"} {
+		if _, err := ParseFilterString(input); err != nil {
+			t.Error(input + ": " + err.Error())
+		}
+	}
+}
@@ -0,0 +1,557 @@
+package godata
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// A geography or geometry literal of a filter, e.g.
+// geography'SRID=4326;POINT(7.5 51.5)', parsed from its well-known text.
+type SpatialLiteral struct {
+	// Whether the literal is a geography, i.e. on a round earth, or a geometry
+	Geography bool
+	// The spatial reference system, 4326 for geographies and 0 for geometries
+	// unless the literal starts with SRID=...;
+	SRID     int
+	Geometry Geometry
+}
+
+// A shape of a spatial literal: Point, LineString, Polygon, MultiPoint,
+// MultiLineString, MultiPolygon or GeometryCollection.
+type Geometry interface {
+	// The name of the shape, e.g. "Point"
+	Kind() string
+	// The well-known text of the shape
+	String() string
+}
+
+// A position with two to four coordinates: x and y (longitude and latitude),
+// then z and m if present. An empty point has no coordinates.
+type Point []float64
+
+// A line through two or more points.
+type LineString []Point
+
+// The rings of a polygon. The first ring is the exterior, the others are holes.
+// Each ring is closed, i.e. its first and last point are equal.
+type Polygon []LineString
+
+type MultiPoint []Point
+
+type MultiLineString []LineString
+
+type MultiPolygon []Polygon
+
+type GeometryCollection []Geometry
+
+func (Point) Kind() string              { return "Point" }
+func (LineString) Kind() string         { return "LineString" }
+func (Polygon) Kind() string            { return "Polygon" }
+func (MultiPoint) Kind() string         { return "MultiPoint" }
+func (MultiLineString) Kind() string    { return "MultiLineString" }
+func (MultiPolygon) Kind() string       { return "MultiPolygon" }
+func (GeometryCollection) Kind() string { return "GeometryCollection" }
+
+func (p Point) String() string {
+	if len(p) == 0 {
+		return "POINT EMPTY"
+	}
+	return "POINT(" + p.coordinates() + ")"
+}
+
+func (l LineString) String() string {
+	return wktShape("LINESTRING", len(l), func(i int) string { return l[i].coordinates() })
+}
+
+func (p Polygon) String() string {
+	return wktShape("POLYGON", len(p), func(i int) string { return p[i].body() })
+}
+
+func (m MultiPoint) String() string {
+	return wktShape("MULTIPOINT", len(m), func(i int) string { return "(" + m[i].coordinates() + ")" })
+}
+
+func (m MultiLineString) String() string {
+	return wktShape("MULTILINESTRING", len(m), func(i int) string { return m[i].body() })
+}
+
+func (m MultiPolygon) String() string {
+	return wktShape("MULTIPOLYGON", len(m), func(i int) string { return m[i].body() })
+}
+
+func (c GeometryCollection) String() string {
+	return wktShape("GEOMETRYCOLLECTION", len(c), func(i int) string { return c[i].String() })
+}
+
+// The extended well-known text of the literal, e.g. SRID=4326;POINT(7.5 51.5).
+func (l *SpatialLiteral) String() string {
+	return "SRID=" + strconv.Itoa(l.SRID) + ";" + l.Geometry.String()
+}
+
+// The Edm type of the literal, e.g. Edm.GeographyPoint.
+func (l *SpatialLiteral) EdmType() string {
+	if l.Geography {
+		return GoDataGeography + l.Geometry.Kind()
+	}
+	return GoDataGeometry + l.Geometry.Kind()
+}
+
+func (p Point) coordinates() string {
+	parts := make([]string, len(p))
+	for i, c := range p {
+		parts[i] = strconv.FormatFloat(c, 'f', -1, 64)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (l LineString) body() string {
+	parts := make([]string, len(l))
+	for i, p := range l {
+		parts[i] = p.coordinates()
+	}
+	return "(" + strings.Join(parts, ",") + ")"
+}
+
+func (p Polygon) body() string {
+	parts := make([]string, len(p))
+	for i, ring := range p {
+		parts[i] = ring.body()
+	}
+	return "(" + strings.Join(parts, ",") + ")"
+}
+
+func wktShape(name string, n int, item func(int) string) string {
+	if n == 0 {
+		return name + " EMPTY"
+	}
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = item(i)
+	}
+	return name + "(" + strings.Join(parts, ",") + ")"
+}
+
+// Replace the geography and geometry tokens followed by a quoted value with
+// a single token of the parsed literal. A geography or geometry token without
+// a value is the name of a property.
+func foldSpatialTokens(tokens []*Token) ([]*Token, error) {
+	result := make([]*Token, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if token.Type != FilterTokenGeography && token.Type != FilterTokenGeometry {
+			result = append(result, token)
+			continue
+		}
+		if i+1 == len(tokens) || tokens[i+1].Type != FilterTokenString ||
+			tokens[i+1].Offset != token.Offset+len(token.Value) {
+			token.Type = FilterTokenLiteral
+			result = append(result, token)
+			continue
+		}
+		value := tokens[i+1]
+		i++
+		literal, err := parseSpatialLiteral(token.Type == FilterTokenGeography, value.Value[1:len(value.Value)-1])
+		if err != nil {
+			if syntaxErr, ok := err.(*SyntaxError); ok {
+				// relative to the quoted value
+				syntaxErr.Offset += value.Offset + 1
+			}
+			return nil, err
+		}
+		result = append(result, &Token{
+			Value:             token.Value + value.Value,
+			Type:              token.Type,
+			Offset:            token.Offset,
+			SemanticReference: literal,
+		})
+	}
+	return result, nil
+}
+
+// Parse the well-known text of a spatial literal, optionally prefixed with
+// SRID=...; as in extended well-known text.
+func parseSpatialLiteral(geography bool, text string) (*SpatialLiteral, error) {
+	literal := &SpatialLiteral{Geography: geography}
+	if geography {
+		literal.SRID = 4326
+	}
+
+	p := &wktParser{input: text}
+	if len(text) >= 5 && strings.EqualFold(text[:5], "SRID=") {
+		end := strings.IndexByte(text, ';')
+		if end < 0 {
+			return nil, &SyntaxError{len(text), "Expected a semicolon after the SRID"}
+		}
+		srid, err := strconv.Atoi(text[5:end])
+		if err != nil || srid < 0 {
+			return nil, &SyntaxError{5, "Expected a spatial reference system ID"}
+		}
+		literal.SRID = srid
+		p.pos = end + 1
+	}
+
+	geometry, err := p.geometry()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return nil, &SyntaxError{p.pos, "Unexpected text after the " + geometry.Kind()}
+	}
+	literal.Geometry = geometry
+	return literal, nil
+}
+
+// A recursive descent parser for well-known text. Offsets of errors are
+// relative to the text.
+type wktParser struct {
+	input string
+	pos   int
+}
+
+func (p *wktParser) geometry() (Geometry, error) {
+	p.skipSpace()
+	start := p.pos
+	name := strings.ToUpper(p.word())
+	// dimensions are given by the number of coordinates
+	next := p.pos
+	switch dims := strings.ToUpper(p.word()); dims {
+	case "", "Z", "M", "ZM":
+	case "EMPTY":
+		p.pos = next
+	default:
+		return nil, &SyntaxError{next, "Unexpected " + dims + " after " + name}
+	}
+
+	switch name {
+	case "POINT":
+		if p.empty() {
+			return Point(nil), nil
+		}
+		var point Point
+		err := p.list(func() (err error) {
+			if point != nil {
+				return &SyntaxError{p.pos, "A point has a single position"}
+			}
+			point, err = p.point()
+			return err
+		})
+		return point, err
+	case "LINESTRING":
+		return p.lineString()
+	case "POLYGON":
+		return p.polygon()
+	case "MULTIPOINT":
+		var points MultiPoint
+		err := p.list(func() error {
+			// the points may or may not be in parens
+			p.skipSpace()
+			var point Point
+			var err error
+			if p.peek() == '(' {
+				err = p.list(func() (err error) {
+					point, err = p.point()
+					return err
+				})
+			} else {
+				point, err = p.point()
+			}
+			points = append(points, point)
+			return err
+		})
+		return points, err
+	case "MULTILINESTRING":
+		var lines MultiLineString
+		err := p.list(func() error {
+			line, err := p.lineString()
+			lines = append(lines, line)
+			return err
+		})
+		return lines, err
+	case "MULTIPOLYGON":
+		var polygons MultiPolygon
+		err := p.list(func() error {
+			polygon, err := p.polygon()
+			polygons = append(polygons, polygon)
+			return err
+		})
+		return polygons, err
+	case "GEOMETRYCOLLECTION", "COLLECTION":
+		var geometries GeometryCollection
+		err := p.list(func() error {
+			geometry, err := p.geometry()
+			geometries = append(geometries, geometry)
+			return err
+		})
+		return geometries, err
+	case "":
+		return nil, &SyntaxError{start, "Expected a geometry"}
+	}
+	return nil, &SyntaxError{start, "Unknown geometry " + name}
+}
+
+func (p *wktParser) lineString() (LineString, error) {
+	if p.empty() {
+		return LineString{}, nil
+	}
+	start := p.pos
+	var line LineString
+	err := p.list(func() error {
+		point, err := p.point()
+		line = append(line, point)
+		return err
+	})
+	if err == nil && len(line) < 2 {
+		return nil, &SyntaxError{start, "A line string requires at least two points"}
+	}
+	return line, err
+}
+
+func (p *wktParser) polygon() (Polygon, error) {
+	if p.empty() {
+		return Polygon{}, nil
+	}
+	var polygon Polygon
+	err := p.list(func() error {
+		p.skipSpace()
+		start := p.pos
+		ring, err := p.lineString()
+		if err != nil {
+			return err
+		}
+		if len(ring) < 4 || ring[0].coordinates() != ring[len(ring)-1].coordinates() {
+			return &SyntaxError{start, "A polygon ring requires at least four points and must be closed"}
+		}
+		polygon = append(polygon, ring)
+		return nil
+	})
+	return polygon, err
+}
+
+// Parse a position of two to four coordinates separated by spaces.
+func (p *wktParser) point() (Point, error) {
+	var point Point
+	for {
+		p.skipSpace()
+		start := p.pos
+		for p.pos < len(p.input) && strings.IndexByte("0123456789+-.eE", p.input[p.pos]) >= 0 {
+			p.pos++
+		}
+		if start == p.pos {
+			break
+		}
+		c, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+		if err != nil {
+			return nil, &SyntaxError{start, "Invalid coordinate " + p.input[start:p.pos]}
+		}
+		point = append(point, c)
+	}
+	if len(point) < 2 || len(point) > 4 {
+		return nil, &SyntaxError{p.pos, "Expected a position of two to four coordinates"}
+	}
+	return point, nil
+}
+
+// Parse a comma separated list of items in parentheses.
+func (p *wktParser) list(item func() error) error {
+	if err := p.expect('('); err != nil {
+		return err
+	}
+	for {
+		if err := item(); err != nil {
+			return err
+		}
+		p.skipSpace()
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+	return p.expect(')')
+}
+
+// Check for the keyword EMPTY and skip it.
+func (p *wktParser) empty() bool {
+	p.skipSpace()
+	start := p.pos
+	if strings.ToUpper(p.word()) == "EMPTY" {
+		return true
+	}
+	p.pos = start
+	return false
+}
+
+func (p *wktParser) word() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.input) && (p.input[p.pos] >= 'a' && p.input[p.pos] <= 'z' ||
+		p.input[p.pos] >= 'A' && p.input[p.pos] <= 'Z') {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *wktParser) expect(c byte) error {
+	p.skipSpace()
+	if p.peek() != c {
+		return &SyntaxError{p.pos, "Expected " + string(c)}
+	}
+	p.pos++
+	return nil
+}
+
+func (p *wktParser) peek() byte {
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+func (p *wktParser) skipSpace() {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// Parse a GeoJSON geometry or feature, e.g. the location of a SensorThings
+// Location. GeoJSON positions are longitude and latitude, so the result is a
+// geography with SRID 4326.
+func ParseGeoJSON(data []byte) (*SpatialLiteral, error) {
+	var value map[string]interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, BadRequestError("Invalid GeoJSON: " + err.Error())
+	}
+	return geoJSONLiteral(value)
+}
+
+func geoJSONLiteral(value map[string]interface{}) (*SpatialLiteral, error) {
+	geometry, err := geoJSONGeometry(value)
+	if err != nil {
+		return nil, err
+	}
+	return &SpatialLiteral{Geography: true, SRID: 4326, Geometry: geometry}, nil
+}
+
+func geoJSONGeometry(value map[string]interface{}) (Geometry, error) {
+	kind, _ := value["type"].(string)
+	switch kind {
+	case "Feature":
+		geometry, ok := value["geometry"].(map[string]interface{})
+		if !ok {
+			return nil, BadRequestError("GeoJSON feature without a geometry.")
+		}
+		return geoJSONGeometry(geometry)
+	case "GeometryCollection":
+		members, ok := value["geometries"].([]interface{})
+		if !ok {
+			return nil, BadRequestError("GeoJSON geometry collection without geometries.")
+		}
+		var collection GeometryCollection
+		for _, member := range members {
+			m, ok := member.(map[string]interface{})
+			if !ok {
+				return nil, BadRequestError("Invalid member of a GeoJSON geometry collection.")
+			}
+			geometry, err := geoJSONGeometry(m)
+			if err != nil {
+				return nil, err
+			}
+			collection = append(collection, geometry)
+		}
+		return collection, nil
+	}
+
+	coordinates := value["coordinates"]
+	switch kind {
+	case "Point":
+		return geoJSONPoint(coordinates)
+	case "MultiPoint":
+		points, err := geoJSONPoints(coordinates)
+		return MultiPoint(points), err
+	case "LineString":
+		points, err := geoJSONPoints(coordinates)
+		return LineString(points), err
+	case "MultiLineString":
+		lines, err := geoJSONLines(coordinates)
+		return MultiLineString(lines), err
+	case "Polygon":
+		rings, err := geoJSONLines(coordinates)
+		return Polygon(rings), err
+	case "MultiPolygon":
+		items, err := geoJSONArray(coordinates)
+		if err != nil {
+			return nil, err
+		}
+		polygons := make(MultiPolygon, len(items))
+		for i, item := range items {
+			rings, err := geoJSONLines(item)
+			if err != nil {
+				return nil, err
+			}
+			polygons[i] = rings
+		}
+		return polygons, nil
+	}
+	return nil, BadRequestError("Unsupported GeoJSON type '" + kind + "'.")
+}
+
+func geoJSONArray(value interface{}) ([]interface{}, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, BadRequestError("Invalid GeoJSON coordinates.")
+	}
+	return items, nil
+}
+
+func geoJSONPoint(value interface{}) (Point, error) {
+	items, err := geoJSONArray(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) < 2 || len(items) > 4 {
+		return nil, BadRequestError("A GeoJSON position requires two to four coordinates.")
+	}
+	point := make(Point, len(items))
+	for i, item := range items {
+		switch c := normalizeValue(item).(type) {
+		case float64:
+			point[i] = c
+		case int64:
+			point[i] = float64(c)
+		default:
+			return nil, BadRequestError("Invalid GeoJSON coordinates.")
+		}
+	}
+	return point, nil
+}
+
+func geoJSONPoints(value interface{}) ([]Point, error) {
+	items, err := geoJSONArray(value)
+	if err != nil {
+		return nil, err
+	}
+	points := make([]Point, len(items))
+	for i, item := range items {
+		if points[i], err = geoJSONPoint(item); err != nil {
+			return nil, err
+		}
+	}
+	return points, nil
+}
+
+func geoJSONLines(value interface{}) ([]LineString, error) {
+	items, err := geoJSONArray(value)
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]LineString, len(items))
+	for i, item := range items {
+		points, err := geoJSONPoints(item)
+		if err != nil {
+			return nil, err
+		}
+		lines[i] = points
+	}
+	return lines, nil
+}
@@ -0,0 +1,107 @@
+package godata
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSpatialLiterals(t *testing.T) {
+	tests := map[string]string{
+		"geography'POINT(7.5 51.5)'":                             "SRID=4326;POINT(7.5 51.5)",
+		"geography'SRID=0;Point(142.1 64.1)'":                    "SRID=0;POINT(142.1 64.1)",
+		"geometry'POINT Z (1 2 3)'":                              "SRID=0;POINT(1 2 3)",
+		"geography'LINESTRING(7.5 51.5, 7.5 53.5)'":              "SRID=4326;LINESTRING(7.5 51.5,7.5 53.5)",
+		"geometry'POLYGON((0 0,4 0,4 4,0 0),(1 1,2 1,2 2,1 1))'": "SRID=0;POLYGON((0 0,4 0,4 4,0 0),(1 1,2 1,2 2,1 1))",
+		"geometry'MULTIPOINT((1 2),(3 4))'":                      "SRID=0;MULTIPOINT((1 2),(3 4))",
+		"geometry'MULTIPOINT(1 2,3 4)'":                          "SRID=0;MULTIPOINT((1 2),(3 4))",
+		"geometry'MULTILINESTRING((1 2,3 4),(5 6,7 8))'":         "SRID=0;MULTILINESTRING((1 2,3 4),(5 6,7 8))",
+		"geometry'MULTIPOLYGON(((0 0,1 0,1 1,0 0)))'":            "SRID=0;MULTIPOLYGON(((0 0,1 0,1 1,0 0)))",
+		"geometry'Collection(Point(1 2),LineString EMPTY)'":      "SRID=0;GEOMETRYCOLLECTION(POINT(1 2),LINESTRING EMPTY)",
+		"geography'SRID=4258;POINT EMPTY'":                       "SRID=4258;POINT EMPTY",
+	}
+	for input, expected := range tests {
+		filter, err := ParseFilterString("st_equals(location," + input + ")")
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		literal := filter.Tree.Children[1]
+		value, err := literal.Token.LiteralValue()
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		spatial, ok := value.(*SpatialLiteral)
+		if !ok {
+			t.Errorf("%s is decoded as %#v", input, value)
+			continue
+		}
+		if spatial.String() != expected {
+			t.Error(input + " is parsed as " + spatial.String() + " not " + expected)
+		}
+		if spatial.Geography != strings.HasPrefix(input, "geography") {
+			t.Error(input + " is not of the expected spatial type")
+		}
+	}
+
+	filter, err := ParseFilterString("geography eq 1")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if filter.Tree.Children[0].Token.Type != FilterTokenLiteral {
+		t.Error("geography without a value is not a property")
+	}
+}
+
+func TestSpatialLiteralErrors(t *testing.T) {
+	tests := map[string]string{
+		"geography'POINT(1)'":                      "at position 36: Expected a position of two to four coordinates",
+		"geography'POINT(1 2'":                     "Expected )",
+		"geography'CIRCLE(1 2)'":                   "at position 29: Unknown geometry CIRCLE",
+		"geography'LINESTRING(1 2)'":               "A line string requires at least two points",
+		"geometry'POLYGON((0 0,1 0,1 1,0 1))'":     "must be closed",
+		"geography'SRID=x;POINT(1 2)'":             "Expected a spatial reference system ID",
+		"geography'POINT(1 2) POINT(3 4)'":         "Unexpected text after the Point",
+		"geography'POINT(1 2,3 4)'":                "A point has a single position",
+		"geography'POINT Q (1 2)'":                 "Unexpected Q after POINT",
+		"geography'MULTIPOINT((1 2),(3 4)'":        "Expected )",
+		"geography'GEOMETRYCOLLECTION(POINT(1))'":  "Expected a position",
+		"geography'POINT(1 2 3 4 5)'":              "Expected a position of two to four coordinates",
+		"geography'SRID=4326,POINT(1 2)'":          "Expected a semicolon after the SRID",
+		"geography'POINT(1 2)' eq geography'x(1)'": "Unknown geometry X",
+	}
+	for input, expected := range tests {
+		_, err := ParseFilterString("st_equals(location," + input + ")")
+		if err == nil {
+			t.Error("Expected an error for " + input)
+			continue
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Error("Error for " + input + " does not contain '" + expected + "': " + err.Error())
+		}
+	}
+}
+
+func TestSpatialLiteralTypes(t *testing.T) {
+	filter, err := semanticizeCustomerFilter(
+		"geo.distance(geography'POINT(1 2)',geography'POINT(3 4)') lt 5 and " +
+			"geo.intersects(geometry'POINT(1 2)',geometry'POLYGON((0 0,4 0,4 4,0 0))')")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	point := filter.Tree.Children[0].Children[0].Children[0]
+	if point.EdmType != "Edm.GeographyPoint" {
+		t.Error("Type of the point is " + point.EdmType)
+	}
+	polygon := filter.Tree.Children[1].Children[1]
+	if polygon.EdmType != "Edm.GeometryPolygon" {
+		t.Error("Type of the polygon is " + polygon.EdmType)
+	}
+
+	_, err = semanticizeCustomerFilter("geo.intersects(geography'POINT(1 2)',geometry'POINT(1 2)')")
+	if err == nil || !strings.Contains(err.Error(), "Edm.GeographyPoint, Edm.GeometryPoint") {
+		t.Error("Expected an error mixing geography and geometry")
+	}
+}
@@ -0,0 +1,384 @@
+package godata
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Rank of the numeric Edm types. An operation on two numeric operands is
+// promoted to the type with the higher rank.
+var edmNumericRank = map[string]int{
+	GoDataByte:    1,
+	GoDataSByte:   1,
+	GoDataInt16:   2,
+	GoDataInt32:   3,
+	GoDataInt64:   4,
+	GoDataDecimal: 5,
+	GoDataSingle:  6,
+	GoDataDouble:  7,
+}
+
+func isNumericEdmType(t string) bool {
+	_, ok := edmNumericRank[t]
+	return ok
+}
+
+func isSpatialEdmType(t string) bool {
+	return strings.HasPrefix(t, GoDataGeography) || strings.HasPrefix(t, GoDataGeometry)
+}
+
+func isTemporalEdmType(t string) bool {
+	return t == GoDataDate || t == GoDataDateTimeOffset
+}
+
+// Only primitive types are type checked. Complex, entity, enum and
+// collection types are left to the provider.
+func isPrimitiveEdmType(t string) bool {
+	return strings.HasPrefix(t, "Edm.")
+}
+
+// Check whether a value of type from can be passed where type to is expected,
+// following the promotion rules for numeric, temporal and spatial types. An
+// empty type (null or unknown) is assignable to anything.
+func edmTypeAssignable(from, to string) bool {
+	if from == "" || to == "" || from == to {
+		return true
+	}
+	if !isPrimitiveEdmType(from) || !isPrimitiveEdmType(to) {
+		return true
+	}
+	if isNumericEdmType(from) && isNumericEdmType(to) {
+		// integers promote to any wider type, floating point types to each
+		// other since literals do not say which one they are
+		return edmNumericRank[from] <= edmNumericRank[to] ||
+			edmNumericRank[from] >= edmNumericRank[GoDataDecimal] &&
+				edmNumericRank[to] >= edmNumericRank[GoDataDecimal]
+	}
+	if from == GoDataDate && to == GoDataDateTimeOffset {
+		return true
+	}
+	if isSpatialEdmType(from) && isSpatialEdmType(to) {
+		return strings.HasPrefix(from, to)
+	}
+	return false
+}
+
+// Check whether values of the two types can be compared with each other.
+func edmTypesComparable(a, b string) bool {
+	return edmTypeAssignable(a, b) || edmTypeAssignable(b, a)
+}
+
+// Return the wider of two numeric types.
+func promoteNumericEdmTypes(a, b string) string {
+	if edmNumericRank[a] >= edmNumericRank[b] {
+		return a
+	}
+	return b
+}
+
+// Split an enumeration literal like Namespace.Color'Red' into the qualified
+// name of the type and the value.
+func splitEnumLiteral(literal string) (string, string) {
+	i := strings.Index(literal, "'")
+	if i < 0 {
+		return literal, ""
+	}
+	return literal[:i], strings.TrimSuffix(literal[i+1:], "'")
+}
+
+// Return the Edm type of a literal token, or an empty string for null.
+func literalEdmType(token *Token) string {
+	switch token.Type {
+	case FilterTokenEnum:
+		typeName, _ := splitEnumLiteral(token.Value)
+		return typeName
+	case FilterTokenInteger:
+		i, err := strconv.ParseInt(token.Value, 10, 64)
+		if err == nil && i >= math.MinInt32 && i <= math.MaxInt32 {
+			return GoDataInt32
+		}
+		return GoDataInt64
+	case FilterTokenFloat:
+		return floatLiteralEdmType(token.Value)
+	case FilterTokenDuration:
+		return GoDataDuration
+	case FilterTokenBinary:
+		return GoDataBinary
+	case FilterTokenGuid:
+		return GoDataGuid
+	case FilterTokenString:
+		return GoDataString
+	case FilterTokenDate:
+		return GoDataDate
+	case FilterTokenTime:
+		return GoDataTimeOfDay
+	case FilterTokenDateTime:
+		return GoDataDateTimeOffset
+	case FilterTokenBoolean:
+		return GoDataBoolean
+	case FilterTokenGeography, FilterTokenGeometry:
+		if literal, ok := token.SemanticReference.(*SpatialLiteral); ok {
+			return literal.EdmType()
+		}
+		if token.Type == FilterTokenGeometry {
+			return GoDataGeometry
+		}
+		return GoDataGeography
+	}
+	return ""
+}
+
+// The type of the elements of a collection type, e.g. Edm.String for
+// Collection(Edm.String). Returns false if the type is not a collection.
+func collectionElementType(t string) (string, bool) {
+	if !strings.HasPrefix(t, "Collection(") || !strings.HasSuffix(t, ")") {
+		return "", false
+	}
+	return t[len("Collection(") : len(t)-1], true
+}
+
+func describeEdmType(t string) string {
+	if t == "" {
+		return "null"
+	}
+	return t
+}
+
+// The type name given as last argument to cast and isof.
+func isTypeNameArgument(node *ParseNode) bool {
+	parent := node.Parent
+	if parent == nil || parent.Token.Type != FilterTokenFunc ||
+		(parent.Token.Value != "cast" && parent.Token.Value != "isof") {
+		return false
+	}
+	return node.Token.Type == FilterTokenLiteral &&
+		parent.Children[len(parent.Children)-1] == node
+}
+
+// Infer the Edm type of a node of a filter tree from the types of its
+// children, which must have been inferred before. Returns an error if the
+// operands of an operator or the arguments of a function have types that
+// cannot be combined.
+func inferFilterNodeType(node *ParseNode, parser *Parser) error {
+	switch node.Token.Type {
+	case FilterTokenLiteral:
+		switch ref := node.Token.SemanticReference.(type) {
+		case *GoDataProperty:
+			node.EdmType = ref.Type
+		case *GoDataNavigationProperty:
+			node.EdmType = ref.Type
+		}
+	case FilterTokenNav:
+		node.EdmType = node.Children[len(node.Children)-1].EdmType
+	case FilterTokenColon:
+		predicate := node.Children[len(node.Children)-1]
+		if !edmTypeAssignable(predicate.EdmType, GoDataBoolean) {
+			return BadRequestError("The lambda predicate '" + printFilterNode(predicate, GlobalFilterParser) +
+				"' is of type " + describeEdmType(predicate.EdmType) + ", not a boolean expression.")
+		}
+		node.EdmType = GoDataBoolean
+	case FilterTokenLambda:
+		node.EdmType = GoDataBoolean
+	case FilterTokenFunc:
+		return inferFunctionType(node, parser)
+	case FilterTokenList:
+		return inferListType(node)
+	case FilterTokenLogical, FilterTokenOp:
+		return inferOperatorType(node)
+	default:
+		node.EdmType = literalEdmType(node.Token)
+	}
+	return nil
+}
+
+func inferFunctionType(node *ParseNode, parser *Parser) error {
+	name := node.Token.Value
+
+	switch name {
+	case "isof":
+		node.EdmType = GoDataBoolean
+		return nil
+	case "cast":
+		node.EdmType = node.Children[len(node.Children)-1].EdmType
+		return nil
+	}
+
+	f, ok := parser.Functions[name]
+	if !ok || len(f.Signatures) == 0 {
+		return nil
+	}
+
+	for _, sig := range f.Signatures {
+		if len(sig.Params) != len(node.Children) {
+			continue
+		}
+		match := true
+		for i, param := range sig.Params {
+			if !edmTypeAssignable(node.Children[i].EdmType, param) {
+				match = false
+				break
+			}
+		}
+		if match {
+			node.EdmType = sig.Returns
+			return nil
+		}
+	}
+
+	args := make([]string, len(node.Children))
+	for i, child := range node.Children {
+		args[i] = describeEdmType(child.EdmType)
+	}
+	return BadRequestError("Function " + name + " cannot be applied to arguments of type (" +
+		strings.Join(args, ", ") + ") in '" + printFilterNode(node, GlobalFilterParser) + "'.")
+}
+
+// The type of a list is a collection of the common type of its items. Null
+// items are allowed in any list.
+func inferListType(node *ParseNode) error {
+	element := ""
+	for _, child := range node.Children {
+		t := child.EdmType
+		switch {
+		case t == "" || t == element:
+		case element == "":
+			element = t
+		case !edmTypesComparable(element, t):
+			return BadRequestError("The items of the list '" + printFilterNode(node, GlobalFilterParser) +
+				"' are of different types " + element + " and " + t + ".")
+		case isNumericEdmType(element) && isNumericEdmType(t):
+			element = promoteNumericEdmTypes(element, t)
+		case edmTypeAssignable(element, t):
+			element = t
+		}
+	}
+	if element != "" {
+		node.EdmType = "Collection(" + element + ")"
+	}
+	return nil
+}
+
+func inferOperatorType(node *ParseNode) error {
+	op := node.Token.Value
+
+	if len(node.Children) == 1 {
+		operand := node.Children[0].EdmType
+		switch op {
+		case "not":
+			if !edmTypeAssignable(operand, GoDataBoolean) {
+				return operandTypeError(node)
+			}
+			node.EdmType = GoDataBoolean
+		case "-":
+			if operand != "" && !isNumericEdmType(operand) && operand != GoDataDuration &&
+				isPrimitiveEdmType(operand) {
+				return operandTypeError(node)
+			}
+			node.EdmType = operand
+		}
+		return nil
+	}
+
+	if len(node.Children) != 2 {
+		return nil
+	}
+	left, right := node.Children[0].EdmType, node.Children[1].EdmType
+	unchecked := !isPrimitiveEdmType(left) && left != "" || !isPrimitiveEdmType(right) && right != ""
+
+	switch op {
+	case "and", "or":
+		if !edmTypeAssignable(left, GoDataBoolean) || !edmTypeAssignable(right, GoDataBoolean) {
+			return operandTypeError(node)
+		}
+		node.EdmType = GoDataBoolean
+	case "eq", "ne":
+		if !edmTypesComparable(left, right) {
+			return operandTypeError(node)
+		}
+		node.EdmType = GoDataBoolean
+	case "gt", "ge", "lt", "le":
+		if !edmTypesComparable(left, right) || isSpatialEdmType(left) || isSpatialEdmType(right) {
+			return operandTypeError(node)
+		}
+		node.EdmType = GoDataBoolean
+	case "has":
+		// the operands must be of the same enumeration type
+		if isPrimitiveEdmType(left) || isPrimitiveEdmType(right) ||
+			left != "" && right != "" && left != right {
+			return operandTypeError(node)
+		}
+		node.EdmType = GoDataBoolean
+	case "in":
+		// the right operand is a list or a collection of the type of the left
+		element, isCollection := collectionElementType(right)
+		if right != "" && !isCollection || !edmTypesComparable(left, element) {
+			return operandTypeError(node)
+		}
+		node.EdmType = GoDataBoolean
+	case "isof":
+		node.EdmType = GoDataBoolean
+	case "add", "sub", "mul", "div", "mod":
+		if unchecked {
+			return nil
+		}
+		t, ok := arithmeticEdmType(op, left, right)
+		if !ok {
+			return operandTypeError(node)
+		}
+		node.EdmType = t
+	}
+
+	return nil
+}
+
+// Return the result type of an arithmetic operator applied to operands of the
+// given types, and false if the operator cannot be applied to them.
+func arithmeticEdmType(op, left, right string) (string, bool) {
+	if left == "" || right == "" {
+		// null propagates through arithmetic
+		if left == "" {
+			return right, true
+		}
+		return left, true
+	}
+	if isNumericEdmType(left) && isNumericEdmType(right) {
+		return promoteNumericEdmTypes(left, right), true
+	}
+
+	switch op {
+	case "add":
+		if right == GoDataDuration && (left == GoDataDuration || isTemporalEdmType(left)) {
+			return left, true
+		}
+	case "sub":
+		if right == GoDataDuration && (left == GoDataDuration || isTemporalEdmType(left)) {
+			return left, true
+		}
+		if isTemporalEdmType(left) && isTemporalEdmType(right) {
+			return GoDataDuration, true
+		}
+	case "mul":
+		if left == GoDataDuration && isNumericEdmType(right) {
+			return GoDataDuration, true
+		}
+		if isNumericEdmType(left) && right == GoDataDuration {
+			return GoDataDuration, true
+		}
+	case "div":
+		if left == GoDataDuration && isNumericEdmType(right) {
+			return GoDataDuration, true
+		}
+	}
+
+	return "", false
+}
+
+func operandTypeError(node *ParseNode) error {
+	types := make([]string, len(node.Children))
+	for i, child := range node.Children {
+		types[i] = describeEdmType(child.EdmType)
+	}
+	return BadRequestError("Operator " + node.Token.Value + " cannot be applied to operands of type " +
+		strings.Join(types, " and ") + " in '" + printFilterNode(node, GlobalFilterParser) + "'.")
+}
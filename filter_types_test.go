@@ -0,0 +1,128 @@
+package godata
+
+import (
+	"strings"
+	"testing"
+)
+
+// Parse and semanticize a filter against the Customer entity of the dummy
+// provider.
+func semanticizeCustomerFilter(input string) (*GoDataFilterQuery, error) {
+	service, err := BuildService(&DummyProvider{}, "http://localhost")
+	if err != nil {
+		return nil, err
+	}
+	entity, err := service.LookupEntityType("Customer")
+	if err != nil {
+		return nil, err
+	}
+	filter, err := ParseFilterString(input)
+	if err != nil {
+		return nil, err
+	}
+	return filter, SemanticizeFilterQuery(filter, service, entity)
+}
+
+func TestFilterTypeInference(t *testing.T) {
+	filter, err := semanticizeCustomerFilter("length(Name) add Age gt 5.5 and Name eq 'Bob'")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	and := filter.Tree
+	if and.EdmType != GoDataBoolean {
+		t.Error("Root type is " + and.EdmType)
+	}
+	add := and.Children[0].Children[0]
+	if add.Token.Value != "add" || add.EdmType != GoDataInt32 {
+		t.Error("Type of '" + add.Token.Value + "' is " + add.EdmType + " not " + GoDataInt32)
+	}
+	literal := and.Children[0].Children[1]
+	if literal.EdmType != GoDataDecimal {
+		t.Error("Type of 5.5 is " + literal.EdmType + " not " + GoDataDecimal)
+	}
+	name := and.Children[1].Children[0]
+	if name.EdmType != GoDataString {
+		t.Error("Type of Name is " + name.EdmType + " not " + GoDataString)
+	}
+}
+
+func TestFilterTypeMismatch(t *testing.T) {
+	tests := map[string]string{
+		"Name gt 5":                   "Name gt 5",
+		"year(Name) eq 2000":          "year(Name)",
+		"Age add 1":                   "not a boolean expression",
+		"contains(Name,Age)":          "contains(Name,Age)",
+		"Name eq 'a' and Age":         "Name eq 'a' and Age",
+		"not (Age sub 2) eq 'a'":      "not (Age sub 2)",
+		"Age eq 2015-10-14T23:30:00Z": "Age eq 2015-10-14T23:30:00Z",
+	}
+
+	for input, expected := range tests {
+		_, err := semanticizeCustomerFilter(input)
+		if err == nil {
+			t.Error("Expected an error for " + input)
+			continue
+		}
+		if err.(*GoDataError).ResponseCode != 400 {
+			t.Error("Expected a bad request for " + input)
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Error("Error for " + input + " does not contain '" + expected + "': " + err.Error())
+		}
+	}
+}
+
+func TestFilterTypeCompatible(t *testing.T) {
+	inputs := []string{
+		"Name eq null",
+		"Age eq 2.5",
+		"Age gt 3000000000",
+		"round(Age) eq 3",
+		"cast(Age,Edm.String) eq '3'",
+		"startswith(tolower(Name),'b')",
+	}
+
+	for _, input := range inputs {
+		_, err := semanticizeCustomerFilter(input)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+		}
+	}
+}
+
+func TestFilterEnum(t *testing.T) {
+	filter, err := semanticizeCustomerFilter("Channels has Store.Channels'Phone,Email' and Tier eq Store.Tier'Gold'")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	literal := filter.Tree.Children[0].Children[1]
+	value, ok := literal.Token.SemanticReference.(*GoDataEnumValue)
+	if !ok || value.Value != 3 || value.Type.Name != "Channels" {
+		t.Error("Store.Channels'Phone,Email' is not resolved to the value 3")
+	}
+	if literal.EdmType != "Store.Channels" {
+		t.Error("Type of the literal is " + literal.EdmType)
+	}
+
+	tests := map[string]string{
+		"Tier eq Store.Tier'Platinum'":    "Platinum is not a member of enumeration Tier",
+		"Tier eq Store.Tier'Gold,Silver'": "does not allow combining",
+		"Tier eq Store.Level'Gold'":       "Enum type Store.Level does not exist",
+		"Name has Store.Channels'Email'":  "Name has Store.Channels'Email'",
+		"Channels has Store.Tier'Gold'":   "Channels has Store.Tier'Gold'",
+	}
+	for input, expected := range tests {
+		_, err := semanticizeCustomerFilter(input)
+		if err == nil {
+			t.Error("Expected an error for " + input)
+			continue
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Error("Error for " + input + " does not contain '" + expected + "': " + err.Error())
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package godata
+
+// A provider with complex types, a derived entity type, a chain of navigation
+// properties and bound operations.
+type thingsProvider struct {
+	DummyProvider
+}
+
+func (*thingsProvider) GetMetadata() *GoDataMetadata {
+	return &GoDataMetadata{
+		DataServices: &GoDataServices{
+			Schemas: []*GoDataSchema{
+				{
+					Namespace: "Things",
+					Alias:     "T",
+					EntityTypes: []*GoDataEntityType{
+						{
+							Name: "Thing",
+							Properties: []*GoDataProperty{
+								{Name: "Id", Type: GoDataInt32},
+								{Name: "Name", Type: GoDataString},
+								{Name: "Address", Type: "Things.Address"},
+								{Name: "Tags", Type: "Collection(Edm.String)"},
+								{Name: "Locations", Type: "Collection(Things.Address)"},
+							},
+							NavigationProperties: []*GoDataNavigationProperty{
+								{Name: "Datastreams", Type: "Collection(Things.Datastream)"},
+							},
+						},
+						{
+							Name:     "Sensor",
+							BaseType: "Things.Thing",
+							Properties: []*GoDataProperty{
+								{Name: "Model", Type: GoDataString},
+							},
+						},
+						{
+							Name: "Datastream",
+							Properties: []*GoDataProperty{
+								{Name: "Id", Type: GoDataInt32},
+							},
+							NavigationProperties: []*GoDataNavigationProperty{
+								{Name: "Thing", Type: "Things.Thing"},
+								{Name: "Observations", Type: "Collection(Things.Observation)"},
+							},
+						},
+						{
+							Name: "Observation",
+							Properties: []*GoDataProperty{
+								{Name: "Id", Type: GoDataInt32},
+								{Name: "Result", Type: GoDataDouble},
+							},
+							NavigationProperties: []*GoDataNavigationProperty{
+								{Name: "Previous", Type: "Things.Observation"},
+							},
+						},
+					},
+					ComplexTypes: []*GoDataComplexType{
+						{
+							Name: "Address",
+							Properties: []*GoDataProperty{
+								{Name: "Street", Type: GoDataString},
+								{Name: "City", Type: GoDataString},
+							},
+						},
+					},
+					Actions: []*GoDataAction{
+						{
+							Name:       "Reset",
+							IsBound:    "true",
+							Parameters: []*GoDataParameter{{Name: "thing", Type: "Things.Thing"}},
+						},
+					},
+					Functions: []*GoDataFunction{
+						{
+							Name:       "Calibration",
+							IsBound:    "true",
+							Parameters: []*GoDataParameter{{Name: "sensor", Type: "T.Sensor"}},
+						},
+					},
+					EntityContainers: []*GoDataEntityContainer{
+						{
+							Name: "Container",
+							EntitySets: []*GoDataEntitySet{
+								{Name: "Things", EntityType: "Things.Thing"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
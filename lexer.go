@@ -0,0 +1,651 @@
+package godata
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	GlobalFilterLexer = FilterLexer()
+	GlobalExpandLexer = ExpandLexer()
+	GlobalSearchLexer = SearchLexer()
+)
+
+// A hand-written lexer for one of the query option grammars. It produces the
+// same tokens and errors as the regular expression Tokenizer of the grammar,
+// but scans the input once instead of trying every pattern at every token.
+type Lexer struct {
+	// Returns the end and the type of the token starting at the offset, or an
+	// end of -1 if no token starts there.
+	match func(input string, offset int) (int, int)
+	// Whether single spaces between tokens are skipped.
+	skipSpaces bool
+}
+
+// Create a lexer producing the tokens of FilterTokenizer().
+func FilterLexer() *Lexer {
+	return filterLexer(nil)
+}
+
+// Create a lexer producing the tokens of ExpandTokenizer().
+func ExpandLexer() *Lexer {
+	return &Lexer{match: matchExpandToken}
+}
+
+// Create a lexer producing the tokens of SearchTokenizer().
+func SearchLexer() *Lexer {
+	return &Lexer{match: matchSearchToken, skipSpaces: true}
+}
+
+// A filter lexer that also recognizes the names of custom functions, sorted
+// like the pattern of the service tokenizer.
+func filterLexer(functions []string) *Lexer {
+	return &Lexer{
+		match: func(input string, offset int) (int, int) {
+			for _, name := range functions {
+				if strings.HasPrefix(input[offset:], name) {
+					// only the first matching name is tried
+					if isFunctionCall(input, offset+len(name)) {
+						return offset + len(name), FilterTokenFunc
+					}
+					break
+				}
+			}
+			return matchFilterToken(input, offset)
+		},
+		skipSpaces: true,
+	}
+}
+
+func (l *Lexer) Tokenize(input string) ([]*Token, error) {
+	result := make([]*Token, 0, len(input)/4+1)
+	// tokens are allocated in blocks to save allocations
+	var block []Token
+	i := 0
+	for i < len(input) {
+		end, tokenType := l.match(input, i)
+		if end < 0 && !(l.skipSpaces && input[i] == ' ') {
+			return result, &SyntaxError{i, "No matching token for " + input[i:]}
+		}
+		if end >= 0 {
+			if len(block) == cap(block) {
+				block = make([]Token, 0, 16)
+			}
+			block = append(block, Token{Value: input[i:end], Type: tokenType, Offset: i})
+			result = append(result, &block[len(block)-1])
+			i = end
+		}
+		if l.skipSpaces && i < len(input) && input[i] == ' ' {
+			i++
+		}
+	}
+	return result, nil
+}
+
+func (l *Lexer) TokenizeBytes(input []byte) ([]*Token, error) {
+	return l.Tokenize(string(input))
+}
+
+// Match a token of the filter grammar, trying the patterns of
+// FilterTokenizer() in the same order.
+func matchFilterToken(s string, i int) (int, int) {
+	c := s[i]
+	switch c {
+	case '/':
+		return i + 1, FilterTokenNav
+	case ':':
+		return i + 1, FilterTokenColon
+	case ',':
+		return i + 1, FilterTokenComma
+	case '(':
+		return i + 1, FilterTokenOpenParen
+	case ')':
+		return i + 1, FilterTokenCloseParen
+	case '[':
+		return matchJSONArray(s, i), FilterTokenArray
+	case '\'':
+		return matchQuoted(s, i), FilterTokenString
+	case '@':
+		if i+1 < len(s) && isIdentStart(s[i+1]) {
+			return identEnd(s, i+2), FilterTokenAlias
+		}
+		return -1, 0
+	case '$':
+		if e := matchWord(s, i, "$it"); e >= 0 {
+			return e, FilterTokenIt
+		}
+		if e := matchWord(s, i, "$this"); e >= 0 {
+			return e, FilterTokenThis
+		}
+		return matchWord(s, i, "$root"), FilterTokenRoot
+	}
+
+	if isDigit(c) || c == '-' {
+		if e := matchGuid(s, i); e >= 0 {
+			return e, FilterTokenGuid
+		}
+		if e := matchDateTime(s, i); e >= 0 {
+			return e, FilterTokenDateTime
+		}
+		if e := matchTime(s, i); e >= 0 {
+			return e, FilterTokenTime
+		}
+		if e := matchDate(s, i); e >= 0 {
+			return e, FilterTokenDate
+		}
+		if e := matchWord(s, i, "-INF"); e >= 0 {
+			return e, FilterTokenFloat
+		}
+		if e, t := matchNumber(s, i); e >= 0 || c != '-' {
+			return e, t
+		}
+		// the minus of a negated expression
+		return i + 1, FilterTokenOp
+	}
+	if !isAlpha(c) && c != '_' {
+		return -1, 0
+	}
+
+	// words: guids, enums, functions and keywords before literals
+	if e := matchGuid(s, i); e >= 0 {
+		return e, FilterTokenGuid
+	}
+	if e := matchEnum(s, i); e >= 0 {
+		return e, FilterTokenEnum
+	}
+	if e := matchFunction(s, i, builtinFilterFunctions); e >= 0 {
+		return e, FilterTokenFunc
+	}
+	if e := matchFunction(s, i, spatialFilterFunctions); e >= 0 {
+		return e, FilterTokenFunc
+	}
+	for _, k := range filterKeywords {
+		if e := k.match(s, i); e >= 0 {
+			return e, k.token
+		}
+	}
+	if isAlpha(c) {
+		return identOrDotEnd(s, i+1), FilterTokenLiteral
+	}
+	return -1, 0
+}
+
+// The names of the function pattern of FilterTokenizer() in the order of the
+// alternatives, where a dot matches any character.
+var builtinFilterFunctions = []string{"contains", "endswith", "startswith", "length", "indexof",
+	"substringof", "substring", "tolower", "toupper", "trim", "concat", "year", "month", "day",
+	"hour", "minute", "second", "fractionalseconds", "date", "time", "totaloffsetminutes", "now",
+	"maxdatetime", "mindatetime", "totalseconds", "round", "floor", "ceiling", "isof", "cast",
+	"geo.distance", "geo.intersects", "geo.length"}
+
+var spatialFilterFunctions = []string{"st_disjoint", "st_touches", "st_within", "st_overlaps",
+	"st_crosses", "st_intersects", "st_contains", "st_relate", "st_equals"}
+
+// A keyword pattern of FilterTokenizer() starting with a letter.
+type filterKeyword struct {
+	token int
+	match func(s string, i int) int
+}
+
+var filterKeywords = []filterKeyword{
+	{FilterTokenGeography, func(s string, i int) int { return matchWord(s, i, "geography") }},
+	{FilterTokenGeometry, func(s string, i int) int { return matchWord(s, i, "geometry") }},
+	{FilterTokenDuration, func(s string, i int) int { return matchPrefixedQuote(s, i, "duration") }},
+	{FilterTokenBinary, func(s string, i int) int { return matchPrefixedQuote(s, i, "binary") }},
+	{FilterTokenLogical, func(s string, i int) int {
+		return matchWords(s, i, "eq", "ne", "gt", "ge", "lt", "le", "and", "or", "not", "has", "in")
+	}},
+	{FilterTokenOp, func(s string, i int) int { return matchWords(s, i, "add", "sub", "mul", "div", "mod") }},
+	{FilterTokenLambda, func(s string, i int) int { return matchWords(s, i, "any", "all") }},
+	{FilterTokenNull, func(s string, i int) int { return matchWord(s, i, "null") }},
+	{FilterTokenBoolean, func(s string, i int) int { return matchWords(s, i, "true", "false") }},
+	{FilterTokenFloat, func(s string, i int) int { return matchWords(s, i, "NaN", "INF") }},
+}
+
+// Match a token of the expand grammar, trying the patterns of
+// ExpandTokenizer() in the same order.
+func matchExpandToken(s string, i int) (int, int) {
+	switch s[i] {
+	case '(':
+		return i + 1, ExpandTokenOpenParen
+	case ')':
+		return i + 1, ExpandTokenCloseParen
+	case '/':
+		return i + 1, ExpandTokenNav
+	case ',':
+		return i + 1, ExpandTokenComma
+	case ';':
+		return i + 1, ExpandTokenSemicolon
+	case '=':
+		return i + 1, ExpandTokenEquals
+	case '\'':
+		if e := matchQuoted(s, i); e >= 0 {
+			return e, ExpandTokenString
+		}
+	}
+	// the Tokenizer applies the check for a function call to every token
+	// type with the value of FilterTokenFunc, which date times have in $expand
+	if e := matchDateTime(s, i); e >= 0 && isFunctionCall(s, e) {
+		return e, ExpandTokenDateTime
+	}
+	if e := matchTime(s, i); e >= 0 {
+		return e, ExpandTokenTime
+	}
+	if e := matchDate(s, i); e >= 0 {
+		return e, ExpandTokenDate
+	}
+	e := i
+	for e < len(s) && isExpandLiteralChar(s[e]) {
+		e++
+	}
+	if e == i {
+		return -1, 0
+	}
+	return e, ExpandTokenLiteral
+}
+
+func isExpandLiteralChar(c byte) bool {
+	return isWordChar(c) || strings.IndexByte("'.:$ *@[]\"", c) >= 0
+}
+
+// Match a token of the search grammar, trying the patterns of
+// SearchTokenizer() in the same order.
+func matchSearchToken(s string, i int) (int, int) {
+	switch s[i] {
+	case '"':
+		return matchPhrase(s, i), SearchTokenLiteral
+	case '(':
+		return i + 1, SearchTokenOpenParen
+	case ')':
+		return i + 1, SearchTokenCloseParen
+	}
+	for _, op := range []string{"OR", "AND", "NOT"} {
+		if e := i + len(op); strings.HasPrefix(s[i:], op) && (e == len(s) || !isWordChar(s[e])) {
+			return e, SearchTokenOp
+		}
+	}
+	e := i
+	for e < len(s) && strings.IndexByte(" ()\"", s[e]) < 0 {
+		e++
+	}
+	if e == i {
+		return -1, 0
+	}
+	return e, SearchTokenLiteral
+}
+
+// Match a non-empty phrase in double quotes, where a backslash escapes a
+// double quote or a backslash.
+func matchPhrase(s string, i int) int {
+	for e := i + 1; e < len(s); e++ {
+		switch s[e] {
+		case '"':
+			if e == i+1 {
+				return -1
+			}
+			return e + 1
+		case '\\':
+			if e+1 == len(s) || (s[e+1] != '"' && s[e+1] != '\\') {
+				return -1
+			}
+			e++
+		}
+	}
+	return -1
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isHex(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func isIdentStart(c byte) bool {
+	return isAlpha(c) || c == '_'
+}
+
+// The characters of \w, used by \b.
+func isWordChar(c byte) bool {
+	return isAlpha(c) || isDigit(c) || c == '_'
+}
+
+// Whether a word ending at i is followed by a word boundary.
+func isWordEnd(s string, i int) bool {
+	return i >= len(s) || !isWordChar(s[i])
+}
+
+func isFunctionCall(s string, i int) bool {
+	return i < len(s) && s[i] == '('
+}
+
+func identEnd(s string, i int) int {
+	for i < len(s) && isWordChar(s[i]) {
+		i++
+	}
+	return i
+}
+
+func identOrDotEnd(s string, i int) int {
+	for i < len(s) && (isWordChar(s[i]) || s[i] == '.') {
+		i++
+	}
+	return i
+}
+
+func digitsEnd(s string, i int) int {
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return i
+}
+
+// Match exactly n characters of a class.
+func matchClass(s string, i, n int, class func(byte) bool) int {
+	if i+n > len(s) {
+		return -1
+	}
+	for k := i; k < i+n; k++ {
+		if !class(s[k]) {
+			return -1
+		}
+	}
+	return i + n
+}
+
+// Match digit groups separated by a character, e.g. 4, 2 and 2 digits
+// separated by '-' for a date.
+func matchDigitGroups(s string, i int, sep byte, groups ...int) int {
+	for n, count := range groups {
+		if n > 0 {
+			if i >= len(s) || s[i] != sep {
+				return -1
+			}
+			i++
+		}
+		if i = matchClass(s, i, count, isDigit); i < 0 {
+			return -1
+		}
+	}
+	return i
+}
+
+// Match a word followed by a word boundary.
+func matchWord(s string, i int, word string) int {
+	if strings.HasPrefix(s[i:], word) && isWordEnd(s, i+len(word)) {
+		return i + len(word)
+	}
+	return -1
+}
+
+// Match the first of the words followed by a word boundary, like (a|b)\b.
+func matchWords(s string, i int, words ...string) int {
+	for _, word := range words {
+		if e := matchWord(s, i, word); e >= 0 {
+			return e
+		}
+	}
+	return -1
+}
+
+// Match the first function name, where a dot matches any character but a
+// newline, that is followed by a paren.
+func matchFunction(s string, i int, names []string) int {
+	for _, name := range names {
+		e := i
+		for k := 0; k < len(name) && e >= 0; k++ {
+			switch {
+			case e >= len(s):
+				e = -1
+			case name[k] == '.':
+				r, w := utf8.DecodeRuneInString(s[e:])
+				if r == '\n' {
+					e = -1
+				} else {
+					e += w
+				}
+			case s[e] == name[k]:
+				e++
+			default:
+				e = -1
+			}
+		}
+		if e >= 0 {
+			// only the first matching alternative is tried
+			if isFunctionCall(s, e) {
+				return e
+			}
+			return -1
+		}
+	}
+	return -1
+}
+
+// Match a quoted literal in which a quote is escaped by doubling it. Like
+// the regular expression, an unterminated literal ends at its last escaped
+// quote, if any.
+func matchQuoted(s string, i int) int {
+	lastPair := -1
+	for k := i + 1; k < len(s); k++ {
+		if s[k] != '\'' {
+			continue
+		}
+		if k+1 < len(s) && s[k+1] == '\'' {
+			lastPair = k
+			k++
+			continue
+		}
+		return k + 1
+	}
+	if lastPair >= 0 {
+		return lastPair + 1
+	}
+	return -1
+}
+
+// Match a case insensitive prefix followed by a quoted value without escaped
+// quotes, like (?i:duration)'[^']*'.
+func matchPrefixedQuote(s string, i int, prefix string) int {
+	e := i + len(prefix)
+	if e >= len(s) || !strings.EqualFold(s[i:e], prefix) || s[e] != '\'' {
+		return -1
+	}
+	end := strings.IndexByte(s[e+1:], '\'')
+	if end < 0 {
+		return -1
+	}
+	return e + end + 2
+}
+
+// Match a JSON array, like \[("(\\.|[^"\\])*"|[^\]"])*\].
+func matchJSONArray(s string, i int) int {
+	for k := i + 1; k < len(s); k++ {
+		switch s[k] {
+		case ']':
+			return k + 1
+		case '"':
+			k++
+			for ; k < len(s) && s[k] != '"'; k++ {
+				if s[k] == '\\' {
+					if k+1 >= len(s) || s[k+1] == '\n' {
+						return -1
+					}
+					k++
+				}
+			}
+			if k >= len(s) {
+				return -1
+			}
+		}
+	}
+	return -1
+}
+
+func matchGuid(s string, i int) int {
+	e := i
+	for n, count := range []int{8, 4, 4, 4, 12} {
+		if n > 0 {
+			if e >= len(s) || s[e] != '-' {
+				return -1
+			}
+			e++
+		}
+		if e = matchClass(s, e, count, isHex); e < 0 {
+			return -1
+		}
+	}
+	if !isWordEnd(s, e) {
+		return -1
+	}
+	return e
+}
+
+// Match a date, like -?[0-9]{4}-[0-9]{2}-[0-9]{2}.
+func matchDate(s string, i int) int {
+	if s[i] == '-' {
+		i++
+	}
+	return matchDigitGroups(s, i, '-', 4, 2, 2)
+}
+
+func matchDateTime(s string, i int) int {
+	e := matchDigitGroups(s, i, '-', 4, 2, 2)
+	if e < 0 || e >= len(s) || s[e] != 'T' {
+		return -1
+	}
+	if e = matchDigitGroups(s, e+1, ':', 2, 2); e < 0 {
+		return -1
+	}
+	return matchSeconds(s, e, true)
+}
+
+func matchTime(s string, i int) int {
+	e := matchDigitGroups(s, i, ':', 2, 2)
+	if e < 0 {
+		return -1
+	}
+	return matchSeconds(s, e, false)
+}
+
+// Match the optional seconds and fractional seconds of a time, like
+// (:[0-9]{2}(.[0-9]+)?)?, and a required time zone if zone is set. The
+// longest alternative is tried first; the dot matches any character.
+func matchSeconds(s string, i int, zone bool) int {
+	end := func(e int) int {
+		if zone {
+			return matchZone(s, e)
+		}
+		return e
+	}
+	if i+3 <= len(s) && s[i] == ':' && isDigit(s[i+1]) && isDigit(s[i+2]) {
+		e := i + 3
+		if e < len(s) {
+			if r, w := utf8.DecodeRuneInString(s[e:]); r != '\n' {
+				for k := digitsEnd(s, e+w); k > e+w; k-- {
+					if m := end(k); m >= 0 {
+						return m
+					}
+				}
+			}
+		}
+		if m := end(e); m >= 0 {
+			return m
+		}
+	}
+	return end(i)
+}
+
+// Match a time zone, like (Z|[+-][0-9]{2}:[0-9]{2}).
+func matchZone(s string, i int) int {
+	if i >= len(s) {
+		return -1
+	}
+	switch s[i] {
+	case 'Z':
+		return i + 1
+	case '+', '-':
+		return matchDigitGroups(s, i+1, ':', 2, 2)
+	}
+	return -1
+}
+
+// Match an enumeration literal, like Namespace.Type'Member'.
+func matchEnum(s string, i int) int {
+	e := identEnd(s, i+1)
+	segments := 0
+	for e+1 < len(s) && s[e] == '.' && isIdentStart(s[e+1]) {
+		e = identEnd(s, e+2)
+		segments++
+	}
+	if segments == 0 || e >= len(s) || s[e] != '\'' {
+		return -1
+	}
+	end := strings.IndexByte(s[e+1:], '\'')
+	if end < 0 {
+		return -1
+	}
+	return e + end + 2
+}
+
+// Match a float or an integer, trying the number patterns of
+// FilterTokenizer() in order.
+func matchNumber(s string, i int) (int, int) {
+	if s[i] == '-' {
+		i++
+	}
+	digits := digitsEnd(s, i)
+	if digits == i {
+		return -1, 0
+	}
+
+	// -?[0-9]+(\.[0-9]+([eE][+-]?[0-9]+)?|[eE][+-]?[0-9]+)[mMdDfF]?\b
+	e := -1
+	if digits+1 < len(s) && s[digits] == '.' && isDigit(s[digits+1]) {
+		e = digitsEnd(s, digits+1)
+		if x := matchExponent(s, e); x >= 0 {
+			e = x
+		}
+	} else {
+		e = matchExponent(s, digits)
+	}
+	if e >= 0 {
+		if e < len(s) && strings.IndexByte("mMdDfF", s[e]) >= 0 && isWordEnd(s, e+1) {
+			return e + 1, FilterTokenFloat
+		}
+		if isWordEnd(s, e) {
+			return e, FilterTokenFloat
+		}
+	}
+
+	// -?[0-9]+[mMdDfF]\b
+	if digits < len(s) && strings.IndexByte("mMdDfF", s[digits]) >= 0 && isWordEnd(s, digits+1) {
+		return digits + 1, FilterTokenFloat
+	}
+
+	// -?[0-9]+([lL]\b)?
+	if digits < len(s) && (s[digits] == 'l' || s[digits] == 'L') && isWordEnd(s, digits+1) {
+		return digits + 1, FilterTokenInteger
+	}
+	return digits, FilterTokenInteger
+}
+
+// Match an exponent, like [eE][+-]?[0-9]+.
+func matchExponent(s string, i int) int {
+	if i >= len(s) || s[i] != 'e' && s[i] != 'E' {
+		return -1
+	}
+	i++
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		i++
+	}
+	e := digitsEnd(s, i)
+	if e == i {
+		return -1
+	}
+	return e
+}
@@ -0,0 +1,169 @@
+package godata
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// Compare the tokens and the error of a lexer with those of the regular
+// expression tokenizer of the same grammar.
+func compareLexer(t *testing.T, grammar string, tokenizer *Tokenizer, lexer *Lexer, input string) {
+	expected, expectedErr := tokenizer.Tokenize(input)
+	actual, actualErr := lexer.Tokenize(input)
+	if (expectedErr == nil) != (actualErr == nil) ||
+		expectedErr != nil && expectedErr.Error() != actualErr.Error() {
+		t.Errorf("%s %q: error %v, not %v", grammar, input, actualErr, expectedErr)
+		return
+	}
+	if len(actual) != len(expected) {
+		t.Errorf("%s %q: %d tokens, not %d", grammar, input, len(actual), len(expected))
+		return
+	}
+	for i := range expected {
+		if *actual[i] != *expected[i] {
+			t.Errorf("%s %q: token %+v, not %+v", grammar, input, *actual[i], *expected[i])
+			return
+		}
+	}
+}
+
+var lexerTestInputs = []string{
+	"Name eq 'Milk' and Price lt 2.55",
+	"not endswith(Name,'ilk') or substringof('a',Name)",
+	"Tags/any(d:d/Key eq 'Site' and $it/Price gt 2) and $root/People/$count gt 1",
+	"$this eq 'a' or $this/City ne $thisx and $thi eq 1",
+	"Released lt 2015-10-15 and Released ge 2015-10-14T23:30:00Z and hour(Released) le 10:30:15.123",
+	"Time eq 2015-10-14T23:30:00.5+01:00 or Time eq 2015-10-14T23:30:00.5 or 2015-10-14T23:30",
+	"Id eq 01234567-89ab-cdef-0123-456789abcdef or Id eq 01234567-89ab-cdef-0123-456789abcdefx",
+	"Tier eq Store.Tier'Gold' and Channels has Store.Channels'Email,Phone' and A.b'",
+	"Price in (1,2.5,3e10,-4E-2,5.5M,6d,7L,8l,9f,-INF,INF,NaN,NaNx,INFy) and x eq 1.5fx",
+	"geo.distance(location,geography'POINT(1 2)') lt 5 and geo_distance(x) and geoXlength(y)",
+	"st_within(location,geometry'POLYGON((0 0,1 1))') and geography eq 1 and geometryx eq 2",
+	"Duration eq duration'P1D' and DURATION'PT1H' eq Binary'AQID' and binary'x",
+	"Name in [\"a\",\"b\\\"]\",1] and Name in [\"open and [1,[2]]",
+	"Name eq 'it''s' and Name eq 'unterminated'' and x",
+	"Name eq @alias and @ eq 1 and @_x eq null and true eq false",
+	"substring(Name,1) eq 'ilk' and substringof(Name) and timex(1) and time(1) and date(x) and day(x)",
+	"Name eq 'a' and  Name ne 'b'",
+	"indexof(Name,'lk') eq 2 mod 3 div 1 mul 4 add 5 sub -6",
+	"1.5.2 eq x",
+	"x eq 10:00:0012 and y eq 10:00:00\n5",
+	"_x eq 1 and __ eq 2",
+	"Name eq 'é' and Näme eq 1",
+	"Name eq #",
+	"",
+	" ",
+	"Orders($filter=Id eq 'a';$top=1;$expand=Customer($levels=2)),Items/Details",
+	"Observations($filter=phenomenonTime gt 2020-01-01T10:00:00Z and resultTime lt 2020-01-01T10:00:00Z(1))",
+	"*,Orders($select=Id,Name;$orderby=Name desc;$search=\"red blue\")",
+	"red AND blue OR NOT green",
+	"\"red blue\" AND (green OR ORANGE)",
+	"\"\" AND \"open",
+	"red  AND blue",
+	"red-blue",
+}
+
+var lexerTestFragments = []string{
+	"2020-01-01", "T", "10:00", ":00", ".5", ".", "Z", "+01:00", "-", "'", "''", "\"", "[", "]", "\\",
+	"(", ")", "eq", "in", "not", "geo.distance", "geoXdistance", "substring", "of", "st_equals",
+	"NaN", "INF", "1", "23", "e", "E", "+", "f", "L", "l", "d", "M", "_", "@", "$it", "$root", "$this", "$",
+	"a", "Ns.Color", "duration", "DURATION", "binary", " ", ",", "/", ";", "=", "*", ":", "é",
+	"\n", "\xff", "deadbeef-0000-1111-2222-333344445555", "OR", "AND", "NOT", "geography",
+	"geometry", "true", "null", "any", "custom", "custom_fn", "custom.x", "x",
+	"\\\"", "ORange", "-x", "AND-",
+}
+
+func lexerTestCorpus() []string {
+	corpus := append([]string{}, lexerTestInputs...)
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		var b strings.Builder
+		for n := random.Intn(8) + 1; n > 0; n-- {
+			b.WriteString(lexerTestFragments[random.Intn(len(lexerTestFragments))])
+		}
+		corpus = append(corpus, b.String())
+	}
+	return corpus
+}
+
+func TestLexerMatchesTokenizer(t *testing.T) {
+	service, err := BuildService(&DummyProvider{}, "http://localhost")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, name := range []string{"custom", "custom_fn", "custom.x"} {
+		if err := service.DefineFilterFunction(name, nil, GoDataBoolean, GoDataString); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	for _, input := range lexerTestCorpus() {
+		compareLexer(t, "filter", GlobalFilterTokenizer, GlobalFilterLexer, input)
+		compareLexer(t, "custom filter", service.FilterTokenizer, service.filterLexer(), input)
+		compareLexer(t, "expand", GlobalExpandTokenizer, GlobalExpandLexer, input)
+		compareLexer(t, "search", GlobalSearchTokenizer, GlobalSearchLexer, input)
+		if t.Failed() {
+			return
+		}
+	}
+}
+
+const benchmarkFilter = "Datastreams/any(d:d/ObservedProperty/name eq 'temperature') and " +
+	"phenomenonTime ge 2020-06-01T00:00:00Z and result gt 21.5 and " +
+	"st_within(location,geography'POLYGON((7 51,8 51,8 52,7 52,7 51))')"
+
+const benchmarkExpand = "Datastreams($filter=name eq 'a';$top=10;$expand=Observations($orderby=phenomenonTime desc;$top=1)),Locations"
+
+func BenchmarkSensorThingsFilterTokenizer(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := GlobalFilterTokenizer.Tokenize(benchmarkFilter); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSensorThingsFilterLexer(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := GlobalFilterLexer.Tokenize(benchmarkFilter); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExpandTokenizer(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := GlobalExpandTokenizer.Tokenize(benchmarkExpand); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExpandLexer(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := GlobalExpandLexer.Tokenize(benchmarkExpand); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSearchTokenizer(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := GlobalSearchTokenizer.Tokenize("\"red blue\" AND (green OR NOT yellow)"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSearchLexer(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := GlobalSearchLexer.Tokenize("\"red blue\" AND (green OR NOT yellow)"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package godata
+
+import (
+	"strconv"
+)
+
+// Limits on the complexity of the requests a service accepts, to protect
+// providers from queries that are expensive to parse or to execute. Requests
+// exceeding a limit are rejected with a 400. A limit of zero is not enforced.
+type QueryLimits struct {
+	// The maximum length of the path and the encoded query string.
+	MaxURLLength int
+	// The maximum number of nodes and the maximum depth of the parse tree of
+	// a $filter, including the filters of expanded items. They also limit the
+	// expressions of an $orderby and of an $apply, where each transformation
+	// counts as a node and nested transformations add to the depth.
+	MaxFilterNodes int
+	MaxFilterDepth int
+	// The maximum nesting of $expand, where $levels counts as that many
+	// nested expands, and the maximum number of items of a single $expand.
+	MaxExpandDepth int
+	MaxExpandItems int
+	// The maximum value of $top, including the $top of expanded items.
+	MaxTop int
+	// The maximum value of $levels in $expand, and the depth $levels=max
+	// expands to.
+	MaxLevels int
+	// The maximum number of terms and phrases of a $search.
+	MaxSearchTerms int
+}
+
+// The limits of a new service. They allow any reasonable query, but no $top
+// limit is set since the page size is up to the provider.
+func DefaultQueryLimits() *QueryLimits {
+	return &QueryLimits{
+		MaxURLLength:   8192,
+		MaxFilterNodes: 1000,
+		MaxFilterDepth: 100,
+		MaxExpandDepth: 10,
+		MaxExpandItems: 50,
+		MaxLevels:      10,
+		MaxSearchTerms: 100,
+	}
+}
+
+// The limits of the service. A nil service has no limits.
+func (service *GoDataService) limits() *QueryLimits {
+	if service == nil || service.Limits == nil {
+		return &QueryLimits{}
+	}
+	return service.Limits
+}
+
+func exceedsLimit(value, limit int) bool {
+	return limit > 0 && value > limit
+}
+
+func limitError(what string, limit int) error {
+	return BadRequestError("The " + what + " exceeds the limit of " + strconv.Itoa(limit) + ".")
+}
+
+// Check the length of the request URL.
+func (l *QueryLimits) checkURL(path, query string) error {
+	if exceedsLimit(len(path)+len(query), l.MaxURLLength) {
+		return limitError("request URL", l.MaxURLLength)
+	}
+	return nil
+}
+
+// Check the parsed query options of a request.
+func (l *QueryLimits) checkQuery(query *GoDataQuery) error {
+	if err := l.checkFilter(query.Filter); err != nil {
+		return err
+	}
+	if err := l.checkTop(query.Top); err != nil {
+		return err
+	}
+	if err := l.checkSearch(query.Search); err != nil {
+		return err
+	}
+	if err := l.checkOrderBy(query.OrderBy); err != nil {
+		return err
+	}
+	if err := l.checkApply(query.Apply); err != nil {
+		return err
+	}
+	return l.checkExpand(query.Expand)
+}
+
+// Check the number of nodes and the depth of the expressions of an option.
+func (l *QueryLimits) checkSize(option string, nodes, depth int) error {
+	if exceedsLimit(nodes, l.MaxFilterNodes) {
+		return limitError(option+" with "+strconv.Itoa(nodes)+" nodes", l.MaxFilterNodes)
+	}
+	if exceedsLimit(depth, l.MaxFilterDepth) {
+		return limitError(option+" nested "+strconv.Itoa(depth)+" levels deep", l.MaxFilterDepth)
+	}
+	return nil
+}
+
+func (l *QueryLimits) checkFilter(filter *GoDataFilterQuery) error {
+	if filter == nil || filter.Tree == nil {
+		return nil
+	}
+	nodes, depth := parseTreeSize(filter.Tree)
+	return l.checkSize("$filter", nodes, depth)
+}
+
+// Check the expressions of the orderby items together.
+func (l *QueryLimits) checkOrderBy(orderby *GoDataOrderByQuery) error {
+	if orderby == nil {
+		return nil
+	}
+	nodes, depth := 0, 0
+	for _, item := range orderby.OrderByItems {
+		if item.Tree == nil {
+			continue
+		}
+		n, d := parseTreeSize(item.Tree)
+		nodes += n
+		if d > depth {
+			depth = d
+		}
+	}
+	return l.checkSize("$orderby", nodes, depth)
+}
+
+func (l *QueryLimits) checkApply(apply *GoDataApplyQuery) error {
+	if apply == nil {
+		return nil
+	}
+	nodes, depth := applySize(apply)
+	return l.checkSize("$apply", nodes, depth)
+}
+
+func (l *QueryLimits) checkTop(top *GoDataTopQuery) error {
+	if top != nil && exceedsLimit(int(*top), l.MaxTop) {
+		return limitError("$top of "+strconv.Itoa(int(*top)), l.MaxTop)
+	}
+	return nil
+}
+
+func (l *QueryLimits) checkSearch(search *GoDataSearchQuery) error {
+	if search == nil || search.Tree == nil {
+		return nil
+	}
+	terms := 0
+	var count func(*ParseNode)
+	count = func(node *ParseNode) {
+		if len(node.Children) == 0 {
+			terms++
+		}
+		for _, child := range node.Children {
+			count(child)
+		}
+	}
+	count(search.Tree)
+	if exceedsLimit(terms, l.MaxSearchTerms) {
+		return limitError("$search with "+strconv.Itoa(terms)+" terms", l.MaxSearchTerms)
+	}
+	return nil
+}
+
+func (l *QueryLimits) checkLevels(levels int) error {
+	if exceedsLimit(levels, l.MaxLevels) {
+		return limitError("$levels of "+strconv.Itoa(levels), l.MaxLevels)
+	}
+	return nil
+}
+
+// The depth of the expand tree $levels=max expands to, the MaxLevels limit or
+// the default if there is none, but no deeper than MaxExpandDepth.
+func (l *QueryLimits) maxLevels() int {
+	levels := l.MaxLevels
+	if levels <= 0 {
+		levels = DefaultQueryLimits().MaxLevels
+	}
+	if l.MaxExpandDepth > 0 && l.MaxExpandDepth < levels {
+		levels = l.MaxExpandDepth
+	}
+	return levels
+}
+
+// Check the expand items and the options of the expanded items.
+func (l *QueryLimits) checkExpand(expand *GoDataExpandQuery) error {
+	if expand == nil {
+		return nil
+	}
+	// the items first, so a $levels over its limit is reported as such
+	if err := l.checkExpandItems(expand); err != nil {
+		return err
+	}
+	if depth := expandDepth(expand); exceedsLimit(depth, l.MaxExpandDepth) {
+		return limitError("$expand nested "+strconv.Itoa(depth)+" levels deep", l.MaxExpandDepth)
+	}
+	return nil
+}
+
+func (l *QueryLimits) checkExpandItems(expand *GoDataExpandQuery) error {
+	if expand == nil {
+		return nil
+	}
+	if exceedsLimit(len(expand.ExpandItems), l.MaxExpandItems) {
+		return limitError("$expand with "+strconv.Itoa(len(expand.ExpandItems))+" items", l.MaxExpandItems)
+	}
+	for _, item := range expand.ExpandItems {
+		if err := l.checkLevels(item.Levels); err != nil {
+			return err
+		}
+		if err := l.checkFilter(item.Filter); err != nil {
+			return err
+		}
+		if err := l.checkTop(item.Top); err != nil {
+			return err
+		}
+		if err := l.checkSearch(item.Search); err != nil {
+			return err
+		}
+		if err := l.checkOrderBy(item.OrderBy); err != nil {
+			return err
+		}
+		if err := l.checkExpandItems(item.Expand); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The number of nodes of a parse tree and its depth.
+func parseTreeSize(node *ParseNode) (int, int) {
+	nodes, depth := 1, 0
+	for _, child := range node.Children {
+		n, d := parseTreeSize(child)
+		nodes += n
+		if d > depth {
+			depth = d
+		}
+	}
+	return nodes, depth + 1
+}
+
+// The number of nodes of the transformations of an apply and their
+// expressions, and the depth of the deepest expression below the nested
+// transformations.
+func applySize(apply *GoDataApplyQuery) (int, int) {
+	nodes, depth := 0, 0
+	add := func(n, d int) {
+		nodes += n
+		if d > depth {
+			depth = d
+		}
+	}
+	for _, t := range apply.Transformations {
+		add(1, 1)
+		trees := []*ParseNode{t.Expression}
+		for _, aggregate := range t.Aggregates {
+			trees = append(trees, aggregate.Expression)
+		}
+		for _, compute := range t.Computes {
+			trees = append(trees, compute.Expression)
+		}
+		if t.Filter != nil {
+			trees = append(trees, t.Filter.Tree)
+		}
+		if t.Search != nil {
+			trees = append(trees, t.Search.Tree)
+		}
+		if t.OrderBy != nil {
+			for _, item := range t.OrderBy.OrderByItems {
+				trees = append(trees, item.Tree)
+			}
+		}
+		if t.Expand != nil {
+			trees = append(trees, expandFilterTrees(t.Expand)...)
+		}
+		for _, tree := range trees {
+			if tree != nil {
+				n, d := parseTreeSize(tree)
+				add(n, d+1)
+			}
+		}
+		for _, nested := range append([]*GoDataApplyQuery{t.Apply}, t.Sequences...) {
+			if nested != nil {
+				n, d := applySize(nested)
+				add(n, d+1)
+			}
+		}
+	}
+	return nodes, depth
+}
+
+// The filter trees of an expand item of an apply and its nested expands.
+func expandFilterTrees(item *ExpandItem) []*ParseNode {
+	var trees []*ParseNode
+	if item.Filter != nil {
+		trees = append(trees, item.Filter.Tree)
+	}
+	if item.Expand != nil {
+		for _, nested := range item.Expand.ExpandItems {
+			trees = append(trees, expandFilterTrees(nested)...)
+		}
+	}
+	return trees
+}
+
+// The number of navigation properties expanded into each other.
+func expandDepth(expand *GoDataExpandQuery) int {
+	result := 0
+	for _, item := range expand.ExpandItems {
+		depth := len(item.Path)
+		if item.Levels > 1 {
+			depth += item.Levels - 1
+		}
+		if item.Expand != nil {
+			depth += expandDepth(item.Expand)
+		}
+		if depth > result {
+			result = depth
+		}
+	}
+	return result
+}
@@ -0,0 +1,93 @@
+package godata
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestQueryLimits(t *testing.T) {
+	service, err := BuildService(&DummyProvider{}, "http://localhost")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	service.Limits = &QueryLimits{
+		MaxURLLength:   200,
+		MaxFilterNodes: 7,
+		MaxFilterDepth: 3,
+		MaxExpandDepth: 3,
+		MaxExpandItems: 2,
+		MaxTop:         100,
+		MaxLevels:      2,
+		MaxSearchTerms: 2,
+	}
+
+	tests := map[string]string{
+		"$filter=Name eq 'Bob' and Age gt 1":                 "",
+		"$filter=Name eq 'Bob' and Age gt 1 and Age lt 9":    "$filter with 11 nodes exceeds the limit of 7",
+		"$filter=length(trim(tolower(Name))) eq 1":           "$filter nested 5 levels deep",
+		"$filter=Name eq '" + strings.Repeat("x", 200) + "'": "request URL exceeds the limit of 200",
+		"$top=100":                  "",
+		"$top=101":                  "$top of 101 exceeds the limit of 100",
+		"$expand=Orders($top=1000)": "$top of 1000",
+		"$expand=Orders($filter=Id eq 'a' or Id eq 'b' or Id eq 'c')":        "$filter with 11 nodes",
+		"$expand=Orders($expand=Customer)":                                   "",
+		"$expand=Orders($expand=Customer($expand=Orders($expand=Customer)))": "$expand nested 4 levels deep exceeds the limit of 3",
+		"$expand=Orders($levels=2)":                                          "",
+		"$expand=Orders($levels=3)":                                          "$levels of 3",
+		"$expand=Orders($levels=2;$expand=Customer($expand=Orders))":         "$expand nested 4",
+		"$expand=Orders,Customer,Orders":                                     "$expand with 3 items exceeds the limit of 2",
+		"$expand=Orders($expand=A,B,C)":                                      "$expand with 3 items",
+		"$search=red AND blue":                                               "",
+		"$search=red AND blue AND green":                                     "$search with 3 terms exceeds the limit of 2",
+		"$expand=Orders($levels=100)":                                        "$levels of 100 exceeds the limit of 2",
+		"$orderby=Name,Age desc":                                             "",
+		"$orderby=Age add 1,Age add 2,Age add 3":                             "$orderby with 9 nodes exceeds the limit of 7",
+		"$orderby=length(trim(tolower(Name)))":                               "$orderby nested 4 levels deep exceeds the limit of 3",
+		"$expand=Orders($orderby=length(trim(tolower(Id))))":                 "$orderby nested 4 levels deep",
+		"$apply=filter(Age gt 1)/aggregate(Age with sum as Total)":           "",
+		"$apply=filter(Age gt 1)/filter(Age lt 9)/filter(Name eq 'a')":       "$apply with 12 nodes exceeds the limit of 7",
+		"$apply=groupby((Name),groupby((Age),aggregate(Age with sum as T)))": "$apply nested 4 levels deep exceeds the limit of 3",
+		"$apply=concat(identity,concat(identity,filter(Age)))":               "$apply nested 4 levels deep",
+	}
+	for input, expected := range tests {
+		option, value, _ := strings.Cut(input, "=")
+		_, err := service.ParseRequest("Customers", url.Values{option: {value}})
+		if expected == "" {
+			if err != nil {
+				t.Error(input + ": " + err.Error())
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected an error '%s' for %s, got %v", expected, input, err)
+			continue
+		}
+		if gdErr, ok := err.(*GoDataError); !ok || gdErr.ResponseCode != 400 {
+			t.Errorf("Expected a bad request for %s, got %#v", input, err)
+		}
+	}
+
+	// requests without a service are not limited
+	if _, err := ParseRequest("Customers", url.Values{"$top": {"1000"}}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestQueryLimitsLevels(t *testing.T) {
+	service, err := BuildService(&DummyProvider{}, "http://localhost")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expand := &GoDataExpandQuery{[]*ExpandItem{{
+		Path:   []*Token{{Value: "Orders", Type: ExpandTokenLiteral}},
+		Levels: 1000,
+	}}}
+	entity, _ := service.LookupEntityType("Customer")
+	err = SemanticizeExpandQuery(expand, service, entity)
+	if err == nil || !strings.Contains(err.Error(), "$levels of 1000 exceeds the limit of 10") {
+		t.Errorf("Expected the default $levels limit, got %v", err)
+	}
+}
@@ -2,19 +2,29 @@ package godata
 
 import (
 	"encoding/xml"
+	"strconv"
+	"strings"
 )
 
 const (
 	GoDataString         = "Edm.String"
+	GoDataByte           = "Edm.Byte"
+	GoDataSByte          = "Edm.SByte"
 	GoDataInt16          = "Edm.Int16"
 	GoDataInt32          = "Edm.Int32"
 	GoDataInt64          = "Edm.Int64"
 	GoDataDecimal        = "Edm.Decimal"
+	GoDataSingle         = "Edm.Single"
+	GoDataDouble         = "Edm.Double"
 	GoDataBinary         = "Edm.Binary"
 	GoDataBoolean        = "Edm.Boolean"
+	GoDataGuid           = "Edm.Guid"
 	GoDataTimeOfDay      = "Edm.TimeOfDay"
 	GoDataDate           = "Edm.Date"
 	GoDataDateTimeOffset = "Edm.DateTimeOffset"
+	GoDataDuration       = "Edm.Duration"
+	GoDataGeography      = "Edm.Geography"
+	GoDataGeometry       = "Edm.Geometry"
 )
 
 type GoDataMetadata struct {
@@ -137,6 +147,83 @@ type GoDataEnumType struct {
 	Members        []*GoDataMember
 }
 
+// Get the value of the member of the enumeration with the given name. Members
+// without an explicit value are numbered by their position, or get the next
+// bit for flags.
+func (enum *GoDataEnumType) MemberValue(name string) (int64, bool) {
+	for i, member := range enum.Members {
+		if member.Name != name {
+			continue
+		}
+		if member.Value != "" {
+			v, err := strconv.ParseInt(member.Value, 10, 64)
+			return v, err == nil
+		}
+		if enum.IsFlags == "true" {
+			return 1 << i, true
+		}
+		return int64(i), true
+	}
+	return 0, false
+}
+
+// Parse the value of an enumeration literal, i.e. a member name, a comma
+// separated list of member names for flags, or an integer.
+func (enum *GoDataEnumType) ParseValue(value string) (int64, error) {
+	if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return i, nil
+	}
+	names := strings.Split(value, ",")
+	if len(names) > 1 && enum.IsFlags != "true" {
+		return 0, BadRequestError("Enumeration " + enum.Name + " does not allow combining the members " + value + ".")
+	}
+	var result int64
+	for _, name := range names {
+		v, ok := enum.MemberValue(strings.TrimSpace(name))
+		if !ok {
+			return 0, BadRequestError(strings.TrimSpace(name) + " is not a member of enumeration " + enum.Name + ".")
+		}
+		result |= v
+	}
+	return result, nil
+}
+
+// Format a value of the enumeration as the name of its member, or for flags
+// as the comma separated names of the members it combines. Values that do not
+// correspond to members are formatted as integers.
+func (enum *GoDataEnumType) FormatValue(value int64) string {
+	names := []string{}
+	rest := value
+	for _, member := range enum.Members {
+		v, ok := enum.MemberValue(member.Name)
+		if !ok {
+			continue
+		}
+		if v == value {
+			return member.Name
+		}
+		if enum.IsFlags == "true" && v != 0 && value&v == v {
+			names = append(names, member.Name)
+			rest &^= v
+		}
+	}
+	if len(names) == 0 || rest != 0 {
+		return strconv.FormatInt(value, 10)
+	}
+	return strings.Join(names, ",")
+}
+
+// A value of an enumeration type. It is the semantic reference of enumeration
+// literals in a filter, and is serialized in responses as member names.
+type GoDataEnumValue struct {
+	Type  *GoDataEnumType
+	Value int64
+}
+
+func (v *GoDataEnumValue) String() string {
+	return v.Type.FormatValue(v.Value)
+}
+
 type GoDataFunction struct {
 	XMLName       xml.Name `xml:"Function"`
 	Name          string   `xml:"Name,attr"`
@@ -150,7 +237,7 @@ type GoDataFunction struct {
 type GoDataTypeDefinition struct {
 	XMLName        xml.Name `xml:"TypeDefinition"`
 	Name           string   `xml:"Name,attr"`
-	UnderlyingType string   `xml:"UnderlyingTypeattr,omitempty"`
+	UnderlyingType string   `xml:"UnderlyingType,attr,omitempty"`
 	Annotations    []*GoDataAnnotation
 }
 
@@ -160,11 +247,14 @@ type GoDataProperty struct {
 	Type         string   `xml:"Type,attr"`
 	Nullable     string   `xml:"Nullable,attr,omitempty"`
 	MaxLength    int      `xml:"MaxLength,attr,omitempty"`
-	Precision    int      `xml:"Precision, attr,omitempty"`
+	Precision    int      `xml:"Precision,attr,omitempty"`
 	Scale        int      `xml:"Scale,attr,omitempty"`
 	Unicode      string   `xml:"Unicode,attr,omitempty"`
 	SRID         string   `xml:"SRID,attr,omitempty"`
 	DefaultValue string   `xml:"DefaultValue,attr,omitempty"`
+	// Whether $search matches the values of the property. It is not part of
+	// the metadata document.
+	Searchable bool `xml:"-"`
 }
 
 type GoDataNavigationProperty struct {
@@ -55,3 +55,48 @@ func TestSimpleMetadata(t *testing.T) {
 		t.Error("Expected: \n"+expected, "\n\nGot: \n"+string(actual))
 	}
 }
+
+func TestEnumValues(t *testing.T) {
+	tier := &GoDataEnumType{
+		Name:    "Tier",
+		Members: []*GoDataMember{{Name: "Bronze"}, {Name: "Silver"}, {Name: "Gold"}},
+	}
+	channels := &GoDataEnumType{
+		Name:    "Channels",
+		IsFlags: "true",
+		Members: []*GoDataMember{{Name: "Email"}, {Name: "Phone"}, {Name: "Post"}},
+	}
+
+	tests := []struct {
+		enum      *GoDataEnumType
+		input     string
+		value     int64
+		formatted string
+	}{
+		{tier, "Silver", 1, "Silver"},
+		{tier, "2", 2, "Gold"},
+		{tier, "7", 7, "7"},
+		{channels, "Email", 1, "Email"},
+		{channels, "Post,Email", 5, "Email,Post"},
+		{channels, "3", 3, "Email,Phone"},
+	}
+	for _, test := range tests {
+		v, err := test.enum.ParseValue(test.input)
+		if err != nil {
+			t.Error(test.input + ": " + err.Error())
+			continue
+		}
+		if v != test.value {
+			t.Errorf("%s is %d not %d", test.input, v, test.value)
+		}
+		if formatted := test.enum.FormatValue(v); formatted != test.formatted {
+			t.Error(test.input + " is formatted as " + formatted + " not " + test.formatted)
+		}
+	}
+
+	for _, input := range []string{"Platinum", "Bronze,Gold"} {
+		if _, err := tier.ParseValue(input); err == nil {
+			t.Error("Expected an error for " + input)
+		}
+	}
+}
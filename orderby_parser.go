@@ -10,47 +10,160 @@ const (
 )
 
 type OrderByItem struct {
+	// The expression in canonical form. Its semantic type and reference are
+	// those of the property if the expression is a property path.
 	Field *Token
 	Order string
+	// The parse tree of the expression, which has the syntax of a $filter
+	// expression.
+	Tree *ParseNode
 }
 
 func ParseOrderByString(orderby string) (*GoDataOrderByQuery, error) {
-	items := strings.Split(orderby, ",")
+	result, err := parseOrderByString(orderby, nil)
+	if err != nil {
+		return nil, optionError("$orderby", orderby, err)
+	}
+	return result, nil
+}
 
-	result := make([]*OrderByItem, 0)
+// Parse the orderby with the custom functions of the service. Each item is an
+// expression, optionally followed by asc or desc.
+func parseOrderByString(orderby string, service *GoDataService) (*GoDataOrderByQuery, error) {
+	tokens, err := service.filterLexer().Tokenize(orderby)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, v := range items {
-		parts := strings.Split(v, " ")
-		field := &Token{Value: parts[0]}
-		order := ASC
-		if len(parts) > 1 {
-			if strings.ToLower(parts[1]) == ASC {
-				order = ASC
-			} else if strings.ToLower(parts[1]) == DESC {
-				order = DESC
-			} else {
-				return nil, BadRequestError("Could not parse orderby query.")
+	result := make([]*OrderByItem, 0)
+	offset := 0
+	for {
+		// the item ends at a comma outside of parentheses
+		end, depth := len(tokens), 0
+		for i, token := range tokens {
+			if token.Type == FilterTokenOpenParen {
+				depth++
+			} else if token.Type == FilterTokenCloseParen {
+				depth--
+			} else if token.Type == FilterTokenComma && depth == 0 {
+				end = i
+				break
 			}
 		}
-		result = append(result, &OrderByItem{field, order})
+		item, err := parseOrderByItem(tokens[:end], offset, service)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+
+		if end == len(tokens) {
+			return &GoDataOrderByQuery{result}, nil
+		}
+		offset = tokens[end].Offset + 1
+		tokens = tokens[end+1:]
+	}
+}
+
+// Parse the tokens of an item starting at the offset.
+func parseOrderByItem(tokens []*Token, offset int, service *GoDataService) (*OrderByItem, error) {
+	if len(tokens) == 0 {
+		return nil, &SyntaxError{offset, "Expected an expression"}
+	}
+	order := ASC
+	if last := tokens[len(tokens)-1]; len(tokens) > 1 && last.Type == FilterTokenLiteral {
+		switch strings.ToLower(last.Value) {
+		case ASC:
+			tokens = tokens[:len(tokens)-1]
+		case DESC:
+			order = DESC
+			tokens = tokens[:len(tokens)-1]
+		}
 	}
 
-	return &GoDataOrderByQuery{result}, nil
+	tokens, err := foldSpatialTokens(tokens)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err = expandListTokens(tokens)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := service.filterParser().ParseTree(tokens)
+	if err != nil {
+		return nil, err
+	}
+	field := &Token{Value: printFilterNode(tree, service.filterParser()), Offset: tokens[0].Offset}
+	return &OrderByItem{Field: field, Order: order, Tree: tree}, nil
 }
 
+// Build the typed expression for the tree of the item.
+func (item *OrderByItem) Expression() (FilterExpression, error) {
+	if item == nil || item.Tree == nil {
+		return nil, nil
+	}
+	return BuildFilterExpression(item.Tree)
+}
+
+// Resolve the properties, navigation paths and functions of the expressions
+// like for a $filter. The expressions must have a single value per entity, so
+// they may not refer to collections other than in any and all.
 func SemanticizeOrderByQuery(orderby *GoDataOrderByQuery, service *GoDataService, entity *GoDataEntityType) error {
 	if orderby == nil {
 		return nil
 	}
 
+	semantics := &filterSemantics{service: service, parser: service.filterParser(), entity: entity}
+	return semanticizeOrderByItems(orderby, semantics)
+}
+
+// Resolve the items of the orderby with the semantics.
+func semanticizeOrderByItems(orderby *GoDataOrderByQuery, semantics *filterSemantics) error {
 	for _, item := range orderby.OrderByItems {
-		if prop, ok := service.PropertyLookup[entity][item.Field.Value]; ok {
+		if item.Tree == nil {
+			continue
+		}
+		if _, err := semantics.semanticize(item.Tree, filterScope{}); err != nil {
+			return err
+		}
+		if err := checkOrderByNode(item.Tree); err != nil {
+			return err
+		}
+
+		// the property at the end of a path
+		last := item.Tree
+		for last.Token.Type == FilterTokenNav {
+			last = last.Children[1]
+		}
+		if last.Token.SemanticType == SemanticTypeEntity {
+			return BadRequestError("Cannot order by '" + item.Field.Value + "', it is an entity.")
+		}
+		if last.Token.SemanticType == SemanticTypeProperty {
 			item.Field.SemanticType = SemanticTypeProperty
-			item.Field.SemanticReference = prop
+			item.Field.SemanticReference = last.Token.SemanticReference
 		} else {
-			return BadRequestError("No property " + item.Field.Value + " for entity " + entity.Name)
+			item.Field.SemanticType = SemanticTypePropertyValue
+			item.Field.SemanticReference = &item.Field.Value
 		}
 	}
 
 	return nil
 }
+
+// Check that a semanticized expression has a single value that can be
+// ordered by.
+func checkOrderByNode(node *ParseNode) error {
+	if node.Token.Type == FilterTokenNav && node.Children[1].Token.Type == FilterTokenLambda {
+		return nil
+	}
+	_, isCollection := collectionElementType(node.EdmType)
+	if isCollection || node.Token.SemanticType == SemanticTypeEntitySet {
+		return BadRequestError("Cannot order by '" + printFilterNode(node, GlobalFilterParser) +
+			"', it is a collection.")
+	}
+	for _, child := range node.Children {
+		if err := checkOrderByNode(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package godata
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func semanticizeOrderBy(entityType, input string) (*GoDataOrderByQuery, error) {
+	service, err := BuildService(&DummyProvider{}, "http://localhost")
+	if err != nil {
+		return nil, err
+	}
+	entity, err := service.LookupEntityType(entityType)
+	if err != nil {
+		return nil, err
+	}
+	orderby, err := ParseOrderByString(input)
+	if err != nil {
+		return nil, err
+	}
+	return orderby, SemanticizeOrderByQuery(orderby, service, entity)
+}
+
+func TestParseOrderBy(t *testing.T) {
+	tests := map[string]string{
+		"Name":                           "Name asc",
+		"Name asc,Age DESC":              "Name asc;Age desc",
+		"length(name) desc":              "length(name) desc",
+		"Datastream/name asc":            "Datastream/name asc",
+		"concat(a,'b, c'),b":             "concat(a,'b, c') asc;b asc",
+		"Price mul (1 add Tax) desc, Id": "Price mul (1 add Tax) desc;Id asc",
+		"desc":                           "desc asc",
+		"geo.distance(location,geography'POINT(1 2)')": "geo.distance(location,geography'POINT(1 2)') asc",
+	}
+	for input, expected := range tests {
+		orderby, err := ParseOrderByString(input)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		items := []string{}
+		for _, item := range orderby.OrderByItems {
+			items = append(items, item.Field.Value+" "+item.Order)
+		}
+		if actual := strings.Join(items, ";"); actual != expected {
+			t.Error(input + ": expected " + expected + ", got " + actual)
+		}
+	}
+}
+
+func TestParseOrderByErrors(t *testing.T) {
+	tests := map[string]string{
+		"":                "position 0: Expected an expression",
+		"Name,,Age":       "position 5: Expected an expression",
+		"Name,":           "position 5: Expected an expression",
+		"Name asc,Age up": "position 13: Expected an operator",
+		"length(Name":     "position 6: Mismatched parenthesis, this one is never closed",
+		"Name asc desc":   "position 5: Expected an operator",
+	}
+	for input, expected := range tests {
+		_, err := ParseOrderByString(input)
+		if err == nil {
+			t.Error("Expected an error for " + input)
+			continue
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Error("Error for " + input + " does not contain '" + expected + "': " + err.Error())
+		}
+	}
+}
+
+func TestSemanticizeOrderBy(t *testing.T) {
+	orderby, err := semanticizeOrderBy("Order", "Customer/Name desc,length(Id),Customer/Orders/any(o:o/Id eq Id)")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	items := orderby.OrderByItems
+	if prop, ok := items[0].Field.SemanticReference.(*GoDataProperty); !ok || prop.Name != "Name" ||
+		items[0].Field.SemanticType != SemanticTypeProperty {
+		t.Error("Expected Customer/Name to refer to the property Name")
+	}
+	if items[1].Tree.EdmType != GoDataInt32 || items[1].Field.SemanticType != SemanticTypePropertyValue {
+		t.Error("Expected length(Id) to be a value of type Edm.Int32, got " + items[1].Tree.EdmType)
+	}
+	if items[2].Tree.EdmType != GoDataBoolean {
+		t.Error("Expected the lambda to be a boolean, got " + items[2].Tree.EdmType)
+	}
+	if expr, err := items[0].Expression(); err != nil {
+		t.Error(err)
+	} else if path, ok := expr.(*PropertyPathExpression); !ok || len(path.Segments) != 2 {
+		t.Error("Expected a path of two segments for Customer/Name")
+	}
+
+	errors := map[string]string{
+		"Orders":                              "Cannot order by 'Orders', it is a collection.",
+		"Orders/Id":                           "Cannot order by 'Orders', it is a collection.",
+		"Unknown":                             "No property found Unknown on entity Customer",
+		"Name,Age add 'x'":                    "Age add 'x'",
+		"Orders/any(o:o/Id eq 'a') desc,Name": "",
+	}
+	for input, expected := range errors {
+		_, err := semanticizeOrderBy("Customer", input)
+		if expected == "" {
+			if err != nil {
+				t.Error(input + ": " + err.Error())
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Error("Expected an error containing '" + expected + "' for " + input)
+		}
+	}
+	if _, err := semanticizeOrderBy("Order", "Customer"); err == nil ||
+		!strings.Contains(err.Error(), "Cannot order by 'Customer', it is an entity.") {
+		t.Error("Expected an error for ordering by an entity")
+	}
+}
+
+func TestSortOrderBy(t *testing.T) {
+	values := []interface{}{
+		map[string]interface{}{"Id": 1, "Name": "b", "Address": map[string]interface{}{"City": "Berlin"}},
+		map[string]interface{}{"Id": 2, "Name": nil},
+		map[string]interface{}{"Id": 3, "Name": "a", "Address": map[string]interface{}{"City": "Aachen"}},
+		map[string]interface{}{"Id": 4, "Name": "bb", "Address": map[string]interface{}{"City": "Berlin"}},
+	}
+	tests := map[string]string{
+		"Name":                           "2,3,1,4",
+		"Name desc":                      "4,1,3,2",
+		"Address/City,Id desc":           "2,3,4,1",
+		"Address/City desc,length(Name)": "1,4,3,2",
+		"Id mod 2,Id desc":               "4,2,3,1",
+	}
+	for input, expected := range tests {
+		orderby, err := ParseOrderByString(input)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		sorted := append([]interface{}{}, values...)
+		if err := (&FilterEvaluator{}).SortOrderBy(orderby, sorted); err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		ids := []string{}
+		for _, value := range sorted {
+			ids = append(ids, strconv.Itoa(value.(map[string]interface{})["Id"].(int)))
+		}
+		if actual := strings.Join(ids, ","); actual != expected {
+			t.Error(input + ": expected " + expected + ", got " + actual)
+		}
+	}
+
+	orderby, _ := ParseOrderByString("Name,Id")
+	mixed := []interface{}{map[string]interface{}{"Name": 1}, map[string]interface{}{"Name": "a"}}
+	if err := (&FilterEvaluator{}).SortOrderBy(orderby, mixed); err == nil {
+		t.Error("Expected an error for values that cannot be compared")
+	}
+}
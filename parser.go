@@ -2,6 +2,7 @@ package godata
 
 import (
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -31,6 +32,8 @@ type TokenMatcher struct {
 type Token struct {
 	Value string
 	Type  int
+	// The byte offset of the token in the tokenized input
+	Offset int
 	// Holds information about the semantic meaning of this token taken from the
 	// context of the GoDataService.
 	SemanticType      int
@@ -51,6 +54,7 @@ func (t *Tokenizer) Ignore(pattern string, token int) {
 
 func (t *Tokenizer) TokenizeBytes(target []byte) ([]*Token, error) {
 	result := make([]*Token, 0)
+	length := len(target)
 	match := true // false when no match is found
 	for len(target) > 0 && match {
 		match = false
@@ -59,11 +63,11 @@ func (t *Tokenizer) TokenizeBytes(target []byte) ([]*Token, error) {
 
 			if len(token) > 0 {
 				// If a filter is found but next char is not "(" than don't treat it as filter
-				if m.Token == FilterTokenFunc && string(target[len(token):len(token)+1]) != "(" {
+				if m.Token == FilterTokenFunc && (len(target) == len(token) || target[len(token)] != '(') {
 					continue
 				}
 
-				parsed := Token{Value: string(token), Type: m.Token}
+				parsed := Token{Value: string(token), Type: m.Token, Offset: length - len(target)}
 				result = append(result, &parsed)
 				target = target[len(token):] // remove the token from the input
 				match = true
@@ -81,7 +85,7 @@ func (t *Tokenizer) TokenizeBytes(target []byte) ([]*Token, error) {
 	}
 
 	if len(target) > 0 && !match {
-		return result, BadRequestError("No matching token for " + string(target))
+		return result, &SyntaxError{length - len(target), "No matching token for " + string(target)}
 	}
 
 	return result, nil
@@ -106,18 +110,37 @@ type Operator struct {
 	Operands int
 	// Rank of precedence
 	Precedence int
+	// Whether a parenthesized right operand is a list, e.g. "in (1,2,3)"
+	List bool
 }
 
 type Function struct {
 	Token string
-	// The number of parameters this function accepts
+	// The number of parameters of the function, the largest one if it accepts
+	// several
 	Params int
+	// The numbers of parameters this function accepts, e.g. 2 and 3 for a
+	// function with an optional third parameter. If empty, the function only
+	// accepts Params.
+	Arities []int
+	// The type signatures of the function, used for type checking. A function
+	// without signatures is not type checked.
+	Signatures []*FunctionSignature
+}
+
+// The Edm types of the parameters of a function and the Edm type it returns.
+type FunctionSignature struct {
+	Params  []string
+	Returns string
 }
 
 type ParseNode struct {
 	Token    *Token
 	Parent   *ParseNode
 	Children []*ParseNode
+	// The Edm type of the expression represented by this node. It is set during
+	// semantic analysis and left empty for null and for untyped expressions.
+	EdmType string
 }
 
 func EmptyParser() *Parser {
@@ -127,12 +150,52 @@ func EmptyParser() *Parser {
 // Add an operator to the language. Provide the token, a precedence, and
 // whether the operator is left, right, or not associative.
 func (p *Parser) DefineOperator(token string, operands, assoc, precedence int) {
-	p.Operators[token] = &Operator{token, assoc, operands, precedence}
+	p.Operators[token] = &Operator{Token: token, Association: assoc, Operands: operands, Precedence: precedence}
+}
+
+// Add a binary operator whose right operand may be a list in parentheses,
+// e.g. "in". The open paren becomes the node of the list, with the items as
+// its children.
+func (p *Parser) DefineListOperator(token string, assoc, precedence int) {
+	p.DefineOperator(token, 2, assoc, precedence)
+	p.Operators[token].List = true
+}
+
+// Add a function to the language. Provide each number of parameters the
+// function accepts.
+func (p *Parser) DefineFunction(token string, params ...int) {
+	f := &Function{Token: token, Arities: params}
+	for _, n := range params {
+		if n > f.Params {
+			f.Params = n
+		}
+	}
+	p.Functions[token] = f
+}
+
+// The numbers of parameters the function accepts.
+func (f *Function) arities() []int {
+	if len(f.Arities) == 0 {
+		return []int{f.Params}
+	}
+	return f.Arities
+}
+
+// Check whether the function accepts the given number of arguments.
+func (f *Function) Accepts(args int) bool {
+	for _, params := range f.arities() {
+		if params == args {
+			return true
+		}
+	}
+	return false
 }
 
-// Add a function to the language
-func (p *Parser) DefineFunction(token string, params int) {
-	p.Functions[token] = &Function{token, params}
+// Add a type signature to a function of the language. Provide the return type
+// followed by the types of the parameters.
+func (p *Parser) DefineSignature(token string, returns string, params ...string) {
+	f := p.Functions[token]
+	f.Signatures = append(f.Signatures, &FunctionSignature{params, returns})
 }
 
 // Parse the input string of tokens using the given definitions of operators
@@ -141,13 +204,23 @@ func (p *Parser) DefineFunction(token string, params int) {
 func (p *Parser) InfixToPostfix(tokens []*Token) (*tokenQueue, error) {
 	queue := tokenQueue{}
 	stack := tokenStack{}
+	// tokens that were pushed onto the stack as function calls
+	calls := map[*Token]bool{}
+	// open parens of lists, i.e. the right operands of list operators
+	lists := map[*Token]bool{}
+	// the number of arguments seen so far by the open paren of a call or list
+	args := map[*Token]int{}
+	var prev *Token
 
 	for len(tokens) > 0 {
 		token := tokens[0]
 		tokens = tokens[1:]
+		last := prev
+		prev = token
 
-		if token.Type == FilterTokenFunc {
-			// push functions onto the stack if no tokens are left or the next token is a "("
+		if p.isFunctionCall(token, tokens) {
+			// push functions onto the stack if the next token is a "("
+			calls[token] = true
 			stack.Push(token)
 		} else if token.Value == "," {
 			// function parameter separator, pop off stack until we see a "("
@@ -156,14 +229,18 @@ func (p *Parser) InfixToPostfix(tokens []*Token) (*tokenQueue, error) {
 			}
 			// there was an error parsing
 			if stack.Empty() {
-				return nil, BadRequestError("Parse error")
+				return nil, &SyntaxError{token.Offset, "Unexpected comma outside of a function call"}
 			}
+			if last.Value == "(" || last.Value == "," {
+				return nil, &SyntaxError{token.Offset, "Expected an argument before this comma"}
+			}
+			args[stack.Peek()]++
 		} else if o1, ok := p.Operators[token.Value]; ok {
 			// push operators onto stack according to precedence
 			if !stack.Empty() {
 				for o2, ok := p.Operators[stack.Peek().Value]; ok &&
-					(o1.Association == OpAssociationLeft && o1.Precedence <= o2.Precedence) ||
-					(o1.Association == OpAssociationRight && o1.Precedence < o2.Precedence); {
+					((o1.Association == OpAssociationLeft && o1.Precedence <= o2.Precedence) ||
+						(o1.Association == OpAssociationRight && o1.Precedence < o2.Precedence)); {
 					queue.Enqueue(stack.Pop())
 
 					if stack.Empty() {
@@ -175,6 +252,12 @@ func (p *Parser) InfixToPostfix(tokens []*Token) (*tokenQueue, error) {
 			stack.Push(token)
 		} else if token.Value == "(" {
 			// push open parens onto the stack
+			if last != nil && calls[last] {
+				args[token] = 1
+			} else if last != nil && p.isListOperator(last) {
+				lists[token] = true
+				args[token] = 1
+			}
 			stack.Push(token)
 		} else if token.Value == ")" {
 			// if we find a close paren, pop things off the stack
@@ -183,16 +266,24 @@ func (p *Parser) InfixToPostfix(tokens []*Token) (*tokenQueue, error) {
 			}
 			// there was an error parsing
 			if stack.Empty() {
-				return nil, BadRequestError("Parse error. Mismatched parenthesis.")
+				return nil, &SyntaxError{token.Offset, "Mismatched parenthesis, no opening parenthesis for this one"}
+			}
+			if last.Value == "," {
+				return nil, &SyntaxError{last.Offset, "Expected an argument after this comma"}
 			}
 			// pop off open paren
-			stack.Pop()
-			// if next token is a function, move it to the queue
-			if !stack.Empty() {
-				// if _, ok := p.Functions[stack.Peek().Value]; ok {
-				if stack.Peek().Type == FilterTokenFunc {
-					queue.Enqueue(stack.Pop())
-				}
+			paren := stack.Pop()
+			n := args[paren]
+			if last == paren {
+				// no arguments
+				n = 0
+			}
+			if lists[paren] {
+				// the paren is the node of the list
+				queue.EnqueueCall(paren, n)
+			} else if !stack.Empty() && calls[stack.Peek()] {
+				// if next token is a function, move it to the queue
+				queue.EnqueueCall(stack.Pop(), n)
 			}
 		} else {
 			// Token is a literal -- put it in the queue
@@ -203,7 +294,7 @@ func (p *Parser) InfixToPostfix(tokens []*Token) (*tokenQueue, error) {
 	// pop off the remaining operators onto the queue
 	for !stack.Empty() {
 		if stack.Peek().Value == "(" || stack.Peek().Value == ")" {
-			return nil, BadRequestError("parse error. Mismatched parenthesis.")
+			return nil, &SyntaxError{stack.Peek().Offset, "Mismatched parenthesis, this one is never closed"}
 		}
 		queue.Enqueue(stack.Pop())
 	}
@@ -211,53 +302,99 @@ func (p *Parser) InfixToPostfix(tokens []*Token) (*tokenQueue, error) {
 	return &queue, nil
 }
 
-// Convert a Postfix token queue to a parse tree
+// Convert a Postfix token queue to a parse tree. Returns an error unless every
+// function gets a number of arguments it accepts, every operator gets all its
+// operands, and the operands combine into a single tree.
 func (p *Parser) PostfixToTree(queue *tokenQueue) (*ParseNode, error) {
 	stack := &nodeStack{}
-	currNode := &ParseNode{}
-
-	t := queue.Head
-	for t != nil {
-		t = t.Next
-	}
 
 	for !queue.Empty() {
 		// push the token onto the stack as a tree node
-		currNode = &ParseNode{queue.Dequeue(), nil, make([]*ParseNode, 0)}
-		stack.Push(currNode)
-
-		if stack.Peek().Token.Type == FilterTokenFunc {
-			// if the top of the stack is a function
-			node := stack.Pop()
-			f := p.Functions[node.Token.Value]
-			// pop off function parameters
-			for i := 0; i < f.Params; i++ {
-				if stack.Empty() {
-					continue
+		call, args := queue.Head.Call, queue.Head.Args
+		currNode := &ParseNode{Token: queue.Dequeue(), Children: make([]*ParseNode, 0)}
+		currNode.Token.Value = strings.TrimSpace(currNode.Token.Value)
+
+		if call {
+			if f, ok := p.Functions[currNode.Token.Value]; ok {
+				if !f.Accepts(args) {
+					return nil, &SyntaxError{currNode.Token.Offset, "Function " + f.Token +
+						" expects " + describeParams(f.arities()) + ", got " + strconv.Itoa(args)}
 				}
-				// prepend children so they get added in the right order
-				node.Children = append([]*ParseNode{stack.Pop()}, node.Children...)
+			} else if args == 0 {
+				return nil, &SyntaxError{currNode.Token.Offset, "Expected an item in this list"}
+			}
+			// pop off function parameters or list items
+			if err := popChildren(stack, currNode, args); err != nil {
+				return nil, err
 			}
-			stack.Push(node)
-		} else if _, ok := p.Operators[stack.Peek().Token.Value]; ok {
-			// if the top of the stack is an operator
-			node := stack.Pop()
-			o := p.Operators[node.Token.Value]
+		} else if o, ok := p.Operators[currNode.Token.Value]; ok {
 			// pop off operands
-			for i := 0; i < o.Operands; i++ {
-				if stack.Empty() {
-					continue
-				}
-				// prepend children so they get added in the right order
-				node.Children = append([]*ParseNode{stack.Pop()}, node.Children...)
+			if err := popChildren(stack, currNode, o.Operands); err != nil {
+				return nil, err
 			}
-			stack.Push(node)
 		}
+		stack.Push(currNode)
+	}
 
-		stack.Peek().Token.Value = strings.TrimSpace(stack.Peek().Token.Value)
+	if stack.Empty() {
+		return nil, &SyntaxError{0, "Empty expression"}
+	}
+	root := stack.Pop()
+	if !stack.Empty() {
+		// the operands before the root were not combined by an operator
+		return nil, &SyntaxError{treeOffset(root), "Expected an operator"}
 	}
+	return root, nil
+}
+
+// Pop n nodes off the stack and add them as children of the node.
+func popChildren(stack *nodeStack, node *ParseNode, n int) error {
+	children := make([]*ParseNode, n)
+	for i := n - 1; i >= 0; i-- {
+		if stack.Empty() {
+			return &SyntaxError{node.Token.Offset, "Missing operand for " + node.Token.Value}
+		}
+		children[i] = stack.Pop()
+	}
+	node.Children = append(node.Children, children...)
+	return nil
+}
 
-	return currNode, nil
+// The offset of the leftmost token of a tree.
+func treeOffset(node *ParseNode) int {
+	offset := node.Token.Offset
+	for _, child := range node.Children {
+		offset = min(offset, treeOffset(child))
+	}
+	return offset
+}
+
+func describeParams(params []int) string {
+	counts := make([]string, len(params))
+	for i, n := range params {
+		counts[i] = strconv.Itoa(n)
+	}
+	result := strings.Join(counts, " or ")
+	if len(params) == 1 && params[0] == 1 {
+		return result + " argument"
+	}
+	return result + " arguments"
+}
+
+// Check whether the token is a function call, i.e. it names a function of the
+// language and the next token is a "(". Function names that are not followed
+// by a paren, e.g. a property called "time", are literals.
+func (p *Parser) isFunctionCall(token *Token, next []*Token) bool {
+	if _, ok := p.Functions[token.Value]; !ok {
+		return false
+	}
+	return len(next) > 0 && next[0].Value == "("
+}
+
+// Check whether the token is an operator whose right operand may be a list.
+func (p *Parser) isListOperator(token *Token) bool {
+	o, ok := p.Operators[token.Value]
+	return ok && o.List
 }
 
 type tokenStack struct {
@@ -312,19 +449,31 @@ type tokenQueueNode struct {
 	Token *Token
 	Prev  *tokenQueueNode
 	Next  *tokenQueueNode
+	// Set when the token is applied as a function to the preceding tokens, or
+	// is the open paren of a list of them
+	Call bool
+	// The number of arguments of a function call or items of a list
+	Args int
 }
 
 func (q *tokenQueue) Enqueue(t *Token) {
-	node := tokenQueueNode{t, q.Tail, nil}
-	// fmt.Println(t.Value)
+	q.enqueue(&tokenQueueNode{Token: t, Prev: q.Tail})
+}
+
+// Enqueue a token that is applied as a function call to the given number of
+// arguments.
+func (q *tokenQueue) EnqueueCall(t *Token, args int) {
+	q.enqueue(&tokenQueueNode{Token: t, Prev: q.Tail, Call: true, Args: args})
+}
 
+func (q *tokenQueue) enqueue(node *tokenQueueNode) {
 	if q.Tail == nil {
-		q.Head = &node
+		q.Head = node
 	} else {
-		q.Tail.Next = &node
+		q.Tail.Next = node
 	}
 
-	q.Tail = &node
+	q.Tail = node
 }
 
 func (q *tokenQueue) Dequeue() *Token {
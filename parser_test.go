@@ -2,6 +2,7 @@ package godata
 
 import (
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -297,3 +298,59 @@ func BenchmarkBuildTree(b *testing.B) {
 		parser.PostfixToTree(result)
 	}
 }
+
+func TestTreeVariadicFunction(t *testing.T) {
+	parser := EmptyParser()
+	parser.DefineFunction("round", 1, 2)
+	parser.DefineFunction("now", 0)
+
+	tests := map[string]int{
+		"round ( pi )":         1,
+		"round ( pi , 2 )":     2,
+		"round ( now ( ) )":    1,
+		"round ( pi , 2 , )":   -1,
+		"round ( )":            -1,
+		"round ( pi , 2 , 3 )": -1,
+	}
+
+	for input, expected := range tests {
+		tokens := []*Token{}
+		for _, value := range strings.Split(input, " ") {
+			tokens = append(tokens, &Token{Value: value})
+		}
+		result, err := parser.InfixToPostfix(tokens)
+		if err == nil {
+			var root *ParseNode
+			root, err = parser.PostfixToTree(result)
+			if err == nil && len(root.Children) != expected {
+				t.Error(input + ": expected " + strconv.Itoa(expected) + " arguments, got " +
+					strconv.Itoa(len(root.Children)))
+			}
+		}
+		if err != nil && expected >= 0 {
+			t.Error(input + ": " + err.Error())
+		}
+		if err == nil && expected < 0 {
+			t.Error("Expected an error for " + input)
+		}
+	}
+}
+
+func TestFunctionParams(t *testing.T) {
+	parser := EmptyParser()
+	parser.DefineFunction("round", 1, 2)
+	round := parser.Functions["round"]
+	if round.Params != 2 || len(round.Arities) != 2 {
+		t.Error("Expected round to have up to 2 parameters in 2 arities, got " + strconv.Itoa(round.Params))
+	}
+
+	// functions defined without arities accept their number of parameters
+	parser.Functions["max"] = &Function{Token: "max", Params: 2}
+	if !parser.Functions["max"].Accepts(2) || parser.Functions["max"].Accepts(1) {
+		t.Error("Expected max to accept 2 arguments only")
+	}
+	tokens := []*Token{{Value: "max"}, {Value: "("}, {Value: "1"}, {Value: ")"}}
+	if _, err := parser.ParseTree(tokens); err == nil || !strings.Contains(err.Error(), "expects 2 arguments") {
+		t.Error("Expected an error for max with one argument")
+	}
+}
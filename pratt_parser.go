@@ -0,0 +1,236 @@
+package godata
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Parse the tokens into a tree in a single pass by precedence climbing, using
+// the operators and functions of the parser. The tree has the same shape as
+// the one built by InfixToPostfix and PostfixToTree: operators have their
+// operands as children, functions their arguments, the open paren of a list
+// its items, and parentheses for grouping are dropped.
+//
+// Whether a token is an operator or a function depends on its position: a
+// function name followed by a paren is a call where an operand is expected,
+// an operator with one operand is a prefix operator, e.g. not or unary minus,
+// and an operator with two operands is an infix operator.
+func (p *Parser) ParseTree(tokens []*Token) (*ParseNode, error) {
+	if len(tokens) == 0 {
+		return nil, &SyntaxError{0, "Empty expression"}
+	}
+	state := &prattState{parser: p, tokens: tokens}
+	root, err := state.expression(0, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := state.peek(); token != nil {
+		return nil, state.unexpected(token)
+	}
+	return root, nil
+}
+
+// The position of a Pratt parser in the tokens.
+type prattState struct {
+	parser *Parser
+	tokens []*Token
+	pos    int
+	// the open parens that are not closed yet
+	open []*Token
+}
+
+func (s *prattState) peek() *Token {
+	if s.pos >= len(s.tokens) {
+		return nil
+	}
+	return s.tokens[s.pos]
+}
+
+func (s *prattState) next() *Token {
+	token := s.tokens[s.pos]
+	s.pos++
+	return token
+}
+
+func newParseNode(token *Token) *ParseNode {
+	token.Value = strings.TrimSpace(token.Value)
+	return &ParseNode{Token: token, Children: make([]*ParseNode, 0)}
+}
+
+// Parse an expression of the infix operators binding at least as tightly as
+// the minimum precedence. The operator is the one the expression is an
+// operand of, if any.
+func (s *prattState) expression(precedence int, operator *Token) (*ParseNode, error) {
+	left, err := s.operand(operator)
+	if err != nil {
+		return nil, err
+	}
+
+	for token := s.peek(); token != nil; token = s.peek() {
+		o, ok := s.parser.Operators[token.Value]
+		if !ok || o.Operands != 2 || o.Precedence < precedence {
+			break
+		}
+		s.next()
+
+		node := newParseNode(token)
+		var right *ParseNode
+		if next := s.peek(); o.List && next != nil && next.Value == "(" {
+			right, err = s.list(s.next())
+		} else if o.Association == OpAssociationRight {
+			right, err = s.expression(o.Precedence, token)
+		} else {
+			right, err = s.expression(o.Precedence+1, token)
+		}
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, left, right)
+		left = node
+	}
+	return left, nil
+}
+
+// Parse an operand: a literal, a function call, a prefix operator applied to
+// its operand, or an expression in parentheses.
+func (s *prattState) operand(operator *Token) (*ParseNode, error) {
+	token := s.peek()
+	if token == nil || token.Value == ")" || token.Value == "," {
+		switch {
+		case token == nil && len(s.open) > 0:
+			return nil, &SyntaxError{s.open[len(s.open)-1].Offset, "Mismatched parenthesis, this one is never closed"}
+		case operator != nil:
+			return nil, &SyntaxError{operator.Offset, "Missing operand for " + operator.Value}
+		case token == nil:
+			return nil, &SyntaxError{0, "Empty expression"}
+		case token.Value == "," && len(s.open) == 0:
+			return nil, &SyntaxError{token.Offset, "Unexpected comma outside of a function call"}
+		case token.Value == ",":
+			return nil, &SyntaxError{token.Offset, "Expected an expression before this comma"}
+		case len(s.open) == 0:
+			return nil, &SyntaxError{token.Offset, "Mismatched parenthesis, no opening parenthesis for this one"}
+		default:
+			return nil, &SyntaxError{token.Offset, "Expected an expression before this parenthesis"}
+		}
+	}
+
+	if s.parser.isFunctionCall(token, s.tokens[s.pos+1:]) {
+		return s.call(s.next())
+	}
+	if o, ok := s.parser.Operators[token.Value]; ok {
+		s.next()
+		if o.Operands != 1 {
+			return nil, &SyntaxError{token.Offset, "Missing operand for " + token.Value}
+		}
+		node := newParseNode(token)
+		child, err := s.expression(o.Precedence+1, token)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, child)
+		return node, nil
+	}
+	if token.Value == "(" {
+		s.open = append(s.open, s.next())
+		node, err := s.expression(0, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.close(); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+	return newParseNode(s.next()), nil
+}
+
+// Parse the arguments of a function call and check their number.
+func (s *prattState) call(token *Token) (*ParseNode, error) {
+	if token.Type == FilterTokenLiteral {
+		// a function name separated from its paren by spaces
+		token.Type = FilterTokenFunc
+	}
+	node := newParseNode(token)
+	args, err := s.arguments(s.next())
+	if err != nil {
+		return nil, err
+	}
+	f := s.parser.Functions[node.Token.Value]
+	if !f.Accepts(len(args)) {
+		return nil, &SyntaxError{token.Offset, "Function " + f.Token +
+			" expects " + describeParams(f.arities()) + ", got " + strconv.Itoa(len(args))}
+	}
+	node.Children = append(node.Children, args...)
+	return node, nil
+}
+
+// Parse the items of a list, which is the node of the open paren.
+func (s *prattState) list(open *Token) (*ParseNode, error) {
+	node := newParseNode(open)
+	items, err := s.arguments(open)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, &SyntaxError{open.Offset, "Expected an item in this list"}
+	}
+	node.Children = append(node.Children, items...)
+	return node, nil
+}
+
+// Parse the comma separated expressions after an open paren up to the
+// closing paren.
+func (s *prattState) arguments(open *Token) ([]*ParseNode, error) {
+	s.open = append(s.open, open)
+	args := []*ParseNode{}
+	if next := s.peek(); next != nil && next.Value == ")" {
+		return args, s.close()
+	}
+	for {
+		if next := s.peek(); next != nil && next.Value == "," {
+			return nil, &SyntaxError{next.Offset, "Expected an argument before this comma"}
+		}
+		arg, err := s.expression(0, nil)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		next := s.peek()
+		if next == nil || next.Value != "," {
+			break
+		}
+		comma := s.next()
+		if next := s.peek(); next != nil && next.Value == ")" {
+			return nil, &SyntaxError{comma.Offset, "Expected an argument after this comma"}
+		}
+	}
+	return args, s.close()
+}
+
+// Consume the paren closing the innermost open paren.
+func (s *prattState) close() error {
+	token := s.peek()
+	if token == nil {
+		return &SyntaxError{s.open[len(s.open)-1].Offset, "Mismatched parenthesis, this one is never closed"}
+	}
+	if token.Value != ")" {
+		return s.unexpected(token)
+	}
+	s.next()
+	s.open = s.open[:len(s.open)-1]
+	return nil
+}
+
+// The error for a token following a complete expression.
+func (s *prattState) unexpected(token *Token) error {
+	switch {
+	case token.Value == ")":
+		return &SyntaxError{token.Offset, "Mismatched parenthesis, no opening parenthesis for this one"}
+	case token.Value == "," && len(s.open) == 0:
+		return &SyntaxError{token.Offset, "Unexpected comma outside of a function call"}
+	case token.Value == ",":
+		return &SyntaxError{token.Offset, "Unexpected comma in parentheses"}
+	}
+	return &SyntaxError{token.Offset, "Expected an operator"}
+}
@@ -0,0 +1,147 @@
+package godata
+
+import (
+	"strings"
+	"testing"
+)
+
+// Format a tree as the value of each node followed by its children in
+// parentheses, e.g. eq(a,1).
+func formatParseTree(node *ParseNode) string {
+	if len(node.Children) == 0 {
+		return node.Token.Value
+	}
+	children := make([]string, len(node.Children))
+	for i, child := range node.Children {
+		children[i] = formatParseTree(child)
+	}
+	return node.Token.Value + "(" + strings.Join(children, ",") + ")"
+}
+
+func parsePrattTree(input string) (*ParseNode, error) {
+	tokens, err := GlobalFilterLexer.Tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	return GlobalFilterParser.ParseTree(tokens)
+}
+
+func TestParseTree(t *testing.T) {
+	tests := map[string]string{
+		"a sub b sub c":                "sub(sub(a,b),c)",
+		"a div b mul c":                "mul(div(a,b),c)",
+		"a mul b add c":                "add(mul(a,b),c)",
+		"a add b mul c":                "add(a,mul(b,c))",
+		"(a add b) mul c":              "mul(add(a,b),c)",
+		"a or b and c":                 "or(a,and(b,c))",
+		"not not Active":               "not(not(Active))",
+		"not Age gt 1":                 "gt(not(Age),1)",
+		"-Price gt 1":                  "gt(-(Price),1)",
+		"-(a add b) eq -1":             "eq(-(add(a,b)),-1)",
+		"a sub -b":                     "sub(a,-(b))",
+		"- -a":                         "-(-(a))",
+		"Address/City eq 'Redmond'":    "eq(/(Address,City),'Redmond')",
+		"Tags/any(d:d eq 1 or d eq 2)": "/(Tags,any(:(d,or(eq(d,1),eq(d,2)))))",
+		"Tags/any()":                   "/(Tags,any)",
+		"isof(Name,Edm.String)":        "isof(Name,Edm.String)",
+		"cast(Age,Edm.Int64) eq 1":     "eq(cast(Age,Edm.Int64),1)",
+		"Name in ('a','b') or false":   "or(in(Name,(('a','b')),false)",
+		"Style has Ns.Color'Red'":      "has(Style,Ns.Color'Red')",
+		"substring(Name,1,2) eq 'a'":   "eq(substring(Name,1,2),'a')",
+		"Name eq contains":             "eq(Name,contains)",
+		"now() gt 2020-01-01":          "gt(now,2020-01-01)",
+	}
+	for input, expected := range tests {
+		tree, err := parsePrattTree(input)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		if actual := formatParseTree(tree); actual != expected {
+			t.Error(input + ": expected " + expected + ", got " + actual)
+		}
+	}
+}
+
+// Where the old parser handled an expression correctly, the single-pass
+// parser must build the same tree.
+func TestParseTreeMatchesPostfix(t *testing.T) {
+	inputs := []string{
+		"not (A eq B)",
+		"Name eq 'Milk' and Price lt 2.55",
+		"Tags/any(var:var/Key eq 'Site' and var/Value eq 'London')",
+		"Orders/all(o:o/Items/any(i:i/Price gt 2))",
+		"contains(tolower(Name),'a') or startswith(Name,'b')",
+		"geo.distance(location,geography'POINT(1 2)') lt 10",
+		"Name in ('a', 'b', 'c') and not (Age ge 18)",
+		"round(Price) eq 3 and year(Birthday) ne 2000",
+		"concat(concat(City,', '),Country) eq 'Berlin, Germany'",
+	}
+	for _, input := range inputs {
+		tokens, err := GlobalFilterLexer.Tokenize(input)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		tokens, err = foldSpatialTokens(tokens)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		tree, err := GlobalFilterParser.ParseTree(tokens)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		postfix, err := GlobalFilterParser.InfixToPostfix(tokens)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		old, err := GlobalFilterParser.PostfixToTree(postfix)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		if formatParseTree(tree) != formatParseTree(old) {
+			t.Error(input + ": expected " + formatParseTree(old) + ", got " + formatParseTree(tree))
+		}
+	}
+}
+
+// A function name followed by a paren after spaces is a call like any other.
+func TestParseTreeCallWithSpaces(t *testing.T) {
+	tree, err := parsePrattTree("round ( now ( ) )")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if tree.Token.Type != FilterTokenFunc || tree.Children[0].Token.Type != FilterTokenFunc {
+		t.Error("Expected round and now to be functions, got " + formatParseTree(tree))
+	}
+}
+
+func TestParseTreeErrors(t *testing.T) {
+	tests := map[string]string{
+		"(Name eq 'a'":      "position 0: Mismatched parenthesis, this one is never closed",
+		"substring(Name,1":  "position 9: Mismatched parenthesis, this one is never closed",
+		"Name eq 'a')":      "position 11: Mismatched parenthesis, no opening parenthesis for this one",
+		"Name eq 'a', true": "position 11: Unexpected comma outside of a function call",
+		"(Name, Age)":       "position 5: Unexpected comma in parentheses",
+		"Name in ()":        "position 8: Expected an item in this list",
+		"Age gt -":          "position 7: Missing operand for -",
+		"Age add mul 1":     "position 8: Missing operand for mul",
+		"() eq 1":           "position 1: Expected an expression before this parenthesis",
+		"Name Age":          "position 5: Expected an operator",
+	}
+	for input, expected := range tests {
+		_, err := ParseFilterString(input)
+		if err == nil {
+			t.Error("Expected an error for " + input)
+			continue
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Error("Error for " + input + " does not contain '" + expected + "': " + err.Error())
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package godata
+
+// Deep copies of parsed queries. The semantic analysis annotates the tokens
+// and rewrites the trees of a query, so a query that is resolved in several
+// places, e.g. the nested expand repeated for $levels, is copied first.
+
+func (expand *GoDataExpandQuery) clone() *GoDataExpandQuery {
+	if expand == nil {
+		return nil
+	}
+	result := &GoDataExpandQuery{make([]*ExpandItem, len(expand.ExpandItems))}
+	for i, item := range expand.ExpandItems {
+		result.ExpandItems[i] = item.clone()
+	}
+	return result
+}
+
+func (item *ExpandItem) clone() *ExpandItem {
+	result := *item
+	result.Path = cloneTokens(item.Path)
+	result.Filter = item.Filter.clone()
+	result.Search = item.Search.clone()
+	result.OrderBy = item.OrderBy.clone()
+	result.Skip = clonePointer(item.Skip)
+	result.Top = clonePointer(item.Top)
+	result.Count = clonePointer(item.Count)
+	result.Select = item.Select.clone()
+	result.Expand = item.Expand.clone()
+	return &result
+}
+
+func (sel *GoDataSelectQuery) clone() *GoDataSelectQuery {
+	if sel == nil {
+		return nil
+	}
+	result := &GoDataSelectQuery{make([]*SelectItem, len(sel.SelectItems))}
+	for i, item := range sel.SelectItems {
+		result.SelectItems[i] = &SelectItem{
+			Segments: cloneTokens(item.Segments),
+			Filter:   item.Filter.clone(),
+			Search:   item.Search.clone(),
+			OrderBy:  item.OrderBy.clone(),
+			Skip:     clonePointer(item.Skip),
+			Top:      clonePointer(item.Top),
+			Count:    clonePointer(item.Count),
+			Select:   item.Select.clone(),
+			Expand:   item.Expand.clone(),
+		}
+	}
+	return result
+}
+
+func (orderby *GoDataOrderByQuery) clone() *GoDataOrderByQuery {
+	if orderby == nil {
+		return nil
+	}
+	result := &GoDataOrderByQuery{make([]*OrderByItem, len(orderby.OrderByItems))}
+	for i, item := range orderby.OrderByItems {
+		result.OrderByItems[i] = &OrderByItem{
+			Field: cloneToken(item.Field),
+			Order: item.Order,
+			Tree:  cloneParseNode(item.Tree, nil),
+		}
+	}
+	return result
+}
+
+func (filter *GoDataFilterQuery) clone() *GoDataFilterQuery {
+	if filter == nil {
+		return nil
+	}
+	return &GoDataFilterQuery{cloneParseNode(filter.Tree, nil)}
+}
+
+func (search *GoDataSearchQuery) clone() *GoDataSearchQuery {
+	if search == nil {
+		return nil
+	}
+	return &GoDataSearchQuery{cloneParseNode(search.Tree, nil)}
+}
+
+// Copy the node with its token and its children below the parent.
+func cloneParseNode(node *ParseNode, parent *ParseNode) *ParseNode {
+	if node == nil {
+		return nil
+	}
+	result := &ParseNode{Token: cloneToken(node.Token), Parent: parent, EdmType: node.EdmType}
+	if node.Children != nil {
+		result.Children = make([]*ParseNode, len(node.Children))
+		for i, child := range node.Children {
+			result.Children[i] = cloneParseNode(child, result)
+		}
+	}
+	return result
+}
+
+func cloneToken(token *Token) *Token {
+	if token == nil {
+		return nil
+	}
+	result := *token
+	if ref, ok := token.SemanticReference.(*string); ok && ref == &token.Value {
+		// a reference to the value of the token itself
+		result.SemanticReference = &result.Value
+	}
+	return &result
+}
+
+func cloneTokens(tokens []*Token) []*Token {
+	if tokens == nil {
+		return nil
+	}
+	result := make([]*Token, len(tokens))
+	for i, token := range tokens {
+		result[i] = cloneToken(token)
+	}
+	return result
+}
+
+func clonePointer[T any](value *T) *T {
+	if value == nil {
+		return nil
+	}
+	result := *value
+	return &result
+}
@@ -0,0 +1,47 @@
+package godata
+
+import (
+	"testing"
+)
+
+func TestCloneExpand(t *testing.T) {
+	input := "Datastreams($filter=Id gt 1 and not (Id eq 3);$orderby=Id desc;$top=2;$select=Id;" +
+		"$expand=Observations($search=red;$count=true))"
+	expand, err := ParseExpandString(input)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	printed := expand.String()
+	clone := expand.clone()
+	if clone.String() != printed {
+		t.Error("Expected the copy to print as " + printed + ", got " + clone.String())
+		return
+	}
+
+	original, copied := expand.ExpandItems[0], clone.ExpandItems[0]
+	if copied == original || copied.Filter.Tree == original.Filter.Tree || copied.Top == original.Top ||
+		copied.OrderBy.OrderByItems[0].Tree.Token == original.OrderBy.OrderByItems[0].Tree.Token ||
+		copied.Expand.ExpandItems[0].Search.Tree == original.Expand.ExpandItems[0].Search.Tree {
+		t.Error("Expected the copy to share nothing with the original")
+	}
+	if tree := copied.Filter.Tree; tree.Children[0].Parent != tree {
+		t.Error("Expected the children of the copied tree to point to their parent")
+	}
+
+	// resolving the copy leaves the original as it was
+	service, err := BuildService(&thingsProvider{}, "http://localhost")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	thing, _ := service.LookupEntityType("Thing")
+	if err := SemanticizeExpandQuery(clone, service, thing); err != nil {
+		t.Error(err)
+		return
+	}
+	if expand.String() != printed || original.Path[0].SemanticType != SemanticTypeUnknown ||
+		original.Filter.Tree.Children[0].Children[0].EdmType != "" {
+		t.Error("Expected the original to be unchanged, got " + expand.String())
+	}
+}
@@ -0,0 +1,402 @@
+package godata
+
+import (
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Convert the filter back to canonical OData query text. Equivalent filters
+// that only differ in whitespace, redundant parentheses or literal formatting
+// produce the same text.
+func (filter *GoDataFilterQuery) String() string {
+	if filter == nil || filter.Tree == nil {
+		return ""
+	}
+	return printFilterNode(filter.Tree, GlobalFilterParser)
+}
+
+// Convert the search back to canonical OData query text.
+func (search *GoDataSearchQuery) String() string {
+	if search == nil || search.Tree == nil {
+		return ""
+	}
+	return printSearchNode(search.Tree)
+}
+
+// Convert the orderby back to canonical OData query text. Ascending order is
+// the default and is omitted.
+func (orderby *GoDataOrderByQuery) String() string {
+	if orderby == nil {
+		return ""
+	}
+	items := make([]string, len(orderby.OrderByItems))
+	for i, item := range orderby.OrderByItems {
+		items[i] = item.Field.Value
+		if item.Order == DESC {
+			items[i] += " " + DESC
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// Convert the select back to canonical OData query text.
+func (sel *GoDataSelectQuery) String() string {
+	if sel == nil {
+		return ""
+	}
+	items := make([]string, len(sel.SelectItems))
+	for i, item := range sel.SelectItems {
+		items[i] = item.String()
+	}
+	return strings.Join(items, ",")
+}
+
+// Convert the select item back to canonical OData query text. The options are
+// printed in a fixed order.
+func (item *SelectItem) String() string {
+	options := []string{}
+	if item.Filter != nil {
+		options = append(options, "$filter="+item.Filter.String())
+	}
+	if item.Search != nil {
+		options = append(options, "$search="+item.Search.String())
+	}
+	if item.OrderBy != nil {
+		options = append(options, "$orderby="+item.OrderBy.String())
+	}
+	if item.Skip != nil {
+		options = append(options, "$skip="+strconv.Itoa(int(*item.Skip)))
+	}
+	if item.Top != nil {
+		options = append(options, "$top="+strconv.Itoa(int(*item.Top)))
+	}
+	if item.Count != nil {
+		options = append(options, "$count="+strconv.FormatBool(bool(*item.Count)))
+	}
+	if item.Select != nil {
+		options = append(options, "$select="+item.Select.String())
+	}
+	if item.Expand != nil {
+		options = append(options, "$expand="+item.Expand.String())
+	}
+
+	result := printPath(item.Segments)
+	if len(options) > 0 {
+		result += "(" + strings.Join(options, ";") + ")"
+	}
+	return result
+}
+
+// Convert the expand back to canonical OData query text. The options of each
+// item are printed in a fixed order.
+func (expand *GoDataExpandQuery) String() string {
+	if expand == nil {
+		return ""
+	}
+	items := make([]string, len(expand.ExpandItems))
+	for i, item := range expand.ExpandItems {
+		items[i] = item.String()
+	}
+	return strings.Join(items, ",")
+}
+
+// Convert the expand item back to canonical OData query text.
+func (item *ExpandItem) String() string {
+	options := []string{}
+	if item.Filter != nil {
+		options = append(options, "$filter="+item.Filter.String())
+	}
+	if item.Search != nil {
+		options = append(options, "$search="+item.Search.String())
+	}
+	if item.OrderBy != nil {
+		options = append(options, "$orderby="+item.OrderBy.String())
+	}
+	if item.Skip != nil {
+		options = append(options, "$skip="+strconv.Itoa(int(*item.Skip)))
+	}
+	if item.Top != nil {
+		options = append(options, "$top="+strconv.Itoa(int(*item.Top)))
+	}
+	if item.Count != nil {
+		options = append(options, "$count="+strconv.FormatBool(bool(*item.Count)))
+	}
+	if item.Select != nil {
+		options = append(options, "$select="+item.Select.String())
+	}
+	if item.Expand != nil {
+		options = append(options, "$expand="+item.Expand.String())
+	}
+	if item.Levels == ExpandLevelsMax {
+		options = append(options, "$levels=max")
+	} else if item.Levels != 0 {
+		options = append(options, "$levels="+strconv.Itoa(item.Levels))
+	}
+
+	result := printPath(item.Path)
+	if len(options) > 0 {
+		result += "(" + strings.Join(options, ";") + ")"
+	}
+	return result
+}
+
+// Convert the apply back to canonical OData query text.
+func (apply *GoDataApplyQuery) String() string {
+	if apply == nil {
+		return ""
+	}
+	transformations := make([]string, len(apply.Transformations))
+	for i, t := range apply.Transformations {
+		transformations[i] = t.String()
+	}
+	return strings.Join(transformations, "/")
+}
+
+// Convert the transformation back to canonical OData query text.
+func (t *ApplyTransformation) String() string {
+	args := []string{}
+	switch t.Kind {
+	case ApplyIdentity:
+		return t.Name
+	case ApplyAggregate:
+		for _, aggregate := range t.Aggregates {
+			if aggregate.Expression == nil {
+				args = append(args, "$count as "+aggregate.Alias)
+			} else {
+				args = append(args, printFilterNode(aggregate.Expression, GlobalFilterParser)+
+					" with "+aggregate.Method+" as "+aggregate.Alias)
+			}
+		}
+	case ApplyCompute:
+		for _, compute := range t.Computes {
+			args = append(args, printFilterNode(compute.Expression, GlobalFilterParser)+" as "+compute.Alias)
+		}
+	case ApplyGroupBy:
+		paths := make([]string, len(t.GroupBy))
+		for i, path := range t.GroupBy {
+			paths[i] = printPath(path)
+		}
+		args = append(args, "("+strings.Join(paths, ",")+")")
+		if t.Apply != nil {
+			args = append(args, t.Apply.String())
+		}
+	case ApplyFilter:
+		args = append(args, t.Filter.String())
+	case ApplySearch:
+		args = append(args, t.Search.String())
+	case ApplyOrderBy:
+		args = append(args, t.OrderBy.String())
+	case ApplyExpand:
+		return printApplyExpand(t.Expand)
+	case ApplyConcat:
+		for _, sequence := range t.Sequences {
+			args = append(args, sequence.String())
+		}
+	case ApplyTop, ApplySkip:
+		args = append(args, strconv.FormatFloat(t.N, 'f', -1, 64))
+	default:
+		args = append(args, strconv.FormatFloat(t.N, 'f', -1, 64), printFilterNode(t.Expression, GlobalFilterParser))
+	}
+	return t.Name + "(" + strings.Join(args, ",") + ")"
+}
+
+// Print the expand transformation of the item and its nested expands.
+func printApplyExpand(item *ExpandItem) string {
+	args := []string{printPath(item.Path)}
+	if item.Filter != nil {
+		args = append(args, "filter("+item.Filter.String()+")")
+	}
+	if item.Expand != nil {
+		for _, nested := range item.Expand.ExpandItems {
+			args = append(args, printApplyExpand(nested))
+		}
+	}
+	return "expand(" + strings.Join(args, ",") + ")"
+}
+
+// Convert the query back to URL query parameters. Use this to build next
+// links that preserve the options of a request, or encode the result to
+// build a cache key from a normalized query.
+func (query *GoDataQuery) Values() url.Values {
+	values := url.Values{}
+	if query == nil {
+		return values
+	}
+	if query.Filter != nil {
+		values.Set("$filter", query.Filter.String())
+	}
+	if query.Apply != nil {
+		values.Set("$apply", query.Apply.String())
+	}
+	if query.Expand != nil {
+		values.Set("$expand", query.Expand.String())
+	}
+	if query.Select != nil {
+		values.Set("$select", query.Select.String())
+	}
+	if query.OrderBy != nil {
+		values.Set("$orderby", query.OrderBy.String())
+	}
+	if query.Top != nil {
+		values.Set("$top", strconv.Itoa(int(*query.Top)))
+	}
+	if query.Skip != nil {
+		values.Set("$skip", strconv.Itoa(int(*query.Skip)))
+	}
+	if query.Count != nil {
+		values.Set("$count", strconv.FormatBool(bool(*query.Count)))
+	}
+	if query.InlineCount != nil {
+		values.Set("$inlinecount", string(*query.InlineCount))
+	}
+	if query.Search != nil {
+		values.Set("$search", query.Search.String())
+	}
+	return values
+}
+
+func printPath(segments []*Token) string {
+	parts := make([]string, len(segments))
+	for i, segment := range segments {
+		parts[i] = segment.Value
+	}
+	return strings.Join(parts, "/")
+}
+
+// Print a node of a filter tree, adding parentheses where the precedence of
+// the operators of the parser requires them.
+func printFilterNode(node *ParseNode, parser *Parser) string {
+	switch node.Token.Type {
+	case FilterTokenFunc, FilterTokenLambda:
+		if f, ok := parser.Functions[node.Token.Value]; ok && len(node.Children) == 0 && !f.Accepts(0) {
+			// a bare lambda such as all is only valid without parentheses
+			return node.Token.Value
+		}
+		args := make([]string, len(node.Children))
+		for i, child := range node.Children {
+			args[i] = printFilterNode(child, parser)
+		}
+		return node.Token.Value + "(" + strings.Join(args, ",") + ")"
+	case FilterTokenList:
+		items := make([]string, len(node.Children))
+		for i, child := range node.Children {
+			items[i] = printFilterNode(child, parser)
+		}
+		return "(" + strings.Join(items, ",") + ")"
+	case FilterTokenNav, FilterTokenColon:
+		if len(node.Children) == 2 {
+			return printOperand(node, 0, parser) + node.Token.Value + printOperand(node, 1, parser)
+		}
+	}
+	// operators are printed by their value, as infix operators like cast and
+	// isof are tokenized as literals
+	if _, ok := parser.Operators[node.Token.Value]; ok {
+		switch len(node.Children) {
+		case 1:
+			if node.Token.Value == "-" {
+				return "-" + printOperand(node, 0, parser)
+			}
+			return node.Token.Value + " " + printOperand(node, 0, parser)
+		case 2:
+			return printOperand(node, 0, parser) + " " + node.Token.Value + " " +
+				printOperand(node, 1, parser)
+		}
+	}
+	if len(node.Children) == 0 {
+		return printLiteral(node.Token)
+	}
+	args := make([]string, len(node.Children))
+	for i, child := range node.Children {
+		args[i] = printFilterNode(child, parser)
+	}
+	return node.Token.Value + "(" + strings.Join(args, ",") + ")"
+}
+
+// Print the child of an operator node, in parentheses if it binds less
+// tightly than the operator.
+func printOperand(node *ParseNode, i int, parser *Parser) string {
+	child := node.Children[i]
+	result := printFilterNode(child, parser)
+
+	if len(child.Children) == 0 || child.Token.Type == FilterTokenFunc || child.Token.Type == FilterTokenList ||
+		child.Token.Type == FilterTokenLambda {
+		return result
+	}
+	op, ok := parser.Operators[node.Token.Value]
+	if ok && op.List && i == 1 {
+		// parentheses would turn the operand into a list
+		return result
+	}
+	childOp, childOk := parser.Operators[child.Token.Value]
+	if !ok || !childOk || len(child.Children) < 2 && childOp.Precedence >= op.Precedence {
+		// unary operators only need parentheses if they bind less tightly
+		return result
+	}
+
+	switch {
+	case childOp.Precedence > op.Precedence:
+		return result
+	case childOp.Precedence == op.Precedence && len(node.Children) == 2 &&
+		(i == 0 && op.Association == OpAssociationLeft ||
+			i == 1 && op.Association == OpAssociationRight):
+		return result
+	}
+	return "(" + result + ")"
+}
+
+// Print a literal token in its canonical form.
+func printLiteral(token *Token) string {
+	switch token.Type {
+	case FilterTokenString:
+		s, err := token.LiteralValue()
+		if err != nil {
+			return token.Value
+		}
+		return "'" + strings.ReplaceAll(s.(string), "'", "''") + "'"
+	case FilterTokenInteger:
+		if i, err := strconv.ParseInt(token.Value, 10, 64); err == nil {
+			return strconv.FormatInt(i, 10)
+		}
+	case FilterTokenFloat:
+		if floatLiteralEdmType(token.Value) != GoDataDecimal {
+			// doubles and singles keep their exponent or suffix
+			return token.Value
+		}
+		// decimals keep all their digits
+		if r, err := token.LiteralValue(); err == nil {
+			if s, ok := printDecimalValue(r.(*big.Rat)); ok {
+				return s
+			}
+		}
+	case FilterTokenNull, FilterTokenBoolean, FilterTokenGuid:
+		return strings.ToLower(token.Value)
+	case FilterTokenDuration, FilterTokenBinary:
+		i := strings.Index(token.Value, "'")
+		return strings.ToLower(token.Value[:i]) + token.Value[i:]
+	}
+	return token.Value
+}
+
+// Print a node of a search tree.
+func printSearchNode(node *ParseNode) string {
+	op, ok := GlobalSearchParser.Operators[node.Token.Value]
+	if !ok || len(node.Children) == 0 {
+		return node.Token.Value
+	}
+
+	operands := make([]string, len(node.Children))
+	for i, child := range node.Children {
+		operands[i] = printSearchNode(child)
+		if childOp, ok := GlobalSearchParser.Operators[child.Token.Value]; ok &&
+			len(child.Children) > 0 && childOp.Precedence < op.Precedence {
+			operands[i] = "(" + operands[i] + ")"
+		}
+	}
+
+	if len(operands) == 1 {
+		return node.Token.Value + " " + operands[0]
+	}
+	return strings.Join(operands, " "+node.Token.Value+" ")
+}
@@ -0,0 +1,218 @@
+package godata
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math/big"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestPrintFilter(t *testing.T) {
+	tests := map[string]string{
+		"Name eq 'Milk' and Price lt 2.55":        "Name eq 'Milk' and Price lt 2.55",
+		"((Name eq 'Milk'))  and (Price lt 2.50)": "Name eq 'Milk' and Price lt 2.5",
+		"not (A eq B)":                                    "not (A eq B)",
+		"(A or B) and C":                                  "(A or B) and C",
+		"A or (B and C)":                                  "A or B and C",
+		"Price mul (2 add Tax) gt 10":                     "Price mul (2 add Tax) gt 10",
+		"Name eq 'O''Neil'":                               "Name eq 'O''Neil'",
+		"Price eq 007 or Price eq 2.0":                    "Price eq 7 or Price eq 2.0",
+		"Price eq 1234567890.123456789012":                "Price eq 1234567890.123456789012",
+		"Price eq 0.100m or Price eq -3m":                 "Price eq 0.1 or Price eq -3.0",
+		"contains(Address/City, 'Red')":                   "contains(Address/City,'Red')",
+		"Tags/any(d:d/Key eq 'Site' and d/Value lt 10)":   "Tags/any(d:d/Key eq 'Site' and d/Value lt 10)",
+		"st_within(location, geography'POINT(7.5 51.5)')": "st_within(location,geography'POINT(7.5 51.5)')",
+		"Created lt 2015-10-14T23:30:00.104+02:00":        "Created lt 2015-10-14T23:30:00.104+02:00",
+		"Discount eq null":                                "Discount eq null",
+		"Ratio eq 1.5e3 or Timeout eq DURATION'P1D'":      "Ratio eq 1.5e3 or Timeout eq duration'P1D'",
+		"Age cast Edm.Int64 eq 1":                         "Age cast Edm.Int64 eq 1",
+		"'a' isof 'a'":                                    "'a' isof 'a'",
+		"Tags/all":                                        "Tags/all",
+		"Tags/any":                                        "Tags/any()",
+		"Active in not Tags":                              "Active in not Tags",
+		"Name in ('a', 'b')":                              "Name in ('a','b')",
+	}
+
+	for input, expected := range tests {
+		filter, err := ParseFilterString(input)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		actual := filter.String()
+		if actual != expected {
+			t.Error("Printed '" + input + "' as '" + actual + "' not '" + expected + "'")
+			continue
+		}
+
+		// printing must be stable
+		reparsed, err := ParseFilterString(actual)
+		if err != nil {
+			t.Error(actual + ": " + err.Error())
+			continue
+		}
+		if reparsed.String() != actual {
+			t.Error("Reprinted '" + actual + "' as '" + reparsed.String() + "'")
+		}
+	}
+}
+
+// Collect the string literals of the tests of this package, the inputs of
+// the filter tests among them.
+func testStringLiterals() ([]string, error) {
+	files, err := filepath.Glob("*_test.go")
+	if err != nil {
+		return nil, err
+	}
+	var literals []string
+	fset := token.NewFileSet()
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			if lit, ok := n.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				if s, err := strconv.Unquote(lit.Value); err == nil {
+					literals = append(literals, s)
+				}
+			}
+			return true
+		})
+	}
+	return literals, nil
+}
+
+// Compare two filter trees by their tokens, with literals in canonical form.
+func sameFilterTree(a, b *ParseNode) bool {
+	if a.Token.Type != b.Token.Type || printLiteral(a.Token) != printLiteral(b.Token) ||
+		len(a.Children) != len(b.Children) {
+		return false
+	}
+	for i := range a.Children {
+		if !sameFilterTree(a.Children[i], b.Children[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Every filter of the tests must print as text that parses into the same tree.
+func TestPrintFilterRoundTrip(t *testing.T) {
+	literals, err := testStringLiterals()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	filters := 0
+	for _, input := range literals {
+		filter, err := ParseFilterString(input)
+		if err != nil {
+			continue
+		}
+		filters++
+		printed := filter.String()
+		reparsed, err := ParseFilterString(printed)
+		if err != nil {
+			t.Error("Printed '" + input + "' as '" + printed + "': " + err.Error())
+			continue
+		}
+		if !sameFilterTree(filter.Tree, reparsed.Tree) {
+			t.Error("Printed '" + input + "' as '" + printed + "', which parses into " +
+				formatParseTree(reparsed.Tree) + " instead of " + formatParseTree(filter.Tree))
+		}
+	}
+	if filters < 100 {
+		t.Error("Expected at least 100 filters in the tests, found " + strconv.Itoa(filters))
+	}
+}
+
+func TestPrintDecimalRoundTrip(t *testing.T) {
+	inputs := []string{"1234567890.123456789012", "0.30000000000000000000001", "-0.000000000000000000001", "12345678901234567890.5"}
+	for _, input := range inputs {
+		filter, err := ParseFilterString("Price eq " + input)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		reparsed, err := ParseFilterString(filter.String())
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		expected, _ := filter.Tree.Children[1].Token.LiteralValue()
+		actual, err := reparsed.Tree.Children[1].Token.LiteralValue()
+		if err != nil || actual.(*big.Rat).Cmp(expected.(*big.Rat)) != 0 {
+			t.Error(input + " is printed as " + filter.String())
+		}
+	}
+}
+
+func TestPrintSearch(t *testing.T) {
+	tests := map[string]string{
+		"mountain OR (\"red bikes\" AND avocados)": "mountain OR \"red bikes\" AND avocados",
+		"NOT (blue OR green)":                      "NOT (blue OR green)",
+		"(blue OR green) AND red":                  "(blue OR green) AND red",
+	}
+
+	for input, expected := range tests {
+		search, err := ParseSearchString(input)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		if search.String() != expected {
+			t.Error("Printed '" + input + "' as '" + search.String() + "' not '" + expected + "'")
+		}
+	}
+}
+
+func TestPrintExpand(t *testing.T) {
+	input := "Products($top=5;$filter=not (DiscontinuedDate eq null);$select=Name,Price),Orders/Customer"
+	expected := "Products($filter=not (DiscontinuedDate eq null);$top=5;$select=Name,Price),Orders/Customer"
+
+	expand, err := ParseExpandString(input)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if expand.String() != expected {
+		t.Error("Printed expand as '" + expand.String() + "' not '" + expected + "'")
+	}
+}
+
+func TestPrintQueryValues(t *testing.T) {
+	testUrl := "Customers?$filter=(Name eq 'Bob')&$orderby=Name asc,Age desc&$top=10&$skip=20&$count=true"
+	parsedUrl, err := url.Parse(testUrl)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	request, err := ParseRequest(parsedUrl.Path, parsedUrl.Query())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	values := request.Query.Values()
+	expected := map[string]string{
+		"$filter":  "Name eq 'Bob'",
+		"$orderby": "Name,Age desc",
+		"$top":     "10",
+		"$skip":    "20",
+		"$count":   "true",
+	}
+	for k, v := range expected {
+		if values.Get(k) != v {
+			t.Error(k + " is '" + values.Get(k) + "' not '" + v + "'")
+		}
+	}
+	if len(values) != len(expected) {
+		t.Error("Unexpected query options: " + values.Encode())
+	}
+}
@@ -27,6 +27,12 @@ const (
 	SemanticTypeRef
 	SemanticTypeCount
 	SemanticTypeMetadata
+	// A variable declared by an any or all operator in a filter. Refers to the
+	// entity type of the elements of the collection, if it is one.
+	SemanticTypeLambdaVariable
+	// All actions and functions of a schema, selected with Namespace.*.
+	// Refers to the schema.
+	SemanticTypeSchema
 )
 
 type GoDataRequest struct {
@@ -57,6 +63,10 @@ type GoDataSegment struct {
 	// identifier, it will be nil.
 	Identifier *GoDataIdentifier
 
+	// The values of the identifier whose key properties have an enumeration
+	// type, by the names of the key properties.
+	EnumKeys map[string]*GoDataEnumValue
+
 	// The next segment in the path.
 	Next *GoDataSegment
 	// The previous segment in the path.
@@ -84,7 +94,11 @@ type GoDataFilterQuery struct {
 	Tree *ParseNode
 }
 
-type GoDataApplyQuery string
+// Stores the parsed transformations of $apply, which are applied one after
+// another.
+type GoDataApplyQuery struct {
+	Transformations []*ApplyTransformation
+}
 
 type GoDataExpandQuery struct {
 	ExpandItems []*ExpandItem
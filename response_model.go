@@ -30,8 +30,9 @@ type GoDataResponseField struct {
 }
 
 // Convert the response field to a JSON serialized form. If the type is not
-// string, []byte, int, float64, map[string]*GoDataResponseField, or
-// []*GoDataResponseField, then an error will be thrown.
+// string, []byte, int, float64, *GoDataEnumValue,
+// map[string]*GoDataResponseField, or []*GoDataResponseField, then an error
+// will be thrown.
 func (f *GoDataResponseField) Json() ([]byte, error) {
 	switch f.Value.(type) {
 	case string:
@@ -42,6 +43,8 @@ func (f *GoDataResponseField) Json() ([]byte, error) {
 		return []byte(strconv.Itoa(f.Value.(int))), nil
 	case float64:
 		return []byte(strconv.FormatFloat(f.Value.(float64), 'f', -1, 64)), nil
+	case *GoDataEnumValue:
+		return prepareJsonString([]byte(f.Value.(*GoDataEnumValue).String()))
 	case map[string]*GoDataResponseField:
 		return prepareJsonDict(f.Value.(map[string]*GoDataResponseField))
 	case []*GoDataResponseField:
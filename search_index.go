@@ -0,0 +1,286 @@
+package godata
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The names of the properties of an entity type that $search matches: the
+// properties marked Searchable, or all Edm.String properties if none is
+// marked.
+func (service *GoDataService) SearchableProperties(entityType string) ([]string, error) {
+	t, err := service.LookupEntityType(entityType)
+	if err != nil {
+		return nil, err
+	}
+	marked, texts := []string{}, []string{}
+	for _, p := range t.Properties {
+		if p.Searchable {
+			marked = append(marked, p.Name)
+		}
+		if p.Type == GoDataString {
+			texts = append(texts, p.Name)
+		}
+	}
+	if len(marked) > 0 {
+		return marked, nil
+	}
+	return texts, nil
+}
+
+// A SearchIndex is an in-memory inverted index that evaluates $search queries
+// against entities, e.g. in providers that serve data from memory. Entities
+// are maps with string keys or structs like for the FilterEvaluator, and
+// their searchable properties are split into terms by Tokenize and reduced by
+// Stem. The terms of a query are processed the same way.
+//
+// A word matches the entities containing its terms, a phrase the entities
+// containing its terms in order within one property. Matches are ranked by
+// the number of occurrences of the matched terms, weighted by their rarity.
+type SearchIndex struct {
+	// The paths of the indexed properties, e.g. Name or Address/City.
+	Properties []string
+	// Splits a text into terms. Defaults to SplitSearchTerms.
+	Tokenize func(text string) []string
+	// Reduces a term to the form it is indexed by, e.g. its stem. Terms are
+	// unchanged if it is nil.
+	Stem func(term string) string
+
+	// the positions of each term in each entity
+	postings map[string]map[int][]int
+	// the terms of each entity, nil for removed entities
+	entities [][]string
+	count    int
+}
+
+// A match of a search: the id of the entity and its score.
+type SearchResult struct {
+	ID    int
+	Score float64
+}
+
+// Create an index of the properties with the given paths.
+func NewSearchIndex(properties ...string) *SearchIndex {
+	return &SearchIndex{Properties: properties, postings: map[string]map[int][]int{}}
+}
+
+// Split a text into lowercase words of letters and digits.
+func SplitSearchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Split a text into the terms of the index.
+func (index *SearchIndex) terms(text string) []string {
+	tokenize := index.Tokenize
+	if tokenize == nil {
+		tokenize = SplitSearchTerms
+	}
+	terms := tokenize(text)
+	if index.Stem != nil {
+		for i, term := range terms {
+			terms[i] = index.Stem(term)
+		}
+	}
+	return terms
+}
+
+// Add an entity to the index and return its id, which identifies it in the
+// results of Search. Ids are assigned in the order entities are added,
+// starting at zero.
+func (index *SearchIndex) Add(entity interface{}) (int, error) {
+	values := make([]string, len(index.Properties))
+	for i, path := range index.Properties {
+		value, err := searchPropertyValue(entity, path)
+		if err != nil {
+			return -1, err
+		}
+		values[i] = value
+	}
+	if index.postings == nil {
+		index.postings = map[string]map[int][]int{}
+	}
+
+	id := len(index.entities)
+	terms := []string{}
+	position := 0
+	for _, value := range values {
+		for _, term := range index.terms(value) {
+			if index.postings[term] == nil {
+				index.postings[term] = map[int][]int{}
+			}
+			index.postings[term][id] = append(index.postings[term][id], position)
+			terms = append(terms, term)
+			position++
+		}
+		// phrases do not span properties
+		position++
+	}
+	index.entities = append(index.entities, terms)
+	index.count++
+	return id, nil
+}
+
+// Remove the entity with the id from the index.
+func (index *SearchIndex) Remove(id int) {
+	if id < 0 || id >= len(index.entities) || index.entities[id] == nil {
+		return
+	}
+	for _, term := range index.entities[id] {
+		delete(index.postings[term], id)
+		if len(index.postings[term]) == 0 {
+			delete(index.postings, term)
+		}
+	}
+	index.entities[id] = nil
+	index.count--
+}
+
+// The number of entities in the index.
+func (index *SearchIndex) Len() int {
+	return index.count
+}
+
+// Find the entities matching the search, ordered by descending score and by
+// id for equal scores. An empty search matches all entities.
+func (index *SearchIndex) Search(search *GoDataSearchQuery) ([]SearchResult, error) {
+	expr, err := search.Expression()
+	if err != nil {
+		return nil, err
+	}
+	var matches map[int]float64
+	if expr == nil {
+		matches = index.all()
+	} else {
+		matches = index.evaluate(expr)
+	}
+
+	results := make([]SearchResult, 0, len(matches))
+	for id, score := range matches {
+		results = append(results, SearchResult{id, score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+	return results, nil
+}
+
+// The entities matching the expression and their scores.
+func (index *SearchIndex) evaluate(expr *SearchExpression) map[int]float64 {
+	switch expr.Kind {
+	case SearchNodeTerm, SearchNodePhrase:
+		// a word may consist of several terms, e.g. e-mail
+		return index.phrase(index.terms(expr.Text))
+	case SearchNodeNot:
+		excluded := index.evaluate(expr.Operands[0])
+		result := map[int]float64{}
+		for id := range index.all() {
+			if _, ok := excluded[id]; !ok {
+				result[id] = 0
+			}
+		}
+		return result
+	case SearchNodeAnd:
+		left, right := index.evaluate(expr.Operands[0]), index.evaluate(expr.Operands[1])
+		result := map[int]float64{}
+		for id, score := range left {
+			if other, ok := right[id]; ok {
+				result[id] = score + other
+			}
+		}
+		return result
+	case SearchNodeOr:
+		result := index.evaluate(expr.Operands[0])
+		for id, score := range index.evaluate(expr.Operands[1]) {
+			result[id] += score
+		}
+		return result
+	}
+	return map[int]float64{}
+}
+
+// The entities containing the terms in order and their scores.
+func (index *SearchIndex) phrase(terms []string) map[int]float64 {
+	result := map[int]float64{}
+	if len(terms) == 0 {
+		return result
+	}
+	for id, positions := range index.postings[terms[0]] {
+		occurrences := 0
+		for _, start := range positions {
+			if index.followedBy(id, start, terms[1:]) {
+				occurrences++
+			}
+		}
+		if occurrences > 0 {
+			result[id] = float64(occurrences) * index.weight(terms)
+		}
+	}
+	return result
+}
+
+// Check whether the terms follow the position in the entity.
+func (index *SearchIndex) followedBy(id, position int, terms []string) bool {
+	for i, term := range terms {
+		positions := index.postings[term][id]
+		j := sort.SearchInts(positions, position+i+1)
+		if j == len(positions) || positions[j] != position+i+1 {
+			return false
+		}
+	}
+	return true
+}
+
+// The weight of an occurrence of the terms, the sum of their inverse
+// document frequencies.
+func (index *SearchIndex) weight(terms []string) float64 {
+	weight := 0.0
+	for _, term := range terms {
+		weight += math.Log(1 + float64(index.count)/float64(len(index.postings[term])))
+	}
+	return weight
+}
+
+// All entities with a score of zero.
+func (index *SearchIndex) all() map[int]float64 {
+	result := make(map[int]float64, index.count)
+	for id, terms := range index.entities {
+		if terms != nil {
+			result[id] = 0
+		}
+	}
+	return result
+}
+
+// The text of a property of an entity, following a path separated by
+// slashes. Values that are not strings are formatted as in a URL.
+func searchPropertyValue(entity interface{}, path string) (string, error) {
+	value := entity
+	for _, name := range strings.Split(path, "/") {
+		var err error
+		if value, err = propertyValue(value, name); err != nil {
+			return "", err
+		}
+		if value == nil {
+			return "", nil
+		}
+	}
+	switch value := normalizeValue(value).(type) {
+	case string:
+		return value, nil
+	case int64:
+		return strconv.FormatInt(value, 10), nil
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,160 @@
+package godata
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type searchProduct struct {
+	Name        string
+	Description string `json:"description"`
+	Year        int
+	Address     map[string]interface{}
+}
+
+func newProductIndex(t *testing.T) *SearchIndex {
+	index := NewSearchIndex("Name", "description", "Year", "Address/City")
+	products := []searchProduct{
+		{Name: "Red mountain bike", Description: "A bike for the mountains.", Year: 2020},
+		{Name: "Blue road bike", Description: "Fast on the road, red stripes.", Year: 2021},
+		{Name: "Red bikes poster", Description: "Mountain bike, red bikes", Address: map[string]interface{}{"City": "Köln"}},
+		{Name: "Avocados", Description: "Ripe. Not a bike."},
+	}
+	for i, product := range products {
+		id, err := index.Add(product)
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		if id != i {
+			t.Error("Expected id " + strconv.Itoa(i) + ", got " + strconv.Itoa(id))
+			return nil
+		}
+	}
+	return index
+}
+
+func searchIDs(t *testing.T, index *SearchIndex, search string) string {
+	query, err := ParseSearchString(search)
+	if err != nil {
+		t.Error(search + ": " + err.Error())
+		return ""
+	}
+	results, err := index.Search(query)
+	if err != nil {
+		t.Error(search + ": " + err.Error())
+		return ""
+	}
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = strconv.Itoa(result.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestSearchIndex(t *testing.T) {
+	index := newProductIndex(t)
+	if index == nil {
+		return
+	}
+	tests := map[string]string{
+		"bike":                    "0,1,2,3",
+		"mountain":                "0,2",
+		"red bike":                "2,0,1",
+		"\"red bikes\"":           "2",
+		"\"bike red\"":            "2",
+		"\"poster mountain\"":     "",
+		"NOT bike":                "",
+		"bike NOT red":            "3",
+		"avocados OR mountain":    "3,0,2",
+		"Köln":                    "2",
+		"2021":                    "1",
+		"road-bike":               "1",
+		"(red OR blue) NOT Köln":  "1,0",
+		"-avocados":               "3",
+		"unknown OR \"not a\"":    "3",
+		"unknown AND bike":        "",
+		"\"ripe not a bike\" red": "",
+	}
+	for search, expected := range tests {
+		if actual := searchIDs(t, index, search); actual != expected {
+			t.Error(search + ": expected " + expected + ", got " + actual)
+		}
+	}
+}
+
+func TestSearchIndexRemove(t *testing.T) {
+	index := newProductIndex(t)
+	if index == nil {
+		return
+	}
+	index.Remove(2)
+	index.Remove(2)
+	if index.Len() != 3 {
+		t.Error("Expected 3 entities, got " + strconv.Itoa(index.Len()))
+	}
+	if actual := searchIDs(t, index, "mountain OR poster"); actual != "0" {
+		t.Error("Expected 0, got " + actual)
+	}
+	if actual := searchIDs(t, index, "NOT avocados"); actual != "0,1" {
+		t.Error("Expected 0,1, got " + actual)
+	}
+	results, err := index.Search(nil)
+	if err != nil || len(results) != 3 {
+		t.Error("Expected an empty search to match the 3 entities")
+	}
+}
+
+func TestSearchIndexStem(t *testing.T) {
+	index := NewSearchIndex("Name")
+	index.Stem = func(term string) string {
+		return strings.TrimSuffix(term, "s")
+	}
+	for _, name := range []string{"bikes", "bike", "avocado"} {
+		if _, err := index.Add(map[string]interface{}{"Name": name}); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if actual := searchIDs(t, index, "bike"); actual != "0,1" {
+		t.Error("Expected 0,1, got " + actual)
+	}
+	if actual := searchIDs(t, index, "avocados"); actual != "2" {
+		t.Error("Expected 2, got " + actual)
+	}
+}
+
+func TestSearchableProperties(t *testing.T) {
+	provider := &DummyProvider{}
+	service, err := BuildService(provider, "http://localhost")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	properties, err := service.SearchableProperties("Customer")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if strings.Join(properties, ",") != "Name" {
+		t.Error("Expected the string property Name, got " + strings.Join(properties, ","))
+	}
+
+	entity, _ := service.LookupEntityType("Customer")
+	for _, property := range entity.Properties {
+		property.Searchable = property.Name == "Age" || property.Name == "Tier"
+	}
+	properties, err = service.SearchableProperties("Store.Customer")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if strings.Join(properties, ",") != "Age,Tier" {
+		t.Error("Expected the marked properties Age,Tier, got " + strings.Join(properties, ","))
+	}
+
+	if _, err := service.SearchableProperties("Unknown"); err == nil {
+		t.Error("Expected an error for an unknown entity type")
+	}
+}
@@ -1,5 +1,10 @@
 package godata
 
+import (
+	"strconv"
+	"strings"
+)
+
 const (
 	SearchTokenLiteral int = iota
 	SearchTokenOpenParen
@@ -13,32 +18,157 @@ var (
 	GlobalSearchParser    = SearchParser()
 )
 
-// Convert an input string from the $filter part of the URL into a parse
+// The kinds of the nodes of a search expression.
+const (
+	SearchNodeTerm int = iota
+	SearchNodePhrase
+	SearchNodeAnd
+	SearchNodeOr
+	SearchNodeNot
+)
+
+// A node of the typed tree of a $search. Terms and phrases are the leaves,
+// and, or and not have their operands as children.
+type SearchExpression struct {
+	Kind int
+	// The text of a term, or of a phrase without the quotes and escapes.
+	Text     string
+	Operands []*SearchExpression
+}
+
+// Convert an input string from the $search part of the URL into a parse
 // tree that can be used by providers to create a response.
+//
+// The grammar is the searchExpr of the OData ABNF: words and phrases in double
+// quotes combined with NOT, AND and OR in this order of precedence, where
+// words that are only separated by whitespace are combined with AND. A word
+// is any text up to the next space, paren or double quote, so it may start
+// with a minus or contain letters of any script. In a phrase, a backslash
+// escapes a double quote or a backslash.
 func ParseSearchString(filter string) (*GoDataSearchQuery, error) {
-	tokens, err := GlobalSearchTokenizer.Tokenize(filter)
+	result, err := parseSearchString(filter)
 	if err != nil {
-		return nil, err
+		return nil, optionError("$search", filter, err)
 	}
-	postfix, err := GlobalSearchParser.InfixToPostfix(tokens)
+	return result, nil
+}
+
+func parseSearchString(filter string) (*GoDataSearchQuery, error) {
+	tokens, err := GlobalSearchLexer.Tokenize(filter)
 	if err != nil {
 		return nil, err
 	}
-	tree, err := GlobalSearchParser.PostfixToTree(postfix)
+	if len(tokens) == 0 {
+		return nil, &SyntaxError{0, "Empty expression"}
+	}
+	tree, err := GlobalSearchParser.ParseTree(implicitSearchAnd(joinSearchWords(tokens)))
 	if err != nil {
 		return nil, err
 	}
 	return &GoDataSearchQuery{tree}, nil
 }
 
-// Create a tokenizer capable of tokenizing filter statements
+// Join an operator with the word right after it, e.g. AND-x, into one word.
+// The tokenizers end an operator at any character that is not a letter, a
+// digit or an underscore, but only whitespace, parens and quotes end words.
+func joinSearchWords(tokens []*Token) []*Token {
+	result := make([]*Token, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if token.Type == SearchTokenOp && i+1 < len(tokens) {
+			next := tokens[i+1]
+			if next.Type == SearchTokenLiteral && next.Value[0] != '"' &&
+				next.Offset == token.Offset+len(token.Value) {
+				token = &Token{Value: token.Value + next.Value, Type: SearchTokenLiteral, Offset: token.Offset}
+				i++
+			}
+		}
+		result = append(result, token)
+	}
+	return result
+}
+
+// Insert an AND between two adjacent operands, e.g. between the words of
+// "red blue".
+func implicitSearchAnd(tokens []*Token) []*Token {
+	result := make([]*Token, 0, len(tokens))
+	for i, token := range tokens {
+		if i > 0 {
+			prev := tokens[i-1]
+			ends := prev.Type == SearchTokenLiteral || prev.Type == SearchTokenCloseParen
+			starts := token.Type == SearchTokenLiteral || token.Type == SearchTokenOpenParen || token.Value == "NOT"
+			if ends && starts {
+				result = append(result, &Token{Value: "AND", Type: SearchTokenOp, Offset: token.Offset})
+			}
+		}
+		result = append(result, token)
+	}
+	return result
+}
+
+// Build the typed expression for the search tree.
+func (search *GoDataSearchQuery) Expression() (*SearchExpression, error) {
+	if search == nil || search.Tree == nil {
+		return nil, nil
+	}
+	return BuildSearchExpression(search.Tree)
+}
+
+// Convert a node of a parse tree produced by ParseSearchString into a typed
+// expression.
+func BuildSearchExpression(node *ParseNode) (*SearchExpression, error) {
+	if node.Token.Type == SearchTokenLiteral {
+		if len(node.Children) > 0 {
+			return nil, BadRequestError("Search term " + node.Token.Value + " has operands.")
+		}
+		if value := node.Token.Value; strings.HasPrefix(value, "\"") {
+			return &SearchExpression{Kind: SearchNodePhrase, Text: unescapeSearchPhrase(value)}, nil
+		}
+		return &SearchExpression{Kind: SearchNodeTerm, Text: node.Token.Value}, nil
+	}
+
+	kinds := map[string]int{"AND": SearchNodeAnd, "OR": SearchNodeOr, "NOT": SearchNodeNot}
+	kind, ok := kinds[node.Token.Value]
+	if node.Token.Type != SearchTokenOp || !ok {
+		return nil, BadRequestError("Invalid search node " + node.Token.Value)
+	}
+	op := GlobalSearchParser.Operators[node.Token.Value]
+	if len(node.Children) != op.Operands {
+		return nil, BadRequestError("Search operator " + node.Token.Value + " requires " +
+			strconv.Itoa(op.Operands) + " operands.")
+	}
+	result := &SearchExpression{Kind: kind}
+	for _, child := range node.Children {
+		operand, err := BuildSearchExpression(child)
+		if err != nil {
+			return nil, err
+		}
+		result.Operands = append(result.Operands, operand)
+	}
+	return result, nil
+}
+
+// The text of a phrase without the quotes and escapes.
+func unescapeSearchPhrase(phrase string) string {
+	var b strings.Builder
+	phrase = phrase[1 : len(phrase)-1]
+	for i := 0; i < len(phrase); i++ {
+		if phrase[i] == '\\' && i+1 < len(phrase) {
+			i++
+		}
+		b.WriteByte(phrase[i])
+	}
+	return b.String()
+}
+
+// Create a tokenizer capable of tokenizing search statements
 func SearchTokenizer() *Tokenizer {
 	t := Tokenizer{}
-	t.Add("^\\\"[^\\\"]+\\\"", SearchTokenLiteral)
+	t.Add(`^"(\\[\\"]|[^"\\])+"`, SearchTokenLiteral)
 	t.Add("^\\(", SearchTokenOpenParen)
 	t.Add("^\\)", SearchTokenCloseParen)
-	t.Add("^(OR|AND|NOT)", SearchTokenOp)
-	t.Add("^[\\w]+", SearchTokenLiteral)
+	t.Add("^(OR|AND|NOT)\\b", SearchTokenOp)
+	t.Add(`^[^ ()"]+`, SearchTokenLiteral)
 	t.Ignore("^ ", SearchTokenWhitespace)
 
 	return &t
@@ -1,6 +1,7 @@
 package godata
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -27,3 +28,89 @@ func TestSearchQuery(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestParseSearch(t *testing.T) {
+	tests := map[string]string{
+		"red blue":                    "AND(red,blue)",
+		"red blue OR green":           "OR(AND(red,blue),green)",
+		"red (blue OR green)":         "AND(red,OR(blue,green))",
+		"red NOT blue":                "AND(red,NOT(blue))",
+		"NOT NOT red":                 "NOT(NOT(red))",
+		"NOT red blue":                "AND(NOT(red),blue)",
+		"\"red bikes\" mountain":      "AND(\"red bikes\",mountain)",
+		"\"say \\\"hi\\\"\" OR \\":    "OR(\"say \\\"hi\\\"\",\\)",
+		"-term":                       "-term",
+		"ORange ANDROID":              "AND(ORange,ANDROID)",
+		"AND-x OR NOT.y":              "OR(AND-x,NOT.y)",
+		"café Straße 東京":              "AND(AND(café,Straße),東京)",
+		"(red)(blue)":                 "AND(red,blue)",
+		"red AND blue,green:4.01 a@b": "AND(AND(red,blue,green:4.01),a@b)",
+	}
+	for input, expected := range tests {
+		search, err := ParseSearchString(input)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		if actual := formatParseTree(search.Tree); actual != expected {
+			t.Error(input + ": expected " + expected + ", got " + actual)
+		}
+	}
+}
+
+func TestParseSearchErrors(t *testing.T) {
+	tests := map[string]string{
+		"":             "Empty expression",
+		"red OR":       "Missing operand for OR",
+		"NOT":          "Missing operand for NOT",
+		"AND red":      "Missing operand for AND",
+		"(red":         "Mismatched parenthesis, this one is never closed",
+		"red)":         "Mismatched parenthesis, no opening parenthesis for this one",
+		"()":           "Expected an expression before this parenthesis",
+		"\"red":        "No matching token",
+		"\"\"":         "No matching token",
+		"\"red\\x\"":   "No matching token",
+		"red \"blue\\": "No matching token",
+	}
+	for input, expected := range tests {
+		_, err := ParseSearchString(input)
+		if err == nil {
+			t.Error("Expected an error for " + input)
+			continue
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Error("Error for " + input + " does not contain '" + expected + "': " + err.Error())
+		}
+	}
+}
+
+func TestSearchExpression(t *testing.T) {
+	search, err := ParseSearchString("red \"big \\\"blue\\\" \\\\ bikes\" OR NOT green")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expr, err := search.Expression()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if expr.Kind != SearchNodeOr || len(expr.Operands) != 2 {
+		t.Error("Expected an or with two operands")
+		return
+	}
+	and, not := expr.Operands[0], expr.Operands[1]
+	if and.Kind != SearchNodeAnd || len(and.Operands) != 2 {
+		t.Error("Expected an and with two operands")
+		return
+	}
+	if and.Operands[0].Kind != SearchNodeTerm || and.Operands[0].Text != "red" {
+		t.Error("Expected the term red, got " + and.Operands[0].Text)
+	}
+	if and.Operands[1].Kind != SearchNodePhrase || and.Operands[1].Text != "big \"blue\" \\ bikes" {
+		t.Error("Expected the phrase big \"blue\" \\ bikes, got " + and.Operands[1].Text)
+	}
+	if not.Kind != SearchNodeNot || len(not.Operands) != 1 || not.Operands[0].Text != "green" {
+		t.Error("Expected not green")
+	}
+}
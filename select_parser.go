@@ -1,63 +1,332 @@
 package godata
 
 import (
-	"errors"
 	"strings"
 )
 
+// An item of a $select: a path of properties, optionally starting with a type
+// cast and ending with a bound action or function, or a wildcard. Collections
+// of primitive or complex values may have options that filter, order and
+// page their values, and complex values may have a nested $select.
 type SelectItem struct {
 	Segments []*Token
+	Filter   *GoDataFilterQuery
+	Search   *GoDataSearchQuery
+	OrderBy  *GoDataOrderByQuery
+	Skip     *GoDataSkipQuery
+	Top      *GoDataTopQuery
+	Count    *GoDataCountQuery
+	Select   *GoDataSelectQuery
+	Expand   *GoDataExpandQuery
 }
 
 func ParseSelectString(sel string) (*GoDataSelectQuery, error) {
-	items := strings.Split(sel, ",")
+	result, err := parseSelectString(sel, nil)
+	if err != nil {
+		return nil, optionError("$select", sel, err)
+	}
+	return result, nil
+}
 
-	result := []*SelectItem{}
+// Parse the select clause. Filters in the options of the items may use the
+// custom functions of the service, which may be nil.
+func parseSelectString(sel string, service *GoDataService) (*GoDataSelectQuery, error) {
+	tokens, err := GlobalExpandLexer.Tokenize(sel)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, item := range items {
-		segments := []*Token{}
-		for _, val := range strings.Split(item, "/") {
-			segments = append(segments, &Token{Value: val})
+	result := []*SelectItem{}
+	open := []*Token{}
+	start := 0
+	for i, token := range tokens {
+		switch token.Type {
+		case ExpandTokenOpenParen:
+			open = append(open, token)
+		case ExpandTokenCloseParen:
+			if len(open) == 0 {
+				return nil, &SyntaxError{token.Offset, "Mismatched parenthesis, no opening parenthesis for this one"}
+			}
+			open = open[:len(open)-1]
+		case ExpandTokenComma:
+			if len(open) == 0 {
+				item, err := parseSelectItem(tokens[start:i], token.Offset, service)
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, item)
+				start = i + 1
+			}
 		}
-		result = append(result, &SelectItem{segments})
 	}
+	if len(open) > 0 {
+		return nil, &SyntaxError{open[len(open)-1].Offset, "Mismatched parenthesis, this one is never closed"}
+	}
+	item, err := parseSelectItem(tokens[start:], len(sel), service)
+	if err != nil {
+		return nil, err
+	}
+	result = append(result, item)
 
 	return &GoDataSelectQuery{result}, nil
 }
 
+// Parse the tokens of a single item with balanced parentheses. The end is the
+// offset just after the item.
+func parseSelectItem(tokens []*Token, end int, service *GoDataService) (*SelectItem, error) {
+	item := &SelectItem{}
+	i := 0
+	for {
+		if i == len(tokens) || tokens[i].Type != ExpandTokenLiteral || strings.TrimSpace(tokens[i].Value) == "" {
+			offset := end
+			if i < len(tokens) {
+				offset = tokens[i].Offset
+			}
+			return nil, &SyntaxError{offset, "Expected a property"}
+		}
+		segment := tokens[i]
+		segment.Value = strings.TrimSpace(segment.Value)
+		item.Segments = append(item.Segments, segment)
+		i++
+		if i == len(tokens) {
+			return item, nil
+		}
+		if tokens[i].Type != ExpandTokenNav {
+			break
+		}
+		i++
+	}
+
+	if tokens[i].Type != ExpandTokenOpenParen {
+		return nil, &SyntaxError{tokens[i].Offset, "Expected a slash or options in parentheses"}
+	}
+	// options are separated by semicolons up to the matching paren
+	depth, start := 0, i+1
+	for j := i; j < len(tokens); j++ {
+		switch tokens[j].Type {
+		case ExpandTokenOpenParen:
+			depth++
+		case ExpandTokenCloseParen:
+			depth--
+		}
+		if (tokens[j].Type == ExpandTokenSemicolon && depth == 1) || depth == 0 {
+			if err := parseSelectOption(tokens[start:j], tokens[j].Offset, item, service); err != nil {
+				return nil, err
+			}
+			start = j + 1
+		}
+		if depth == 0 {
+			if j+1 < len(tokens) {
+				return nil, &SyntaxError{tokens[j+1].Offset, "Expected a comma"}
+			}
+			break
+		}
+	}
+	return item, nil
+}
+
+// Parse a single option of a select item. The end is the offset of the
+// separator that closes the option. Errors in the nested options are reported
+// at their position in the whole select clause.
+func parseSelectOption(tokens []*Token, end int, item *SelectItem, service *GoDataService) error {
+	if len(tokens) == 0 {
+		return &SyntaxError{end, "Expected a select option"}
+	}
+	head := strings.TrimSpace(tokens[0].Value)
+	if len(tokens) < 2 || tokens[1].Type != ExpandTokenEquals {
+		return &SyntaxError{tokens[0].Offset, "Invalid select option"}
+	}
+	offset := end
+	var b strings.Builder
+	for i, token := range tokens[2:] {
+		if i == 0 {
+			offset = token.Offset
+		}
+		b.WriteString(token.Value)
+	}
+	body := b.String()
+
+	// shift the position of an error in the option body to its position in
+	// the select clause
+	nested := func(err error) error {
+		if syntaxErr, ok := err.(*SyntaxError); ok {
+			return &SyntaxError{offset + syntaxErr.Offset, syntaxErr.Message + " in " + head}
+		}
+		return err
+	}
+
+	var err error
+	switch head {
+	case "$filter":
+		item.Filter, err = parseFilterString(body, service)
+	case "$search":
+		item.Search, err = parseSearchString(body)
+	case "$orderby":
+		item.OrderBy, err = parseOrderByString(body, service)
+	case "$select":
+		item.Select, err = parseSelectString(body, service)
+	case "$expand":
+		item.Expand, err = parseExpandString(body, service)
+	case "$skip":
+		if item.Skip, err = ParseSkipString(body); err != nil {
+			return &SyntaxError{offset, "Expected a number in $skip"}
+		}
+	case "$top":
+		if item.Top, err = ParseTopString(body); err != nil {
+			return &SyntaxError{offset, "Expected a number in $top"}
+		}
+	case "$count":
+		if item.Count, err = ParseCountString(body); err != nil {
+			return &SyntaxError{offset, "Expected true or false in $count"}
+		}
+	default:
+		return &SyntaxError{tokens[0].Offset, "Unsupported select option " + head}
+	}
+	if err != nil {
+		return nested(err)
+	}
+	return nil
+}
+
+// Check whether the item has options that only apply to collections.
+func (item *SelectItem) hasCollectionOptions() bool {
+	return item.Filter != nil || item.Search != nil || item.OrderBy != nil ||
+		item.Skip != nil || item.Top != nil || item.Count != nil
+}
+
+// Resolve the paths of the select items against the entity type, replacing
+// the wildcard with the structural properties of the entity type.
 func SemanticizeSelectQuery(sel *GoDataSelectQuery, service *GoDataService, entity *GoDataEntityType) error {
 	if sel == nil {
 		return nil
 	}
+	t := service.entityStructuredType(entity)
+	if t == nil {
+		return BadRequestError("Entity type " + entity.Name + " is not defined in a schema.")
+	}
+	return semanticizeSelect(sel, service, t)
+}
 
+func semanticizeSelect(sel *GoDataSelectQuery, service *GoDataService, t *structuredType) error {
 	newItems := []*SelectItem{}
-
-	// replace wildcards with every property of the entity
 	for _, item := range sel.SelectItems {
-		// TODO: allow multiple path segments
-		if len(item.Segments) > 1 {
-			return NotImplementedError("Multiple path segments in select clauses are not yet supported.")
-		}
-
-		if item.Segments[0].Value == "*" {
-			for _, prop := range service.PropertyLookup[entity] {
-				newItems = append(newItems, &SelectItem{[]*Token{{Value: prop.Name}}})
+		if len(item.Segments) == 1 && item.Segments[0].Value == "*" {
+			for _, prop := range service.structuredProperties(t) {
+				newItems = append(newItems, &SelectItem{Segments: []*Token{{Value: prop.Name}}})
 			}
 		} else {
 			newItems = append(newItems, item)
 		}
 	}
-
 	sel.SelectItems = newItems
 
 	for _, item := range sel.SelectItems {
-		if prop, ok := service.PropertyLookup[entity][item.Segments[0].Value]; ok {
-			item.Segments[0].SemanticType = SemanticTypeProperty
-			item.Segments[0].SemanticReference = prop
-		} else {
-			return errors.New("Entity " + entity.Name + " has no property " + item.Segments[0].Value)
+		if err := semanticizeSelectItem(item, service, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Resolve the segments of the path of the item one after another, starting
+// at the structured type the select applies to.
+func semanticizeSelectItem(item *SelectItem, service *GoDataService, t *structuredType) error {
+	path := printPath(item.Segments)
+	if len(item.Segments) == 1 && strings.HasSuffix(item.Segments[0].Value, ".*") {
+		// all operations of a schema
+		segment := item.Segments[0]
+		schema := service.lookupSchema(strings.TrimSuffix(segment.Value, ".*"))
+		if schema == nil {
+			return BadRequestError("No schema found for " + segment.Value + " in $select.")
 		}
+		segment.SemanticType = SemanticTypeSchema
+		segment.SemanticReference = schema
+		return nil
 	}
 
+	var last *GoDataProperty
+	for i, segment := range item.Segments {
+		final := i == len(item.Segments)-1
+		if last != nil && t == nil {
+			return BadRequestError("Cannot select '" + path + "', " + last.Name + " is of the primitive type " + last.Type + ".")
+		}
+
+		if prop := service.structuredProperty(t, segment.Value); prop != nil {
+			segment.SemanticType = SemanticTypeProperty
+			segment.SemanticReference = prop
+			last = prop
+			t = service.lookupStructuredType(prop.Type)
+			continue
+		}
+
+		if navProp := service.structuredNavigationProperty(t, segment.Value); navProp != nil {
+			if !final {
+				return BadRequestError("Cannot select '" + path + "', use $expand to select the properties of the navigation property " + navProp.Name + ".")
+			}
+			if _, isCollection := collectionElementType(navProp.Type); isCollection {
+				segment.SemanticType = SemanticTypeEntitySet
+			} else {
+				segment.SemanticType = SemanticTypeEntity
+			}
+			segment.SemanticReference = navProp
+			if item.hasCollectionOptions() || item.Select != nil || item.Expand != nil {
+				return BadRequestError("Cannot apply options to the navigation property " + navProp.Name + " in $select, use $expand instead.")
+			}
+			return nil
+		}
+
+		if !strings.Contains(segment.Value, ".") {
+			return BadRequestError("Type " + t.name() + " has no property " + segment.Value + ".")
+		}
+		if cast := service.lookupStructuredType(segment.Value); cast != nil && !final && last == nil {
+			if !service.isDerivedType(cast, t) {
+				return BadRequestError("Type " + segment.Value + " is not derived from " + t.name() + ".")
+			}
+			segment.SemanticType = SemanticTypeDerivedEntity
+			segment.SemanticReference = cast.reference()
+			t = cast
+			continue
+		}
+		if final {
+			if semanticType, operation := service.lookupBoundOperation(segment.Value, t); operation != nil {
+				segment.SemanticType = semanticType
+				segment.SemanticReference = operation
+				if item.hasCollectionOptions() || item.Select != nil || item.Expand != nil {
+					return BadRequestError("Cannot apply options to the operation " + segment.Value + " in $select.")
+				}
+				return nil
+			}
+		}
+		return BadRequestError("No type cast, action or function " + segment.Value + " bound to " + t.name() + ".")
+	}
+
+	// options of the selected property
+	_, isCollection := collectionElementType(last.Type)
+	if item.hasCollectionOptions() && !isCollection {
+		return BadRequestError("Cannot apply options to '" + path + "' in $select, it is not a collection.")
+	}
+	if (item.Select != nil || item.Expand != nil) && t == nil {
+		return BadRequestError("Cannot apply $select or $expand to '" + path + "', it is not of a complex type.")
+	}
+	if item.Expand != nil {
+		return NotImplementedError("Expanding navigation properties of complex types is not supported.")
+	}
+	// $this and the property paths of the options refer to the elements
+	element, _ := collectionElementType(last.Type)
+	semantics := &filterSemantics{service: service, parser: service.filterParser(), this: element}
+	if item.Filter != nil {
+		if err := semanticizeFilter(item.Filter, semantics); err != nil {
+			return err
+		}
+		OptimizeFilterQuery(item.Filter)
+	}
+	if item.OrderBy != nil {
+		if err := semanticizeOrderByItems(item.OrderBy, semantics); err != nil {
+			return err
+		}
+	}
+	if item.Select != nil {
+		return semanticizeSelect(item.Select, service, t)
+	}
 	return nil
 }
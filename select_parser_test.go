@@ -0,0 +1,160 @@
+package godata
+
+import (
+	"strings"
+	"testing"
+)
+
+func semanticizeSelectString(entityType, input string) (*GoDataSelectQuery, error) {
+	service, err := BuildService(&thingsProvider{}, "http://localhost")
+	if err != nil {
+		return nil, err
+	}
+	entity, err := service.LookupEntityType(entityType)
+	if err != nil {
+		return nil, err
+	}
+	sel, err := ParseSelectString(input)
+	if err != nil {
+		return nil, err
+	}
+	return sel, SemanticizeSelectQuery(sel, service, entity)
+}
+
+func TestParseSelect(t *testing.T) {
+	tests := map[string]string{
+		"Name":                "Name",
+		"Name, Address/City":  "Name,Address/City",
+		"Things.*":            "Things.*",
+		"Things.Sensor/Model": "Things.Sensor/Model",
+		"Tags($filter=$it ne 'a';$top=2;$orderby=$it desc;$count=true)": "Tags($filter=$it ne 'a';$orderby=$it desc;$top=2;$count=true)",
+		"Address($select=City,Street),Locations($skip=1;$select=City)":  "Address($select=City,Street),Locations($skip=1;$select=City)",
+	}
+	for input, expected := range tests {
+		sel, err := ParseSelectString(input)
+		if err != nil {
+			t.Error(input + ": " + err.Error())
+			continue
+		}
+		if sel.String() != expected {
+			t.Error(input + ": expected " + expected + ", got " + sel.String())
+		}
+	}
+}
+
+func TestParseSelectErrors(t *testing.T) {
+	tests := map[string]string{
+		"":                        "position 0: Expected a property",
+		"Name,":                   "position 5: Expected a property",
+		"Address/":                "position 8: Expected a property",
+		"Tags(":                   "position 4: Mismatched parenthesis, this one is never closed",
+		"Name)":                   "position 4: Mismatched parenthesis, no opening parenthesis for this one",
+		"Tags($top=x)":            "position 10: Expected a number in $top",
+		"Tags($levels=2)":         "position 5: Unsupported select option $levels",
+		"Tags($top=1)Name":        "position 12: Expected a comma",
+		"Tags($filter=$it eq)":    "in $filter",
+		"Address($select=City/)":  "position 21: Expected a property in $select",
+		"Tags($count=maybe;$top)": "Expected true or false in $count",
+	}
+	for input, expected := range tests {
+		_, err := ParseSelectString(input)
+		if err == nil {
+			t.Error("Expected an error for " + input)
+			continue
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Error("Error for " + input + " does not contain '" + expected + "': " + err.Error())
+		}
+	}
+}
+
+func TestSemanticizeSelect(t *testing.T) {
+	sel, err := semanticizeSelectString("Sensor", "*")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if sel.String() != "Id,Name,Address,Tags,Locations,Model" {
+		t.Error("Expected the properties of Sensor and its base type, got " + sel.String())
+	}
+
+	sel, err = semanticizeSelectString("Thing", "Address/City,Datastreams,Things.Sensor/Model,T.Reset,Things.*,Locations($select=City)")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	items := sel.SelectItems
+	if prop, ok := items[0].Segments[1].SemanticReference.(*GoDataProperty); !ok || prop.Name != "City" ||
+		items[0].Segments[1].SemanticType != SemanticTypeProperty {
+		t.Error("Expected Address/City to refer to the property City")
+	}
+	if items[1].Segments[0].SemanticType != SemanticTypeEntitySet {
+		t.Error("Expected Datastreams to be an entity set")
+	}
+	if entity, ok := items[2].Segments[0].SemanticReference.(*GoDataEntityType); !ok || entity.Name != "Sensor" ||
+		items[2].Segments[0].SemanticType != SemanticTypeDerivedEntity {
+		t.Error("Expected Things.Sensor to be a cast to the derived type Sensor")
+	}
+	if action, ok := items[3].Segments[0].SemanticReference.(*GoDataAction); !ok || action.Name != "Reset" ||
+		items[3].Segments[0].SemanticType != SemanticTypeAction {
+		t.Error("Expected T.Reset to refer to the bound action Reset")
+	}
+	if schema, ok := items[4].Segments[0].SemanticReference.(*GoDataSchema); !ok || schema.Namespace != "Things" {
+		t.Error("Expected Things.* to refer to the schema Things")
+	}
+	if items[5].Select.SelectItems[0].Segments[0].SemanticType != SemanticTypeProperty {
+		t.Error("Expected the nested City to be a property")
+	}
+
+	if _, err := semanticizeSelectString("Sensor", "Things.Calibration,T.Reset"); err != nil {
+		t.Error(err)
+	}
+
+	sel, err = semanticizeSelectString("Thing", "Tags($filter=$this ne 'a'),Locations($filter=City eq 'b')")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if this := sel.SelectItems[0].Filter.Tree.Children[0]; this.Token.Type != FilterTokenThis || this.EdmType != GoDataString {
+		t.Error("Expected $this to be an element of Tags of type Edm.String")
+	}
+	city := sel.SelectItems[1].Filter.Tree.Children[0]
+	if prop, ok := city.Token.SemanticReference.(*GoDataProperty); !ok || prop.Name != "City" {
+		t.Error("Expected City to refer to the property of Address")
+	}
+
+	errors := map[string]string{
+		"Unknown":                  "Type Thing has no property Unknown.",
+		"Name/Length":              "Name is of the primitive type Edm.String",
+		"Address/Country":          "Type Address has no property Country.",
+		"Datastreams/Id":           "use $expand",
+		"Datastreams($top=1)":      "use $expand instead",
+		"Things.Calibration":       "No type cast, action or function Things.Calibration bound to Thing.",
+		"Things.Datastream/Id":     "Type Things.Datastream is not derived from Thing.",
+		"Other.*":                  "No schema found for Other.*",
+		"Name($top=1)":             "it is not a collection",
+		"Tags($select=Name)":       "it is not of a complex type",
+		"Address($expand=Things)":  "not supported",
+		"Tags($filter=$it eq 'a')": "",
+		"Locations($orderby=City)": "",
+		"Tags($filter=$this eq 'a';$orderby=$this desc)":               "",
+		"Locations($filter=$this/City eq 'x';$orderby=Street)":         "",
+		"Tags($filter=Name eq 'a')":                                    "No property found Name on type Edm.String",
+		"Tags($filter=$this eq 1)":                                     "Edm.String",
+		"Locations($filter=Nope eq 'x')":                               "No property found Nope on type Address",
+		"Locations($orderby=$this/Nope)":                               "No property found Nope on type Address",
+		"Locations($filter=City eq 'x' and $this/Address/City eq 'y')": "No property found Address on type Address",
+	}
+	for input, expected := range errors {
+		_, err := semanticizeSelectString("Thing", input)
+		if expected == "" {
+			if err != nil {
+				t.Error(input + ": " + err.Error())
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Error("Expected an error containing '" + expected + "' for " + input)
+		}
+	}
+}
@@ -44,6 +44,9 @@ type GoDataService struct {
 	// A bottom-up mapping from entity type names to schema namespaces to
 	// the entity type reference
 	EntityTypeLookup map[string]map[string]*GoDataEntityType
+	// A bottom-up mapping from enum type names to schema namespaces to the
+	// enum type reference
+	EnumTypeLookup map[string]map[string]*GoDataEnumType
 	// A bottom-up mapping from entity container names to schema namespaces to
 	// the entity container reference
 	EntityContainerLookup map[string]map[string]*GoDataEntityContainer
@@ -56,6 +59,18 @@ type GoDataService struct {
 	// A lookup for navigational properties if an entity type is given,
 	// lookup navigational properties by name
 	NavigationPropertyLookup map[*GoDataEntityType]map[string]*GoDataNavigationProperty
+	// A lookup for the custom filter functions of the service by name
+	FilterFunctionLookup map[string]*FilterFunction
+	// The tokenizer and parser for $filter, extended by the custom filter
+	// functions. They are nil as long as no function has been defined.
+	FilterTokenizer *Tokenizer
+	FilterParser    *Parser
+	// The hand-written lexer producing the tokens of FilterTokenizer, used
+	// to parse $filter.
+	FilterLexer *Lexer
+	// The limits on the complexity of requests, or nil for no limits.
+	// BuildService sets DefaultQueryLimits.
+	Limits *QueryLimits
 }
 
 type providerChannelResponse struct {
@@ -74,6 +89,7 @@ func BuildService(provider GoDataProvider, serviceUrl string) (*GoDataService, e
 	// build the lookups from the metadata
 	schemaLookup := map[string]*GoDataSchema{}
 	entityLookup := map[string]map[string]*GoDataEntityType{}
+	enumLookup := map[string]map[string]*GoDataEnumType{}
 	containerLookup := map[string]map[string]*GoDataEntityContainer{}
 	entitySetLookup := map[string]map[string]map[string]*GoDataEntitySet{}
 	propertyLookup := map[*GoDataEntityType]map[string]*GoDataProperty{}
@@ -102,6 +118,13 @@ func BuildService(provider GoDataProvider, serviceUrl string) (*GoDataService, e
 			}
 		}
 
+		for _, enum := range schema.EnumTypes {
+			if _, ok := enumLookup[enum.Name]; !ok {
+				enumLookup[enum.Name] = map[string]*GoDataEnumType{}
+			}
+			enumLookup[enum.Name][schema.Namespace] = enum
+		}
+
 		for _, container := range schema.EntityContainers {
 			if _, ok := containerLookup[container.Name]; !ok {
 				containerLookup[container.Name] = map[string]*GoDataEntityContainer{}
@@ -131,17 +154,23 @@ func BuildService(provider GoDataProvider, serviceUrl string) (*GoDataService, e
 		provider.GetMetadata(),
 		schemaLookup,
 		entityLookup,
+		enumLookup,
 		containerLookup,
 		entitySetLookup,
 		propertyLookup,
 		navPropLookup,
+		map[string]*FilterFunction{},
+		nil,
+		nil,
+		nil,
+		DefaultQueryLimits(),
 	}, nil
 }
 
 // The default handler for parsing requests as GoDataRequests, passing them
 // to a GoData provider, and then building a response.
 func (service *GoDataService) GoDataHTTPHandler(w http.ResponseWriter, r *http.Request) {
-	request, err := ParseRequest(r.URL.Path, r.URL.Query())
+	request, err := service.ParseRequest(r.URL.Path, r.URL.Query())
 	if err != nil {
 		panic(err) // TODO: return proper error
 	}
@@ -362,6 +391,54 @@ func (service *GoDataService) LookupEntityType(name string) (*GoDataEntityType,
 	return nil, BadRequestError("No schema lookup found for entity " + name)
 }
 
+// Lookup an enum type from the service metadata. Accepts a fully qualified
+// name, e.g., ODataService.EnumTypeName or, if unambiguous, accepts a simple
+// identifier, e.g., EnumTypeName.
+func (service *GoDataService) LookupEnumType(name string) (*GoDataEnumType, error) {
+	parts := strings.Split(name, ".")
+	enumName := parts[len(parts)-1]
+	namespace := strings.Join(parts[:len(parts)-1], ".")
+
+	schemas, ok := service.EnumTypeLookup[enumName]
+	if !ok {
+		return nil, BadRequestError("Enum type " + name + " does not exist.")
+	}
+
+	if namespace != "" {
+		enum, ok := schemas[namespace]
+		if !ok {
+			return nil, BadRequestError("Enum type " + name + " not found in given namespace.")
+		}
+		return enum, nil
+	}
+
+	if len(schemas) > 1 {
+		return nil, BadRequestError("Enum type " + name + " is ambiguous. Please provide a namespace.")
+	}
+	for _, v := range schemas {
+		return v, nil
+	}
+	return nil, BadRequestError("No schema lookup found for enum type " + name)
+}
+
+// Parse an enumeration literal like Namespace.Color'Red', e.g. the value of a
+// key predicate, to the value of its enum type.
+func (service *GoDataService) ParseEnumLiteral(literal string) (*GoDataEnumValue, error) {
+	typeName, value := splitEnumLiteral(literal)
+	if value == "" || !strings.HasSuffix(literal, "'") {
+		return nil, BadRequestError("Invalid enumeration literal " + literal)
+	}
+	enum, err := service.LookupEnumType(typeName)
+	if err != nil {
+		return nil, err
+	}
+	v, err := enum.ParseValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return &GoDataEnumValue{enum, v}, nil
+}
+
 // Lookup an entity set from the service metadata. Accepts a fully qualified
 // name, e.g., ODataService.ContainerName.EntitySetName,
 // ContainerName.EntitySetName or, if unambiguous, accepts a  simple identifier,
@@ -37,6 +37,14 @@ func (*DummyProvider) GetMetadata() *GoDataMetadata {
 									Name: "Age",
 									Type: GoDataInt32,
 								},
+								{
+									Name: "Tier",
+									Type: "Store.Tier",
+								},
+								{
+									Name: "Channels",
+									Type: "Store.Channels",
+								},
 							},
 							NavigationProperties: []*GoDataNavigationProperty{
 								{
@@ -63,6 +71,26 @@ func (*DummyProvider) GetMetadata() *GoDataMetadata {
 							},
 						},
 					},
+					EnumTypes: []*GoDataEnumType{
+						{
+							Name: "Tier",
+							Members: []*GoDataMember{
+								{Name: "Bronze"},
+								{Name: "Silver"},
+								{Name: "Gold"},
+							},
+						},
+						{
+							Name:    "Channels",
+							IsFlags: "true",
+							Members: []*GoDataMember{
+								{Name: "None", Value: "0"},
+								{Name: "Email", Value: "1"},
+								{Name: "Phone", Value: "2"},
+								{Name: "Post", Value: "4"},
+							},
+						},
+					},
 					EntityContainers: []*GoDataEntityContainer{
 						{
 							Name: "Collections",
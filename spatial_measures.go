@@ -0,0 +1,118 @@
+package godata
+
+import (
+	"math"
+)
+
+// The mean radius of the earth in meters, used for great-circle distances.
+const earthRadius = 6371008.8
+
+// The shortest distance between two geometries on the plane, in the units of
+// their coordinates. Returns NaN if a geometry is empty.
+func PlanarDistance(a, b Geometry) float64 {
+	return spatialDistance(a, b, func(p spatialVec, s spatialSegment) float64 {
+		return s.distance(p)
+	})
+}
+
+// The shortest distance between two geographies in meters, along great
+// circles of a spherical earth. Coordinates are longitude and latitude in
+// degrees. Returns NaN if a geography is empty.
+func GreatCircleDistance(a, b Geometry) float64 {
+	return spatialDistance(a, b, greatCircleSegmentDistance)
+}
+
+// The length of a line string or multi line string on the plane. Returns NaN
+// for other geometries.
+func PlanarLength(g Geometry) float64 {
+	return spatialLength(g, func(s spatialSegment) float64 {
+		return s.b.sub(s.a).length()
+	})
+}
+
+// The length of a line string or multi line string in meters, along great
+// circles of a spherical earth. Returns NaN for other geometries.
+func GreatCircleLength(g Geometry) float64 {
+	return spatialLength(g, func(s spatialSegment) float64 {
+		return greatCircleAngle(s.a, s.b) * earthRadius
+	})
+}
+
+// The distance is zero if the geometries intersect, otherwise it is the
+// distance between a vertex of one and a segment or point of the other.
+func spatialDistance(a, b Geometry, distance func(spatialVec, spatialSegment) float64) float64 {
+	pa, pb := newSpatialParts(a), newSpatialParts(b)
+	if pa.dimension() < 0 || pb.dimension() < 0 {
+		return math.NaN()
+	}
+	if Relate(a, b).Intersects() {
+		return 0
+	}
+
+	result := math.Inf(1)
+	for _, pair := range [][2]*spatialParts{{pa, pb}, {pb, pa}} {
+		targets := pair[1].segments()
+		for _, q := range pair[1].points {
+			targets = append(targets, spatialSegment{q, q})
+		}
+		for _, p := range pair[0].vertices() {
+			for _, s := range targets {
+				result = math.Min(result, distance(p, s))
+			}
+		}
+	}
+	return result
+}
+
+func spatialLength(g Geometry, length func(spatialSegment) float64) float64 {
+	parts := newSpatialParts(g)
+	if len(parts.lines) == 0 || len(parts.points) > 0 || len(parts.polygons) > 0 {
+		return math.NaN()
+	}
+	result := 0.0
+	for _, s := range parts.segments() {
+		result += length(s)
+	}
+	return result
+}
+
+// The central angle between two positions given in degrees, by the haversine
+// formula.
+func greatCircleAngle(a, b spatialVec) float64 {
+	lat1, lat2 := a.y*math.Pi/180, b.y*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.x - a.x) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// The initial bearing from a to b in radians.
+func greatCircleBearing(a, b spatialVec) float64 {
+	lat1, lat2 := a.y*math.Pi/180, b.y*math.Pi/180
+	dLon := (b.x - a.x) * math.Pi / 180
+	return math.Atan2(math.Sin(dLon)*math.Cos(lat2),
+		math.Cos(lat1)*math.Sin(lat2)-math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon))
+}
+
+// The distance in meters from a position to the great circle arc of a
+// segment, using the cross track and along track distances.
+func greatCircleSegmentDistance(p spatialVec, s spatialSegment) float64 {
+	toStart := greatCircleAngle(s.a, p)
+	toEnd := greatCircleAngle(s.b, p)
+	arc := greatCircleAngle(s.a, s.b)
+	if arc == 0 {
+		return toStart * earthRadius
+	}
+
+	angle := greatCircleBearing(s.a, p) - greatCircleBearing(s.a, s.b)
+	if math.Cos(angle) <= 0 {
+		// the point is behind the start of the arc
+		return toStart * earthRadius
+	}
+	crossTrack := math.Asin(math.Sin(toStart) * math.Sin(angle))
+	alongTrack := math.Acos(math.Max(-1, math.Min(1, math.Cos(toStart)/math.Cos(crossTrack))))
+	if alongTrack > arc {
+		return toEnd * earthRadius
+	}
+	return math.Abs(crossTrack) * earthRadius
+}
@@ -0,0 +1,62 @@
+package godata
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPlanarMeasures(t *testing.T) {
+	square := parseTestGeometry(t, "POLYGON((0 0,4 0,4 4,0 4,0 0))")
+	tests := []struct {
+		a, b     string
+		expected float64
+	}{
+		{"POINT(0 0)", "POINT(3 4)", 5},
+		{"POINT(6 2)", "LINESTRING(4 0,4 4)", 2},
+		{"LINESTRING(0 0,4 0)", "LINESTRING(2 1,2 5)", 1},
+		{"POINT(1 1)", "MULTIPOINT((4 5),(2 1))", 1},
+	}
+	for _, test := range tests {
+		distance := PlanarDistance(parseTestGeometry(t, test.a), parseTestGeometry(t, test.b))
+		if math.Abs(distance-test.expected) > spatialTolerance {
+			t.Errorf("Distance of %s and %s is %v not %v", test.a, test.b, distance, test.expected)
+		}
+	}
+	if distance := PlanarDistance(square, parseTestGeometry(t, "POINT(2 2)")); distance != 0 {
+		t.Errorf("Distance of a point in the square is %v", distance)
+	}
+	if distance := PlanarDistance(square, parseTestGeometry(t, "POINT EMPTY")); !math.IsNaN(distance) {
+		t.Errorf("Distance to an empty point is %v", distance)
+	}
+
+	if length := PlanarLength(parseTestGeometry(t, "MULTILINESTRING((0 0,3 4),(0 0,0 1,1 1))")); length != 7 {
+		t.Errorf("Length of the lines is %v", length)
+	}
+	if length := PlanarLength(square); !math.IsNaN(length) {
+		t.Errorf("Length of a polygon is %v", length)
+	}
+}
+
+func TestGreatCircleMeasures(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected float64
+	}{
+		{"POINT(0 0)", "POINT(0 1)", 111195},
+		{"POINT(0 0)", "POINT(180 0)", math.Pi * earthRadius},
+		{"POINT(13.4 52.52)", "POINT(2.35 48.86)", 877600},
+		{"POINT(5 1)", "LINESTRING(0 0,10 0)", 111195},
+		{"POINT(-5 1)", "LINESTRING(0 0,10 0)", 566958},
+	}
+	for _, test := range tests {
+		distance := GreatCircleDistance(parseTestGeometry(t, test.a), parseTestGeometry(t, test.b))
+		if math.Abs(distance-test.expected) > 1000 {
+			t.Errorf("Distance of %s and %s is %v not %v", test.a, test.b, distance, test.expected)
+		}
+	}
+
+	length := GreatCircleLength(parseTestGeometry(t, "LINESTRING(0 0,0 1,0 2)"))
+	if math.Abs(length-2*111195) > 1 {
+		t.Errorf("Length of the line is %v", length)
+	}
+}
@@ -0,0 +1,529 @@
+package godata
+
+import (
+	"math"
+	"sort"
+)
+
+// The locations of a point relative to a geometry, which are also the rows
+// and columns of an IntersectionMatrix.
+const (
+	SpatialInterior int = iota
+	SpatialBoundary
+	SpatialExterior
+)
+
+// Coordinates closer than this are considered equal.
+const spatialTolerance = 1e-9
+
+// The dimensionally extended nine-intersection model (DE-9IM) of two
+// geometries a and b, computed on the plane. Dims[i][j] is the dimension of
+// the intersection of location i of a with location j of b, or -1 if they do
+// not intersect.
+type IntersectionMatrix struct {
+	Dims [3][3]int
+	// the dimensions of a and b, -1 for empty geometries
+	dimA, dimB int
+}
+
+// Compute the intersection matrix of two geometries. Coordinates are taken
+// as planar x and y, also for geographies, which is exact for the predicates
+// of small shapes but not for distances.
+func Relate(a, b Geometry) *IntersectionMatrix {
+	pa, pb := newSpatialParts(a), newSpatialParts(b)
+	m := &IntersectionMatrix{dimA: pa.dimension(), dimB: pb.dimension()}
+	for i := range m.Dims {
+		for j := range m.Dims[i] {
+			m.Dims[i][j] = -1
+		}
+	}
+	m.Dims[SpatialExterior][SpatialExterior] = 2
+
+	record := func(p spatialVec, dim int) {
+		la, lb := pa.locate(p), pb.locate(p)
+		m.Dims[la][lb] = max(m.Dims[la][lb], dim)
+	}
+	for _, p := range append(pa.vertices(), pb.vertices()...) {
+		record(p, 0)
+	}
+
+	areal := len(pa.polygons) > 0 || len(pb.polygons) > 0
+	segmentsA, segmentsB := pa.segments(), pb.segments()
+	// cut the segments of each geometry at the segments and points of the other
+	cutsA, cutsB := append(pa.pointSegments(), segmentsA...), append(pb.pointSegments(), segmentsB...)
+	for _, pair := range [][2][]spatialSegment{{segmentsA, cutsB}, {segmentsB, cutsA}} {
+		for _, s := range pair[0] {
+			for _, piece := range cutSegment(s, pair[1]) {
+				record(piece.a, 0)
+				mid := piece.midpoint()
+				record(mid, 1)
+				if !areal {
+					continue
+				}
+				// the faces on both sides of the piece show how the areas
+				// overlap
+				for _, p := range piece.offsets() {
+					la, lb := pa.locate(p), pb.locate(p)
+					if (la == SpatialExterior || pa.inArea(p)) && (lb == SpatialExterior || pb.inArea(p)) {
+						m.Dims[la][lb] = 2
+					}
+				}
+			}
+		}
+	}
+
+	return m
+}
+
+// The matrix as a string of nine characters, e.g. 212101212.
+func (m *IntersectionMatrix) String() string {
+	result := make([]byte, 0, 9)
+	for _, row := range m.Dims {
+		for _, dim := range row {
+			if dim < 0 {
+				result = append(result, 'F')
+			} else {
+				result = append(result, byte('0'+dim))
+			}
+		}
+	}
+	return string(result)
+}
+
+// Check whether the matrix matches a pattern of nine characters, where T
+// matches any non-empty intersection, F an empty one, * anything, and 0, 1
+// and 2 the dimension.
+func (m *IntersectionMatrix) Matches(pattern string) (bool, error) {
+	if len(pattern) != 9 {
+		return false, BadRequestError("Invalid intersection pattern " + pattern + ", expected nine characters.")
+	}
+	for i, c := range []byte(pattern) {
+		dim := m.Dims[i/3][i%3]
+		switch c {
+		case '*':
+		case 'T', 't':
+			if dim < 0 {
+				return false, nil
+			}
+		case 'F', 'f':
+			if dim >= 0 {
+				return false, nil
+			}
+		case '0', '1', '2':
+			if dim != int(c-'0') {
+				return false, nil
+			}
+		default:
+			return false, BadRequestError("Invalid intersection pattern " + pattern + ".")
+		}
+	}
+	return true, nil
+}
+
+// The patterns are fixed and valid, so matching cannot fail.
+func (m *IntersectionMatrix) matches(pattern string) bool {
+	ok, _ := m.Matches(pattern)
+	return ok
+}
+
+func (m *IntersectionMatrix) Equals() bool {
+	return m.dimA >= 0 && m.dimB >= 0 && m.matches("T*F**FFF*")
+}
+
+func (m *IntersectionMatrix) Disjoint() bool {
+	return m.matches("FF*FF****")
+}
+
+func (m *IntersectionMatrix) Intersects() bool {
+	return !m.Disjoint()
+}
+
+func (m *IntersectionMatrix) Touches() bool {
+	if m.dimA == 0 && m.dimB == 0 {
+		return false
+	}
+	return m.matches("FT*******") || m.matches("F**T*****") || m.matches("F***T****")
+}
+
+func (m *IntersectionMatrix) Within() bool {
+	return m.matches("T*F**F***")
+}
+
+func (m *IntersectionMatrix) Contains() bool {
+	return m.matches("T*****FF*")
+}
+
+func (m *IntersectionMatrix) Crosses() bool {
+	switch {
+	case m.dimA == 1 && m.dimB == 1:
+		return m.matches("0********")
+	case m.dimA < m.dimB && m.dimA >= 0:
+		return m.matches("T*T******")
+	case m.dimA > m.dimB && m.dimB >= 0:
+		return m.matches("T*****T**")
+	}
+	return false
+}
+
+func (m *IntersectionMatrix) Overlaps() bool {
+	switch {
+	case m.dimA != m.dimB:
+		return false
+	case m.dimA == 0 || m.dimA == 2:
+		return m.matches("T*T***T**")
+	case m.dimA == 1:
+		return m.matches("1*T***T**")
+	}
+	return false
+}
+
+type spatialVec struct {
+	x, y float64
+}
+
+func (v spatialVec) sub(w spatialVec) spatialVec {
+	return spatialVec{v.x - w.x, v.y - w.y}
+}
+
+func (v spatialVec) cross(w spatialVec) float64 {
+	return v.x*w.y - v.y*w.x
+}
+
+func (v spatialVec) dot(w spatialVec) float64 {
+	return v.x*w.x + v.y*w.y
+}
+
+func (v spatialVec) length() float64 {
+	return math.Hypot(v.x, v.y)
+}
+
+func (v spatialVec) equals(w spatialVec) bool {
+	return v.sub(w).length() <= spatialTolerance
+}
+
+type spatialSegment struct {
+	a, b spatialVec
+}
+
+func (s spatialSegment) midpoint() spatialVec {
+	return spatialVec{(s.a.x + s.b.x) / 2, (s.a.y + s.b.y) / 2}
+}
+
+// Points slightly to the left and right of the midpoint of the segment.
+func (s spatialSegment) offsets() []spatialVec {
+	d := s.b.sub(s.a)
+	l := d.length()
+	if l == 0 {
+		return nil
+	}
+	offset := math.Min(math.Max(l*1e-3, 10*spatialTolerance), 1e-6)
+	n := spatialVec{-d.y / l * offset, d.x / l * offset}
+	mid := s.midpoint()
+	return []spatialVec{{mid.x + n.x, mid.y + n.y}, {mid.x - n.x, mid.y - n.y}}
+}
+
+// The distance of the point to the segment.
+func (s spatialSegment) distance(p spatialVec) float64 {
+	d := s.b.sub(s.a)
+	l2 := d.dot(d)
+	if l2 == 0 {
+		return p.sub(s.a).length()
+	}
+	t := math.Max(0, math.Min(1, p.sub(s.a).dot(d)/l2))
+	return p.sub(spatialVec{s.a.x + t*d.x, s.a.y + t*d.y}).length()
+}
+
+func (s spatialSegment) contains(p spatialVec) bool {
+	return s.distance(p) <= spatialTolerance
+}
+
+// The side of the line through the segment the point is on: 1 for left, -1
+// for right and 0 if it is on the line.
+func (s spatialSegment) side(p spatialVec) int {
+	d := s.b.sub(s.a)
+	l := d.length()
+	if l == 0 {
+		return 0
+	}
+	c := d.cross(p.sub(s.a)) / l
+	switch {
+	case c > spatialTolerance:
+		return 1
+	case c < -spatialTolerance:
+		return -1
+	}
+	return 0
+}
+
+// The points where two segments intersect. Collinear segments that overlap
+// intersect in the endpoints of the overlap.
+func (s spatialSegment) intersections(t spatialSegment) []spatialVec {
+	d1, d2 := t.side(s.a), t.side(s.b)
+	d3, d4 := s.side(t.a), s.side(t.b)
+
+	if d1*d2 < 0 && d3*d4 < 0 {
+		// a proper crossing
+		d, e := s.b.sub(s.a), t.b.sub(t.a)
+		u := t.a.sub(s.a).cross(e) / d.cross(e)
+		return []spatialVec{{s.a.x + u*d.x, s.a.y + u*d.y}}
+	}
+
+	result := []spatialVec{}
+	for _, p := range []spatialVec{s.a, s.b} {
+		if t.contains(p) {
+			result = append(result, p)
+		}
+	}
+	for _, p := range []spatialVec{t.a, t.b} {
+		if s.contains(p) {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// Cut the segment at the points where it intersects the other segments.
+func cutSegment(s spatialSegment, others []spatialSegment) []spatialSegment {
+	points := []spatialVec{s.a, s.b}
+	for _, t := range others {
+		points = append(points, s.intersections(t)...)
+	}
+	d := s.b.sub(s.a)
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].sub(s.a).dot(d) < points[j].sub(s.a).dot(d)
+	})
+
+	pieces := []spatialSegment{}
+	last := points[0]
+	for _, p := range points[1:] {
+		if !p.equals(last) {
+			pieces = append(pieces, spatialSegment{last, p})
+			last = p
+		}
+	}
+	return pieces
+}
+
+// A geometry decomposed into its points, lines and polygons.
+type spatialParts struct {
+	points   []spatialVec
+	lines    [][]spatialVec
+	polygons [][][]spatialVec
+	// the endpoints of lines that are on the boundary, by the mod 2 rule
+	boundary []spatialVec
+}
+
+func newSpatialParts(g Geometry) *spatialParts {
+	parts := &spatialParts{}
+	parts.add(g)
+
+	for _, line := range parts.lines {
+		if line[0].equals(line[len(line)-1]) {
+			// closed lines have no boundary
+			continue
+		}
+		for _, p := range []spatialVec{line[0], line[len(line)-1]} {
+			found := false
+			for i, q := range parts.boundary {
+				if p.equals(q) {
+					// an endpoint of two lines is in the interior
+					parts.boundary = append(parts.boundary[:i], parts.boundary[i+1:]...)
+					found = true
+					break
+				}
+			}
+			if !found {
+				parts.boundary = append(parts.boundary, p)
+			}
+		}
+	}
+	return parts
+}
+
+func spatialVecs(points []Point) []spatialVec {
+	result := make([]spatialVec, 0, len(points))
+	for _, p := range points {
+		if len(p) >= 2 {
+			result = append(result, spatialVec{p[0], p[1]})
+		}
+	}
+	return result
+}
+
+func (s *spatialParts) add(g Geometry) {
+	switch g := g.(type) {
+	case Point:
+		s.points = append(s.points, spatialVecs([]Point{g})...)
+	case MultiPoint:
+		s.points = append(s.points, spatialVecs(g)...)
+	case LineString:
+		s.addLine(g)
+	case MultiLineString:
+		for _, line := range g {
+			s.addLine(line)
+		}
+	case Polygon:
+		s.addPolygon(g)
+	case MultiPolygon:
+		for _, polygon := range g {
+			s.addPolygon(polygon)
+		}
+	case GeometryCollection:
+		for _, member := range g {
+			s.add(member)
+		}
+	}
+}
+
+func (s *spatialParts) addLine(line LineString) {
+	if points := spatialVecs(line); len(points) > 0 {
+		s.lines = append(s.lines, points)
+	}
+}
+
+func (s *spatialParts) addPolygon(polygon Polygon) {
+	rings := [][]spatialVec{}
+	for _, ring := range polygon {
+		if points := spatialVecs(ring); len(points) > 0 {
+			rings = append(rings, points)
+		}
+	}
+	if len(rings) > 0 {
+		s.polygons = append(s.polygons, rings)
+	}
+}
+
+// The topological dimension of the geometry, or -1 if it is empty.
+func (s *spatialParts) dimension() int {
+	switch {
+	case len(s.polygons) > 0:
+		return 2
+	case len(s.lines) > 0:
+		return 1
+	case len(s.points) > 0:
+		return 0
+	}
+	return -1
+}
+
+func (s *spatialParts) vertices() []spatialVec {
+	result := append([]spatialVec{}, s.points...)
+	for _, line := range s.lines {
+		result = append(result, line...)
+	}
+	for _, polygon := range s.polygons {
+		for _, ring := range polygon {
+			result = append(result, ring...)
+		}
+	}
+	return result
+}
+
+func ringSegments(points []spatialVec) []spatialSegment {
+	result := []spatialSegment{}
+	for i := 1; i < len(points); i++ {
+		result = append(result, spatialSegment{points[i-1], points[i]})
+	}
+	return result
+}
+
+// The segments of the lines and of the rings of the polygons.
+func (s *spatialParts) segments() []spatialSegment {
+	result := []spatialSegment{}
+	for _, line := range s.lines {
+		result = append(result, ringSegments(line)...)
+	}
+	for _, polygon := range s.polygons {
+		for _, ring := range polygon {
+			result = append(result, ringSegments(ring)...)
+		}
+	}
+	return result
+}
+
+// The isolated points as segments of length zero.
+func (s *spatialParts) pointSegments() []spatialSegment {
+	result := make([]spatialSegment, len(s.points))
+	for i, p := range s.points {
+		result[i] = spatialSegment{p, p}
+	}
+	return result
+}
+
+// Locate the point in the interior, on the boundary or in the exterior of
+// the geometry.
+func (s *spatialParts) locate(p spatialVec) int {
+	onBoundary := false
+	for _, polygon := range s.polygons {
+		switch locateInPolygon(p, polygon) {
+		case SpatialInterior:
+			return SpatialInterior
+		case SpatialBoundary:
+			onBoundary = true
+		}
+	}
+	for _, line := range s.lines {
+		for _, segment := range ringSegments(line) {
+			if segment.contains(p) {
+				for _, q := range s.boundary {
+					if p.equals(q) {
+						return SpatialBoundary
+					}
+				}
+				return SpatialInterior
+			}
+		}
+	}
+	for _, q := range s.points {
+		if p.equals(q) {
+			return SpatialInterior
+		}
+	}
+	if onBoundary {
+		return SpatialBoundary
+	}
+	return SpatialExterior
+}
+
+// Check whether the point is inside one of the polygons, not on a ring.
+func (s *spatialParts) inArea(p spatialVec) bool {
+	for _, polygon := range s.polygons {
+		if locateInPolygon(p, polygon) == SpatialInterior {
+			return true
+		}
+	}
+	return false
+}
+
+func locateInPolygon(p spatialVec, rings [][]spatialVec) int {
+	for _, ring := range rings {
+		for _, segment := range ringSegments(ring) {
+			if segment.contains(p) {
+				return SpatialBoundary
+			}
+		}
+	}
+	if !insideRing(p, rings[0]) {
+		return SpatialExterior
+	}
+	for _, hole := range rings[1:] {
+		if insideRing(p, hole) {
+			return SpatialExterior
+		}
+	}
+	return SpatialInterior
+}
+
+// Check whether a point that is not on the ring is inside it, by counting the
+// crossings of a ray to the right.
+func insideRing(p spatialVec, ring []spatialVec) bool {
+	inside := false
+	for _, segment := range ringSegments(ring) {
+		a, b := segment.a, segment.b
+		if (a.y > p.y) != (b.y > p.y) &&
+			p.x < a.x+(p.y-a.y)*(b.x-a.x)/(b.y-a.y) {
+			inside = !inside
+		}
+	}
+	return inside
+}
@@ -0,0 +1,85 @@
+package godata
+
+import (
+	"testing"
+)
+
+func parseTestGeometry(t *testing.T, wkt string) Geometry {
+	literal, err := parseSpatialLiteral(false, wkt)
+	if err != nil {
+		t.Fatal(wkt + ": " + err.Error())
+	}
+	return literal.Geometry
+}
+
+func TestRelate(t *testing.T) {
+	square := "POLYGON((0 0,4 0,4 4,0 4,0 0))"
+	tests := []struct {
+		a, b   string
+		matrix string
+	}{
+		{square, square, "2FFF1FFF2"},
+		{square, "POLYGON((2 2,6 2,6 6,2 6,2 2))", "212101212"},
+		{square, "POLYGON((4 0,8 0,8 4,4 4,4 0))", "FF2F11212"},
+		{square, "POLYGON((1 1,2 1,2 2,1 2,1 1))", "212FF1FF2"},
+		{square, "POLYGON((10 10,11 10,11 11,10 10))", "FF2FF1212"},
+		{square, "POINT(1 1)", "0F2FF1FF2"},
+		{square, "POINT(4 2)", "FF20F1FF2"},
+		{"POINT(1 1)", "POINT(1 1)", "0FFFFFFF2"},
+		{"LINESTRING(0 0,2 2)", "LINESTRING(0 2,2 0)", "0F1FF0102"},
+		{"LINESTRING(0 0,2 0)", "LINESTRING(1 0,3 0)", "1010F0102"},
+		{"LINESTRING(-1 2,5 2)", square, "101FF0212"},
+		{"LINESTRING(1 1,3 3)", square, "1FF0FF212"},
+		{"POLYGON((0 0,4 0,4 4,0 4,0 0),(1 1,3 1,3 3,1 3,1 1))", "POINT(2 2)", "FF2FF10F2"},
+	}
+	for _, test := range tests {
+		m := Relate(parseTestGeometry(t, test.a), parseTestGeometry(t, test.b))
+		if m.String() != test.matrix {
+			t.Error(test.a + " relate " + test.b + " is " + m.String() + " not " + test.matrix)
+		}
+	}
+}
+
+func TestSpatialPredicates(t *testing.T) {
+	square := "POLYGON((0 0,4 0,4 4,0 4,0 0))"
+	type predicates struct {
+		equals, disjoint, touches, within, contains, crosses, overlaps bool
+	}
+	tests := []struct {
+		a, b     string
+		expected predicates
+	}{
+		{square, "POLYGON((0 0,0 4,4 4,4 0,0 0))", predicates{equals: true, within: true, contains: true}},
+		{square, "POLYGON((2 2,6 2,6 6,2 6,2 2))", predicates{overlaps: true}},
+		{square, "POLYGON((4 0,8 0,8 4,4 4,4 0))", predicates{touches: true}},
+		{square, "POLYGON((10 10,11 10,11 11,10 10))", predicates{disjoint: true}},
+		{"POINT(1 1)", square, predicates{within: true}},
+		{square, "MULTIPOINT((1 1),(2 2))", predicates{contains: true}},
+		{"LINESTRING(0 0,2 2)", "LINESTRING(0 2,2 0)", predicates{crosses: true}},
+		{"LINESTRING(0 0,2 0)", "LINESTRING(1 0,3 0)", predicates{overlaps: true}},
+		{"LINESTRING(-1 2,5 2)", square, predicates{crosses: true}},
+		{"LINESTRING(4 4,6 6)", square, predicates{touches: true}},
+		{"POINT(0 0)", "POINT(1 1)", predicates{disjoint: true}},
+		{"GEOMETRYCOLLECTION(POINT(1 1),LINESTRING(1 1,2 2))", square, predicates{within: true}},
+	}
+	for _, test := range tests {
+		m := Relate(parseTestGeometry(t, test.a), parseTestGeometry(t, test.b))
+		actual := predicates{m.Equals(), m.Disjoint(), m.Touches(), m.Within(), m.Contains(), m.Crosses(), m.Overlaps()}
+		if actual != test.expected {
+			t.Errorf("%s and %s: %+v not %+v (%s)", test.a, test.b, actual, test.expected, m)
+		}
+		if m.Intersects() == test.expected.disjoint {
+			t.Error(test.a + " intersects " + test.b + " is not the opposite of disjoint")
+		}
+	}
+
+	m := Relate(parseTestGeometry(t, square), parseTestGeometry(t, "POINT(1 1)"))
+	for pattern, expected := range map[string]bool{"T*****FF*": true, "1********": false, "T*2***F**": true} {
+		if ok, err := m.Matches(pattern); err != nil || ok != expected {
+			t.Errorf("%s matches %s: %v", m, pattern, ok)
+		}
+	}
+	if _, err := m.Matches("T*"); err == nil {
+		t.Error("Expected an error for a short pattern")
+	}
+}
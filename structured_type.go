@@ -0,0 +1,191 @@
+package godata
+
+import (
+	"strings"
+)
+
+// An entity type or a complex type of a schema.
+type structuredType struct {
+	schema  *GoDataSchema
+	entity  *GoDataEntityType
+	complex *GoDataComplexType
+}
+
+func (t *structuredType) name() string {
+	if t.entity != nil {
+		return t.entity.Name
+	}
+	return t.complex.Name
+}
+
+func (t *structuredType) baseType() string {
+	if t.entity != nil {
+		return t.entity.BaseType
+	}
+	return t.complex.BaseType
+}
+
+// The entity type or complex type.
+func (t *structuredType) reference() interface{} {
+	if t.entity != nil {
+		return t.entity
+	}
+	return t.complex
+}
+
+// Check whether the name is the qualified name of the type, with the
+// namespace or the alias of its schema.
+func (t *structuredType) hasName(name string) bool {
+	return name == t.schema.Namespace+"."+t.name() || (t.schema.Alias != "" && name == t.schema.Alias+"."+t.name())
+}
+
+// Lookup a schema by its namespace or alias.
+func (service *GoDataService) lookupSchema(namespace string) *GoDataSchema {
+	if schema, ok := service.SchemaLookup[namespace]; ok {
+		return schema
+	}
+	for _, schema := range service.SchemaLookup {
+		if schema.Alias != "" && schema.Alias == namespace {
+			return schema
+		}
+	}
+	return nil
+}
+
+// Lookup an entity type or complex type by its qualified name. Returns nil
+// for other types, e.g. primitive types.
+func (service *GoDataService) lookupStructuredType(name string) *structuredType {
+	if element, isCollection := collectionElementType(name); isCollection {
+		name = element
+	}
+	dot := strings.LastIndex(name, ".")
+	if dot < 0 {
+		return nil
+	}
+	schema := service.lookupSchema(name[:dot])
+	if schema == nil {
+		return nil
+	}
+	for _, entity := range schema.EntityTypes {
+		if entity.Name == name[dot+1:] {
+			return &structuredType{schema: schema, entity: entity}
+		}
+	}
+	for _, complex := range schema.ComplexTypes {
+		if complex.Name == name[dot+1:] {
+			return &structuredType{schema: schema, complex: complex}
+		}
+	}
+	return nil
+}
+
+// The structured type of an entity type of the service.
+func (service *GoDataService) entityStructuredType(entity *GoDataEntityType) *structuredType {
+	for _, schema := range service.SchemaLookup {
+		for _, e := range schema.EntityTypes {
+			if e == entity {
+				return &structuredType{schema: schema, entity: entity}
+			}
+		}
+	}
+	return nil
+}
+
+// The type and its base types, starting with the type itself.
+func (service *GoDataService) baseTypes(t *structuredType) []*structuredType {
+	result := []*structuredType{}
+	seen := map[interface{}]bool{}
+	for t != nil && !seen[t.reference()] {
+		seen[t.reference()] = true
+		result = append(result, t)
+		if t.baseType() == "" {
+			break
+		}
+		t = service.lookupStructuredType(t.baseType())
+	}
+	return result
+}
+
+func (service *GoDataService) isDerivedType(derived, base *structuredType) bool {
+	for _, t := range service.baseTypes(derived) {
+		if t.reference() == base.reference() {
+			return true
+		}
+	}
+	return false
+}
+
+// The structural properties of the type, including those of its base types.
+func (service *GoDataService) structuredProperties(t *structuredType) []*GoDataProperty {
+	result := []*GoDataProperty{}
+	types := service.baseTypes(t)
+	for i := len(types) - 1; i >= 0; i-- {
+		if types[i].entity != nil {
+			result = append(result, types[i].entity.Properties...)
+		} else {
+			result = append(result, types[i].complex.Properties...)
+		}
+	}
+	return result
+}
+
+// Lookup a structural property of the type or its base types.
+func (service *GoDataService) structuredProperty(t *structuredType, name string) *GoDataProperty {
+	for _, prop := range service.structuredProperties(t) {
+		if prop.Name == name {
+			return prop
+		}
+	}
+	return nil
+}
+
+// Lookup a navigation property of the type or its base types.
+func (service *GoDataService) structuredNavigationProperty(t *structuredType, name string) *GoDataNavigationProperty {
+	for _, base := range service.baseTypes(t) {
+		props := []*GoDataNavigationProperty{}
+		if base.entity != nil {
+			props = base.entity.NavigationProperties
+		} else {
+			props = base.complex.NavigationProperties
+		}
+		for _, prop := range props {
+			if prop.Name == name {
+				return prop
+			}
+		}
+	}
+	return nil
+}
+
+// Lookup an action or function by its qualified name that is bound to the
+// type or one of its base types. Returns the semantic type and the action or
+// function, or nil if there is none.
+func (service *GoDataService) lookupBoundOperation(name string, t *structuredType) (int, interface{}) {
+	dot := strings.LastIndex(name, ".")
+	schema := service.lookupSchema(name[:dot])
+	if schema == nil {
+		return SemanticTypeUnknown, nil
+	}
+	bound := func(isBound string, params []*GoDataParameter) bool {
+		if isBound != "true" || len(params) == 0 {
+			return false
+		}
+		for _, base := range service.baseTypes(t) {
+			if base.hasName(params[0].Type) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, action := range schema.Actions {
+		if action.Name == name[dot+1:] && bound(action.IsBound, action.Parameters) {
+			return SemanticTypeAction, action
+		}
+	}
+	for _, function := range schema.Functions {
+		if function.Name == name[dot+1:] && bound(function.IsBound, function.Parameters) {
+			return SemanticTypeFunction, function
+		}
+	}
+	return SemanticTypeUnknown, nil
+}
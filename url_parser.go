@@ -8,14 +8,30 @@ import (
 // Parse a request from the HTTP server and format it into a GoDaataRequest type
 // to be passed to a provider to produce a result.
 func ParseRequest(path string, query url.Values) (*GoDataRequest, error) {
+	return parseRequest(path, query, nil)
+}
+
+// Parse a request like ParseRequest, allowing the custom filter functions of
+// the service in $filter and in the filters of $expand.
+func (service *GoDataService) ParseRequest(path string, query url.Values) (*GoDataRequest, error) {
+	return parseRequest(path, query, service)
+}
+
+func parseRequest(path string, query url.Values, service *GoDataService) (*GoDataRequest, error) {
+	if err := service.limits().checkURL(path, query.Encode()); err != nil {
+		return nil, err
+	}
 	firstSegment, lastSegment, err := ParseUrlPath(path)
 	if err != nil {
 		return nil, err
 	}
-	parsedQuery, err := ParseUrlQuery(query)
+	parsedQuery, err := parseUrlQuery(query, service)
 	if err != nil {
 		return nil, err
 	}
+	if err := queryAliases(query, service).resolvePath(firstSegment); err != nil {
+		return nil, err
+	}
 
 	return &GoDataRequest{firstSegment, lastSegment, parsedQuery, RequestKindUnknown}, nil
 }
@@ -42,6 +58,11 @@ func SemanticizeRequest(req *GoDataRequest, service *GoDataService) error {
 		if err != nil {
 			return err
 		}
+		OptimizeFilterQuery(req.Query.Filter)
+		err = SemanticizeApplyQuery(req.Query.Apply, service, entityType)
+		if err != nil {
+			return err
+		}
 		err = SemanticizeExpandQuery(req.Query.Expand, service, entityType)
 		if err != nil {
 			return err
@@ -151,6 +172,9 @@ func SemanticizePathSegment(segment *GoDataSegment, service *GoDataService) erro
 		if err != nil {
 			return err
 		}
+		if err := semanticizeEnumKeys(segment, service); err != nil {
+			return err
+		}
 
 		if segment.Prev == nil {
 			// this is the first segment
@@ -202,6 +226,10 @@ func SemanticizePathSegment(segment *GoDataSegment, service *GoDataService) erro
 }
 
 func ParseUrlQuery(query url.Values) (*GoDataQuery, error) {
+	return parseUrlQuery(query, nil)
+}
+
+func parseUrlQuery(query url.Values, service *GoDataService) (*GoDataQuery, error) {
 	filter := query.Get("$filter")
 	apply := query.Get("$apply")
 	expand := query.Get("$expand")
@@ -215,34 +243,44 @@ func ParseUrlQuery(query url.Values) (*GoDataQuery, error) {
 	format := query.Get("$format")
 
 	result := &GoDataQuery{}
+	aliases := queryAliases(query, service)
 
 	var err error = nil
 	if filter != "" {
-		result.Filter, err = ParseFilterString(filter)
+		result.Filter, err = service.ParseFilterString(filter)
+		if err == nil {
+			err = optionError("$filter", filter, aliases.resolveFilter(result.Filter))
+		}
 	}
 	if err != nil {
 		return nil, err
 	}
 	if apply != "" {
-		result.Apply, err = ParseApplyString(apply)
+		result.Apply, err = service.ParseApplyString(apply)
 	}
 	if err != nil {
 		return nil, err
 	}
 	if expand != "" {
-		result.Expand, err = ParseExpandString(expand)
+		result.Expand, err = service.ParseExpandString(expand)
+		if err == nil {
+			err = aliases.resolveExpand(result.Expand)
+		}
 	}
 	if err != nil {
 		return nil, err
 	}
 	if sel != "" {
-		result.Select, err = ParseSelectString(sel)
+		result.Select, err = service.ParseSelectString(sel)
 	}
 	if err != nil {
 		return nil, err
 	}
 	if orderby != "" {
-		result.OrderBy, err = ParseOrderByString(orderby)
+		result.OrderBy, err = service.ParseOrderByString(orderby)
+		if err == nil {
+			err = optionError("$orderby", orderby, aliases.resolveOrderBy(result.OrderBy))
+		}
 	}
 	if err != nil {
 		return nil, err
@@ -283,17 +321,62 @@ func ParseUrlQuery(query url.Values) (*GoDataQuery, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := service.limits().checkQuery(result); err != nil {
+		return nil, err
+	}
 
 	return result, err
 }
 
+// Resolve the values of the identifier of an entity set segment whose key
+// properties have an enumeration type. The value of a single key may be given
+// without the name of the key property.
+func semanticizeEnumKeys(segment *GoDataSegment, service *GoDataService) error {
+	if segment.Identifier == nil {
+		return nil
+	}
+	entity, err := service.LookupEntityType(segment.SemanticReference.(*GoDataEntitySet).EntityType)
+	if err != nil {
+		return err
+	}
+	for name, value := range *segment.Identifier {
+		if value == "" && !segment.Identifier.HasMultiple() && entity.Key != nil && entity.Key.PropertyRef != nil {
+			name, value = entity.Key.PropertyRef.Name, name
+		}
+		prop, ok := service.PropertyLookup[entity][name]
+		if !ok {
+			continue
+		}
+		enum, err := service.LookupEnumType(prop.Type)
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(value, "'") {
+			// the member without the name of the type
+			value = prop.Type + value
+		}
+		v, err := service.ParseEnumLiteral(value)
+		if err != nil {
+			return BadRequestError("Invalid value " + value + " of the key " + name + ": " + err.Error())
+		}
+		if v.Type != enum {
+			return BadRequestError("The key " + name + " must be of the enumeration type " + prop.Type + ", not " + value + ".")
+		}
+		if segment.EnumKeys == nil {
+			segment.EnumKeys = map[string]*GoDataEnumValue{}
+		}
+		segment.EnumKeys[name] = v
+	}
+	return nil
+}
+
 func ParseIdentifiers(segment string) *GoDataIdentifier {
 	if !strings.Contains(segment, "(") || !strings.Contains(segment, ")") {
 		return nil
 	}
 
 	rawIds := segment[strings.LastIndex(segment, "(")+1 : strings.LastIndex(segment, ")")]
-	parts := strings.Split(rawIds, ",")
+	parts := splitOutsideQuotes(rawIds, ',')
 
 	result := make(GoDataIdentifier)
 
@@ -309,6 +392,25 @@ func ParseIdentifiers(segment string) *GoDataIdentifier {
 	return &result
 }
 
+// Split the string at the separators that are not inside a quoted literal, so
+// that string and enumeration values may contain the separator.
+func splitOutsideQuotes(s string, sep byte) []string {
+	parts := []string{}
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\'':
+			// a doubled quote inside a literal toggles twice
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
 func ParseName(segment string) string {
 	if strings.Contains(segment, "(") {
 		return segment[:strings.LastIndex(segment, "(")]
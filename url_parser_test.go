@@ -2,6 +2,7 @@ package godata
 
 import (
 	"net/url"
+	"strings"
 	"testing"
 )
 
@@ -32,3 +33,91 @@ func TestUrlParser(t *testing.T) {
 		return
 	}
 }
+
+func TestUrlParserEnumKey(t *testing.T) {
+	service, err := BuildService(&DummyProvider{}, "http://localhost")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	id := ParseIdentifiers("Customers(Name='a,b',Channels=Store.Channels'Email,Post')")
+	name, _ := id.GetKey("Name")
+	if name != "'a,b'" {
+		t.Error("Name key is " + name)
+	}
+	channels, _ := id.GetKey("Channels")
+	value, err := service.ParseEnumLiteral(channels)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if value.Value != 5 || value.String() != "Email,Post" {
+		t.Error("Channels key is " + value.String())
+	}
+
+	field := &GoDataResponseField{value}
+	output, err := field.Json()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(output) != "\"Email,Post\"" {
+		t.Error("Enum value is serialized as " + string(output))
+	}
+}
+
+func TestSemanticizeEnumKey(t *testing.T) {
+	service, err := BuildService(&DummyProvider{}, "http://localhost")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	tests := map[string]string{
+		"Customers(Tier=Store.Tier'Gold')":                        "Gold",
+		"Customers(Tier='Silver')":                                "Silver",
+		"Customers(Name='a',Channels=Store.Channels'Email,Post')": "Email,Post",
+	}
+	for path, expected := range tests {
+		req, err := service.ParseRequest(path, url.Values{})
+		if err != nil {
+			t.Error(path + ": " + err.Error())
+			continue
+		}
+		if err := SemanticizeRequest(req, service); err != nil {
+			t.Error(path + ": " + err.Error())
+			continue
+		}
+		if len(req.FirstSegment.EnumKeys) != 1 {
+			t.Error(path + ": expected one enumeration key")
+			continue
+		}
+		for _, value := range req.FirstSegment.EnumKeys {
+			if value.String() != expected {
+				t.Error(path + ": expected " + expected + ", got " + value.String())
+			}
+		}
+	}
+
+	invalid := map[string]string{
+		"Customers(Tier=Store.Tier'Platinum')":  "Platinum is not a member of enumeration Tier",
+		"Customers(Tier=Store.Channels'Email')": "must be of the enumeration type Store.Tier",
+		"Customers(Tier=1)":                     "Invalid enumeration literal 1",
+	}
+	for path, expected := range invalid {
+		req, err := service.ParseRequest(path, url.Values{})
+		if err != nil {
+			t.Error(path + ": " + err.Error())
+			continue
+		}
+		err = SemanticizeRequest(req, service)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Error("Expected an error containing '" + expected + "' for " + path)
+			continue
+		}
+		if err.(*GoDataError).ResponseCode != 400 {
+			t.Error(path + ": expected a bad request")
+		}
+	}
+}